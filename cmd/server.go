@@ -46,7 +46,8 @@ func init() {
 	serverCmd.PersistentFlags().String("pull-policy", "ifnotpresent", "Pull policy that should be applied (ifnotpresent,never,always)")
 	serverCmd.PersistentFlags().String("service-account", "default", "Service account that should be used for deployed pods")
 	serverCmd.PersistentFlags().String("image-pull-secrets", "", "Comma separated list of image pull secrets that should be used")
-	serverCmd.PersistentFlags().String("pod-template", "", "Pod file that should be used as the base for creating pods")
+	serverCmd.PersistentFlags().String("pod-patch", "", "Strategic merge or json patch that is applied to all pods (inline, configmap:name/key or file:path)")
+	serverCmd.PersistentFlags().String("pod-template", "", "Pod file, directory or comma-separated list of pod files that should be used as the base for creating pods")
 	serverCmd.PersistentFlags().String("pod-name-prefix", "kubedock", "The prefix of the name to be used in the created pods")
 	serverCmd.PersistentFlags().BoolP("inspector", "i", false, "Enable image inspect to fetch container port config from a registry")
 	serverCmd.PersistentFlags().DurationP("timeout", "t", 1*time.Minute, "Container creating/deletion timeout")
@@ -55,20 +56,50 @@ func init() {
 	serverCmd.PersistentFlags().String("request-memory", "", "Default k8s memory resource request (optionally add ,limit)")
 	serverCmd.PersistentFlags().String("request-ephemeral-storage", "", "Default k8s ephemeral-storage resource request (optionally add ,limit)")
 	serverCmd.PersistentFlags().String("node-selector", "", "A node selector in the form of key1=value1[,key2=value2]")
+	serverCmd.PersistentFlags().String("tolerations", "", "Default k8s tolerations in the form of key[=value][:effect][,...]")
+	serverCmd.PersistentFlags().String("node-affinity", "", "Default required k8s node affinity as a label selector expression")
+	serverCmd.PersistentFlags().String("pod-anti-affinity", "", "Default required k8s pod anti-affinity as a label selector expression (optionally add @topologyKey)")
+	serverCmd.PersistentFlags().String("priority-class", "", "Default k8s priority class name for deployed pods")
+	serverCmd.PersistentFlags().String("runtime-class", "", "Default k8s runtime class name for deployed pods")
+	serverCmd.PersistentFlags().String("topology-spread", "", "Default k8s topology spread constraints in the form of topologyKey[:maxSkew[:whenUnsatisfiable]][,...]")
+	serverCmd.PersistentFlags().String("workload", "pod", "Default workload used to run containers (pod,job)")
+	serverCmd.PersistentFlags().Duration("job-ttl", 60*time.Minute, "Time after which finished jobs are removed by kubernetes when running containers as a job")
 	serverCmd.PersistentFlags().Int64("active-deadline-seconds", -1, "Default value for pod deadline, in seconds (a negative value means no deadline)")
 	serverCmd.PersistentFlags().String("runas-user", "", "Numeric UID to run pods as (defaults to UID in image)")
 	serverCmd.PersistentFlags().Bool("lock", false, "Lock namespace for this instance")
 	serverCmd.PersistentFlags().Duration("lock-timeout", 15*time.Minute, "Max time trying to acquire namespace lock")
+	serverCmd.PersistentFlags().String("lock-namespaces", "", "Comma separated list of namespaces of which the first free namespace is locked")
+	serverCmd.PersistentFlags().String("lock-namespace-selector", "", "Label selector of namespaces of which the first free namespace is locked")
 	serverCmd.PersistentFlags().StringP("verbosity", "v", "1", "Log verbosity level")
 	serverCmd.PersistentFlags().BoolP("prune-start", "P", false, "Prune all existing kubedock resources before starting")
+	serverCmd.PersistentFlags().String("instance-id", "", "Fixed kubedock instance id, instead of a random generated id")
+	serverCmd.PersistentFlags().Bool("adopt", false, "Adopt containers of the same instance id at startup, and keep resources when exiting")
+	serverCmd.PersistentFlags().Bool("ephemeral-namespace", false, "Create a new namespace for this instance, which is removed when exiting")
+	serverCmd.PersistentFlags().String("namespace-template", "", "Namespace from which resources are copied into the ephemeral namespace (defaults to --namespace)")
+	serverCmd.PersistentFlags().Bool("replicas", false, "Coordinate with other kubedock replicas in the namespace and forward requests for their containers")
+	serverCmd.PersistentFlags().String("state-store", "", "Durable store for the container, network, image and exec records (file:path or secret:name)")
 	serverCmd.PersistentFlags().Bool("port-forward", false, "Open port-forwards for all services")
 	serverCmd.PersistentFlags().Bool("reverse-proxy", false, "Reverse proxy all services via 0.0.0.0 on the kubedock host as well")
+	serverCmd.PersistentFlags().String("proxy-bind-ip", "", "Default ip the port-forwards and reverse-proxies listen on (defaults to localhost for port-forwards and 0.0.0.0 for reverse-proxies)")
 	serverCmd.PersistentFlags().Bool("pre-archive", false, "Enable support for copying single files to containers without starting them")
 	serverCmd.PersistentFlags().Bool("disable-services", false, "Disable service creation (requires a network solution such as kubedock-dns)")
+	serverCmd.PersistentFlags().Bool("network-policies", false, "Isolate docker networks with k8s network policies")
+	serverCmd.PersistentFlags().Bool("network-scoped-services", false, "Create the services of network aliases per network, so equal aliases in different networks don't collide (requires --dns and --dns-inject)")
+	serverCmd.PersistentFlags().Bool("dns", false, "Enable the embedded dns server that resolves container names and network aliases")
+	serverCmd.PersistentFlags().String("dns-listen-addr", "", "Address the embedded dns server listens on (default port 53 on the kubedock ip)")
+	serverCmd.PersistentFlags().Bool("dns-forward", false, "Forward dns queries for other names to the nameserver of kubedock")
+	serverCmd.PersistentFlags().Bool("dns-inject", false, "Configure the embedded dns server as the nameserver of the deployed pods")
+	serverCmd.PersistentFlags().String("dns-advertise-ip", "", "Ip via which the pods reach the embedded dns server (default kubedock ip, in-cluster only)")
+	serverCmd.PersistentFlags().String("expose", "", "Expose container ports outside the cluster via k8s services or ingresses (nodeport, loadbalancer, ingress)")
+	serverCmd.PersistentFlags().String("expose-host", "", "Host via which exposed containers are reachable (node address for nodeport, base domain for ingress)")
+	serverCmd.PersistentFlags().String("ingress-class", "", "Ingress class of the ingresses that expose containers")
+	serverCmd.PersistentFlags().String("proxy-listen-addr", "", "Address of the socks5 and http connect proxy that connects to containers by name (disabled if empty)")
+	serverCmd.PersistentFlags().String("host-ports", "", "Ports on the kubedock host that containers can reach via host.docker.internal (comma separated)")
 	serverCmd.PersistentFlags().Bool("ignore-container-memory", false, "Ignore container memory setting and use requests/limits from gobal settings or container labels")
 	serverCmd.PersistentFlags().Float32("kube-api-qps", 0, "Maximum QPS for requests to the Kubernetes API (0 uses client default)")
 	serverCmd.PersistentFlags().Int("kube-api-burst", 0, "Maximum burst for requests to the Kubernetes API (0 uses client default)")
 	serverCmd.PersistentFlags().Float64("poll-rate", 0, "Maximum polling requests per second towards the backend (0 uses default of 1)")
+	serverCmd.PersistentFlags().Bool("disable-informer", false, "Disable the pod informer and poll the container status instead")
 	serverCmd.PersistentFlags().Int("poll-burst", 0, "Maximum burst of poll requests towards the backend (0 uses default of 3)")
 
 	viper.BindPFlag("server.listen-addr", serverCmd.PersistentFlags().Lookup("listen-addr"))
@@ -83,6 +114,7 @@ func init() {
 	viper.BindPFlag("kubernetes.pull-policy", serverCmd.PersistentFlags().Lookup("pull-policy"))
 	viper.BindPFlag("kubernetes.service-account", serverCmd.PersistentFlags().Lookup("service-account"))
 	viper.BindPFlag("kubernetes.image-pull-secrets", serverCmd.PersistentFlags().Lookup("image-pull-secrets"))
+	viper.BindPFlag("kubernetes.pod-patch", serverCmd.PersistentFlags().Lookup("pod-patch"))
 	viper.BindPFlag("kubernetes.pod-template", serverCmd.PersistentFlags().Lookup("pod-template"))
 	viper.BindPFlag("kubernetes.pod-name-prefix", serverCmd.PersistentFlags().Lookup("pod-name-prefix"))
 	viper.BindPFlag("kubernetes.timeout", serverCmd.PersistentFlags().Lookup("timeout"))
@@ -90,22 +122,52 @@ func init() {
 	viper.BindPFlag("kubernetes.request-memory", serverCmd.PersistentFlags().Lookup("request-memory"))
 	viper.BindPFlag("kubernetes.request-ephemeral-storage", serverCmd.PersistentFlags().Lookup("request-ephemeral-storage"))
 	viper.BindPFlag("kubernetes.node-selector", serverCmd.PersistentFlags().Lookup("node-selector"))
+	viper.BindPFlag("kubernetes.tolerations", serverCmd.PersistentFlags().Lookup("tolerations"))
+	viper.BindPFlag("kubernetes.node-affinity", serverCmd.PersistentFlags().Lookup("node-affinity"))
+	viper.BindPFlag("kubernetes.pod-anti-affinity", serverCmd.PersistentFlags().Lookup("pod-anti-affinity"))
+	viper.BindPFlag("kubernetes.priority-class", serverCmd.PersistentFlags().Lookup("priority-class"))
+	viper.BindPFlag("kubernetes.runtime-class", serverCmd.PersistentFlags().Lookup("runtime-class"))
+	viper.BindPFlag("kubernetes.topology-spread", serverCmd.PersistentFlags().Lookup("topology-spread"))
+	viper.BindPFlag("kubernetes.workload", serverCmd.PersistentFlags().Lookup("workload"))
+	viper.BindPFlag("kubernetes.job-ttl", serverCmd.PersistentFlags().Lookup("job-ttl"))
 	viper.BindPFlag("kubernetes.active-deadline-seconds", serverCmd.PersistentFlags().Lookup("active-deadline-seconds"))
 	viper.BindPFlag("kubernetes.runas-user", serverCmd.PersistentFlags().Lookup("runas-user"))
 	viper.BindPFlag("registry.inspector", serverCmd.PersistentFlags().Lookup("inspector"))
 	viper.BindPFlag("reaper.reapmax", serverCmd.PersistentFlags().Lookup("reapmax"))
 	viper.BindPFlag("lock.enabled", serverCmd.PersistentFlags().Lookup("lock"))
 	viper.BindPFlag("lock.timeout", serverCmd.PersistentFlags().Lookup("lock-timeout"))
+	viper.BindPFlag("lock.namespaces", serverCmd.PersistentFlags().Lookup("lock-namespaces"))
+	viper.BindPFlag("lock.namespace-selector", serverCmd.PersistentFlags().Lookup("lock-namespace-selector"))
 	viper.BindPFlag("verbosity", serverCmd.PersistentFlags().Lookup("verbosity"))
 	viper.BindPFlag("prune-start", serverCmd.PersistentFlags().Lookup("prune-start"))
+	viper.BindPFlag("instance-id", serverCmd.PersistentFlags().Lookup("instance-id"))
+	viper.BindPFlag("adopt", serverCmd.PersistentFlags().Lookup("adopt"))
+	viper.BindPFlag("ephemeral-namespace", serverCmd.PersistentFlags().Lookup("ephemeral-namespace"))
+	viper.BindPFlag("kubernetes.namespace-template", serverCmd.PersistentFlags().Lookup("namespace-template"))
+	viper.BindPFlag("replicas", serverCmd.PersistentFlags().Lookup("replicas"))
+	viper.BindPFlag("state-store", serverCmd.PersistentFlags().Lookup("state-store"))
 	viper.BindPFlag("port-forward", serverCmd.PersistentFlags().Lookup("port-forward"))
 	viper.BindPFlag("reverse-proxy", serverCmd.PersistentFlags().Lookup("reverse-proxy"))
+	viper.BindPFlag("proxy-bind-ip", serverCmd.PersistentFlags().Lookup("proxy-bind-ip"))
 	viper.BindPFlag("pre-archive", serverCmd.PersistentFlags().Lookup("pre-archive"))
 	viper.BindPFlag("disable-services", serverCmd.PersistentFlags().Lookup("disable-services"))
+	viper.BindPFlag("network-policies", serverCmd.PersistentFlags().Lookup("network-policies"))
+	viper.BindPFlag("network-scoped-services", serverCmd.PersistentFlags().Lookup("network-scoped-services"))
+	viper.BindPFlag("dns", serverCmd.PersistentFlags().Lookup("dns"))
+	viper.BindPFlag("dns-listen-addr", serverCmd.PersistentFlags().Lookup("dns-listen-addr"))
+	viper.BindPFlag("dns-forward", serverCmd.PersistentFlags().Lookup("dns-forward"))
+	viper.BindPFlag("dns-inject", serverCmd.PersistentFlags().Lookup("dns-inject"))
+	viper.BindPFlag("dns-advertise-ip", serverCmd.PersistentFlags().Lookup("dns-advertise-ip"))
+	viper.BindPFlag("expose", serverCmd.PersistentFlags().Lookup("expose"))
+	viper.BindPFlag("expose-host", serverCmd.PersistentFlags().Lookup("expose-host"))
+	viper.BindPFlag("ingress-class", serverCmd.PersistentFlags().Lookup("ingress-class"))
+	viper.BindPFlag("proxy-listen-addr", serverCmd.PersistentFlags().Lookup("proxy-listen-addr"))
+	viper.BindPFlag("host-ports", serverCmd.PersistentFlags().Lookup("host-ports"))
 	viper.BindPFlag("ignore-container-memory", serverCmd.PersistentFlags().Lookup("ignore-container-memory"))
 	viper.BindPFlag("kubernetes.qps", serverCmd.PersistentFlags().Lookup("kube-api-qps"))
 	viper.BindPFlag("kubernetes.burst", serverCmd.PersistentFlags().Lookup("kube-api-burst"))
 	viper.BindPFlag("server.poll-rate", serverCmd.PersistentFlags().Lookup("poll-rate"))
+	viper.BindPFlag("disable-informer", serverCmd.PersistentFlags().Lookup("disable-informer"))
 	viper.BindPFlag("server.poll-burst", serverCmd.PersistentFlags().Lookup("poll-burst"))
 
 	viper.BindEnv("server.listen-addr", "SERVER_LISTEN_ADDR")
@@ -119,6 +181,7 @@ func init() {
 	viper.BindEnv("kubernetes.pull-policy", "PULL_POLICY")
 	viper.BindEnv("kubernetes.service-account", "SERVICE_ACCOUNT")
 	viper.BindEnv("kubernetes.image-pull-secrets", "IMAGE_PULL_SECRETS")
+	viper.BindEnv("kubernetes.pod-patch", "POD_PATCH")
 	viper.BindEnv("kubernetes.pod-template", "POD_TEMPLATE")
 	viper.BindEnv("kubernetes.pod-name-prefix", "POD_NAME_PREFIX")
 	viper.BindEnv("kubernetes.timeout", "TIME_OUT")
@@ -126,6 +189,14 @@ func init() {
 	viper.BindEnv("kubernetes.request-memory", "K8S_REQUEST_MEMORY")
 	viper.BindEnv("kubernetes.request-ephemeral-storage", "K8S_REQUEST_EPHEMERAL_STORAGE")
 	viper.BindEnv("kubernetes.node-selector", "K8S_NODE_SELECTOR")
+	viper.BindEnv("kubernetes.tolerations", "K8S_TOLERATIONS")
+	viper.BindEnv("kubernetes.node-affinity", "K8S_NODE_AFFINITY")
+	viper.BindEnv("kubernetes.pod-anti-affinity", "K8S_POD_ANTI_AFFINITY")
+	viper.BindEnv("kubernetes.priority-class", "K8S_PRIORITY_CLASS")
+	viper.BindEnv("kubernetes.runtime-class", "K8S_RUNTIME_CLASS")
+	viper.BindEnv("kubernetes.topology-spread", "K8S_TOPOLOGY_SPREAD")
+	viper.BindEnv("kubernetes.workload", "K8S_WORKLOAD")
+	viper.BindEnv("kubernetes.job-ttl", "K8S_JOB_TTL")
 	viper.BindEnv("kubernetes.active-deadline-seconds", "K8S_ACTIVE_DEADLINE_SECONDS")
 	viper.BindEnv("kubernetes.runas-user", "K8S_RUNAS_USER")
 	viper.BindEnv("kubernetes.timeout", "TIME_OUT")
@@ -134,6 +205,28 @@ func init() {
 	viper.BindEnv("kubernetes.qps", "K8S_QPS")
 	viper.BindEnv("kubernetes.burst", "K8S_BURST")
 	viper.BindEnv("server.poll-rate", "POLL_RATE")
+	viper.BindEnv("disable-informer", "DISABLE_INFORMER")
+	viper.BindEnv("instance-id", "INSTANCE_ID")
+	viper.BindEnv("adopt", "ADOPT")
+	viper.BindEnv("state-store", "STATE_STORE")
+	viper.BindEnv("network-policies", "NETWORK_POLICIES")
+	viper.BindEnv("network-scoped-services", "NETWORK_SCOPED_SERVICES")
+	viper.BindEnv("dns", "DNS")
+	viper.BindEnv("dns-listen-addr", "DNS_LISTEN_ADDR")
+	viper.BindEnv("dns-forward", "DNS_FORWARD")
+	viper.BindEnv("dns-inject", "DNS_INJECT")
+	viper.BindEnv("dns-advertise-ip", "DNS_ADVERTISE_IP")
+	viper.BindEnv("proxy-bind-ip", "PROXY_BIND_IP")
+	viper.BindEnv("expose", "EXPOSE")
+	viper.BindEnv("expose-host", "EXPOSE_HOST")
+	viper.BindEnv("ingress-class", "INGRESS_CLASS")
+	viper.BindEnv("proxy-listen-addr", "PROXY_LISTEN_ADDR")
+	viper.BindEnv("host-ports", "HOST_PORTS")
+	viper.BindEnv("replicas", "REPLICAS")
+	viper.BindEnv("lock.namespaces", "LOCK_NAMESPACES")
+	viper.BindEnv("ephemeral-namespace", "EPHEMERAL_NAMESPACE")
+	viper.BindEnv("kubernetes.namespace-template", "NAMESPACE_TEMPLATE")
+	viper.BindEnv("lock.namespace-selector", "LOCK_NAMESPACE_SELECTOR")
 	viper.BindEnv("server.poll-burst", "POLL_BURST")
 
 	serverCmd.PersistentFlags().Lookup("tls-enable").Hidden = true
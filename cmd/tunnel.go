@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"flag"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/tunnel"
+)
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Start the kubedock host tunnel agent",
+	Run:   startTunnel,
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+
+	tunnelCmd.PersistentFlags().String("control-addr", ":7070", "Address to accept the tunnel connections of kubedock on")
+	tunnelCmd.PersistentFlags().IntSlice("ports", []int{}, "Ports that are relayed to the kubedock host")
+	tunnelCmd.PersistentFlags().StringP("verbosity", "v", "1", "Log verbosity level")
+
+	viper.BindPFlag("tunnel.control-addr", tunnelCmd.PersistentFlags().Lookup("control-addr"))
+	viper.BindPFlag("tunnel.ports", tunnelCmd.PersistentFlags().Lookup("ports"))
+
+	// the token is only read from the environment, so it's not visible in
+	// the command of the pod
+	viper.BindEnv("tunnel.token", "TUNNEL_TOKEN")
+}
+
+func startTunnel(cmd *cobra.Command, args []string) {
+	// verbosity is read from the flag, as the viper key is bound to the
+	// verbosity flag of the server command
+	verbosity, _ := cmd.Flags().GetString("verbosity")
+	flag.Set("v", verbosity)
+	ports, err := cmd.Flags().GetIntSlice("ports")
+	if err != nil {
+		klog.Fatalf("error parsing ports: %s", err)
+	}
+	agent := tunnel.NewAgent(viper.GetString("tunnel.control-addr"), ports, viper.GetString("tunnel.token"))
+	if err := agent.ListenAndServe(make(chan struct{})); err != nil {
+		klog.Fatalf("error running tunnel agent: %s", err)
+	}
+	select {}
+}
@@ -0,0 +1,188 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+const (
+	// AnnotationContainer is the pod annotation that contains the json
+	// representation of the container that runs in the pod.
+	AnnotationContainer = "kubedock.container"
+	// AnnotationNetworks is the pod annotation that contains the json
+	// representation of the networks the container is connected to.
+	AnnotationNetworks = "kubedock.networks"
+)
+
+// PersistContainer will store the metadata of given container, and the
+// networks it's connected to, as annotations on the pod that runs the
+// container. This allows a restarted kubedock to adopt the container.
+func (in *instance) PersistContainer(tainr *types.Container, netws []*types.Network) error {
+	pod, err := in.getPod(tainr)
+	if err != nil {
+		return err
+	}
+	// the environment may contain credentials, and is stored in a secret
+	// instead of the annotation
+	cp := *tainr
+	cp.Env = nil
+	ctnr, err := json.Marshal(&cp)
+	if err != nil {
+		return err
+	}
+	if err := in.persistEnv(tainr, pod); err != nil {
+		return err
+	}
+	nws, err := json.Marshal(netws)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AnnotationContainer: string(ctnr),
+				AnnotationNetworks:  string(nws),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = in.cli.CoreV1().Pods(pod.Namespace).Patch(context.Background(), pod.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// getEnvSecretName will return the name of the secret that contains the
+// persisted environment of given container.
+func getEnvSecretName(tainr *types.Container) string {
+	return tainr.GetPodName() + "-env"
+}
+
+// persistEnv will store the environment of given container in a secret
+// that is owned by given pod, so it's removed together with the pod.
+func (in *instance) persistEnv(tainr *types.Container, pod *corev1.Pod) error {
+	if len(tainr.Env) == 0 {
+		return nil
+	}
+	env, err := json.Marshal(tainr.Env)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            getEnvSecretName(tainr),
+			Namespace:       pod.Namespace,
+			Labels:          in.getLabels(nil, tainr),
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: pod.Name, UID: pod.UID}},
+		},
+		Data: map[string][]byte{"env": env},
+	}
+	_, err = in.cli.CoreV1().Secrets(pod.Namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = in.cli.CoreV1().Secrets(pod.Namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// getPersistedEnv will return the environment of given container as stored
+// in its secret, or nil if no environment was persisted.
+func (in *instance) getPersistedEnv(tainr *types.Container) ([]string, error) {
+	secret, err := in.cli.CoreV1().Secrets(in.namespace).Get(context.Background(), getEnvSecretName(tainr), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	env := []string{}
+	if err := json.Unmarshal(secret.Data["env"], &env); err != nil {
+		return nil, fmt.Errorf("invalid environment in secret %s: %w", secret.Name, err)
+	}
+	return env, nil
+}
+
+// AdoptContainers will return the containers, and the networks they are
+// connected to, that were persisted on the pods owned by the current
+// kubedock instance id. The state of the containers is updated with the
+// current state of their pods.
+func (in *instance) AdoptContainers() ([]*types.Container, []*types.Network, error) {
+	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.id=" + config.InstanceID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	tainrs := []*types.Container{}
+	netws := []*types.Network{}
+	seen := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		tainr, nws, err := in.adoptPod(&pod)
+		if err != nil {
+			klog.Warningf("ignoring pod %s: %s", pod.Name, err)
+			continue
+		}
+		if tainr == nil || seen[tainr.ID] {
+			continue
+		}
+		seen[tainr.ID] = true
+		tainrs = append(tainrs, tainr)
+		netws = append(netws, nws...)
+	}
+	return tainrs, netws, nil
+}
+
+// adoptPod will return the container and networks as persisted in the
+// annotations of given pod, or nil if the pod has no persisted container.
+func (in *instance) adoptPod(pod *corev1.Pod) (*types.Container, []*types.Network, error) {
+	ctnr, ok := pod.Annotations[AnnotationContainer]
+	if !ok {
+		return nil, nil, nil
+	}
+	tainr := &types.Container{}
+	if err := json.Unmarshal([]byte(ctnr), tainr); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s annotation: %w", AnnotationContainer, err)
+	}
+	if len(tainr.Env) == 0 {
+		env, err := in.getPersistedEnv(tainr)
+		if err != nil {
+			return nil, nil, err
+		}
+		tainr.Env = env
+	}
+	netws := []*types.Network{}
+	if nws, ok := pod.Annotations[AnnotationNetworks]; ok {
+		if err := json.Unmarshal([]byte(nws), &netws); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s annotation: %w", AnnotationNetworks, err)
+		}
+	}
+
+	state, err := in.GetContainerStatus(tainr)
+	if err != nil {
+		klog.V(2).Infof("container %s failed: %s", tainr.ShortID, err)
+	}
+	tainr.Running = (state == DeployRunning)
+	tainr.Completed = (state == DeployCompleted)
+	tainr.Failed = (state == DeployFailed)
+	if !tainr.Running && tainr.Finished.IsZero() {
+		tainr.Finished = time.Now()
+	}
+	return tainr, netws, nil
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestPersistAndAdoptContainers(t *testing.T) {
+	tainr := &types.Container{
+		ID:          "tb303tb303",
+		ShortID:     "tb303",
+		Name:        "f1spirit",
+		Image:       "alpine:3",
+		Env:         []string{"FOO=bar"},
+		MappedPorts: map[int]int{30303: 8080},
+		Networks:    map[string]interface{}{"nw1": nil},
+		PreArchives: []types.PreArchive{{Path: "/tmp", Archive: []byte("tar")}},
+		Running:     true,
+	}
+	tainr.AddStopChannel(make(chan struct{}, 1))
+	netws := []*types.Network{{ID: "nw1", ShortID: "nw1", Name: "testnet"}}
+
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      tainr.GetPodName(),
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock.id": config.InstanceID, "kubedock.containerid": "tb303"},
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "not-persisted",
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock.id": config.InstanceID, "kubedock.containerid": "tr808"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "other-instance",
+				Namespace:   "default",
+				Labels:      map[string]string{"kubedock.id": "other", "kubedock.containerid": "sh101"},
+				Annotations: map[string]string{AnnotationContainer: `{"ID":"sh101"}`},
+			},
+		},
+	}
+
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(pods[0], pods[1], pods[2])}
+	if err := kub.PersistContainer(tainr, netws); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	pod, err := kub.cli.CoreV1().Pods("default").Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if strings.Contains(pod.Annotations[AnnotationContainer], "FOO=bar") {
+		t.Errorf("expected environment not to be stored in the pod annotations")
+	}
+	if _, err := kub.cli.CoreV1().Secrets("default").Get(context.Background(), getEnvSecretName(tainr), metav1.GetOptions{}); err != nil {
+		t.Errorf("expected environment to be stored in a secret: %s", err)
+	}
+
+	tainrs, nws, err := kub.AdoptContainers()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(tainrs) != 1 {
+		t.Fatalf("expected 1 adopted container, but got %d", len(tainrs))
+	}
+	adopted := tainrs[0]
+	if adopted.ID != tainr.ID || adopted.Name != tainr.Name || adopted.Image != tainr.Image {
+		t.Errorf("expected container %v, but got %v", tainr, adopted)
+	}
+	if adopted.MappedPorts[30303] != 8080 || len(adopted.Env) != 1 {
+		t.Errorf("expected mapped ports and env to be adopted, but got %v", adopted)
+	}
+	if _, ok := adopted.Networks["nw1"]; !ok {
+		t.Errorf("expected network nw1 to be adopted")
+	}
+	if len(adopted.PreArchives) != 0 || len(adopted.StopChannels) != 0 {
+		t.Errorf("expected pre-archives and channels not to be persisted")
+	}
+	if adopted.Running || !adopted.Completed || adopted.Finished.IsZero() {
+		t.Errorf("expected adopted container to be completed")
+	}
+	if len(nws) != 1 || nws[0].Name != "testnet" {
+		t.Errorf("expected network testnet to be adopted, but got %v", nws)
+	}
+}
@@ -1,19 +1,17 @@
 package backend
 
 import (
-	"context"
 	"io"
 	"sync"
 
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/util/attach"
 	"github.com/joyrex2001/kubedock/internal/util/ioproxy"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // AttachContainer will attach to a container and stream stdin/stdout/stderr.
 func (in *instance) AttachContainer(tainr *types.Container, stdin io.Reader, stdout io.Writer, stderr io.Writer, tty bool) error {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), v1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
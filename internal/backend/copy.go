@@ -3,13 +3,11 @@ package backend
 import (
 	"bufio"
 	"bytes"
-	"context"
 	"io"
 	"io/fs"
 	"path"
 	"strings"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/model/types"
@@ -18,7 +16,7 @@ import (
 
 // CopyToContainer will copy given (tar) archive to given path of the container.
 func (in *instance) CopyToContainer(tainr *types.Container, reader io.Reader, target string, compressed bool) error {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
@@ -48,7 +46,7 @@ func (in *instance) CopyToContainer(tainr *types.Container, reader io.Reader, ta
 // contents as a tar archive through the given writer. Note that this requires
 // tar to be present on the container.
 func (in *instance) CopyFromContainer(tainr *types.Container, target string, writer io.Writer) error {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
@@ -68,7 +66,7 @@ func (in *instance) CopyFromContainer(tainr *types.Container, target string, wri
 // GetFileModeInContainer will return the file mode (directory or file) of a given path
 // inside the container.
 func (in *instance) GetFileModeInContainer(tainr *types.Container, target string) (fs.FileMode, error) {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return 0, err
 	}
@@ -98,7 +96,7 @@ func (in *instance) GetFileModeInContainer(tainr *types.Container, target string
 
 // FileExistsInContainer will check if the file exists in the container.
 func (in *instance) FileExistsInContainer(tainr *types.Container, target string) (bool, error) {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return false, err
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog"
@@ -23,10 +24,22 @@ func (in *instance) DeleteAll() error {
 		klog.Errorf("error deleting configmaps: %s", err)
 		ok = false
 	}
+	if err := in.deleteJobs("kubedock=true"); err != nil {
+		klog.Errorf("error deleting jobs: %s", err)
+		ok = false
+	}
 	if err := in.deletePods("kubedock=true"); err != nil {
 		klog.Errorf("error deleting pods: %s", err)
 		ok = false
 	}
+	if err := in.deleteIngresses("kubedock=true"); err != nil {
+		klog.Errorf("error deleting ingresses: %s", err)
+		ok = false
+	}
+	if err := in.deleteNetworkPolicies("kubedock=true"); err != nil {
+		klog.Errorf("error deleting network policies: %s", err)
+		ok = false
+	}
 	if !ok {
 		return fmt.Errorf("failed deleting all containers")
 	}
@@ -44,27 +57,51 @@ func (in *instance) DeleteWithKubedockID(id string) error {
 		klog.Errorf("error deleting configmaps: %s", err)
 		ok = false
 	}
+	if err := in.deleteJobs("kubedock.id=" + id); err != nil {
+		klog.Errorf("error deleting jobs: %s", err)
+		ok = false
+	}
 	if err := in.deletePods("kubedock.id=" + id); err != nil {
 		klog.Errorf("error deleting pods: %s", err)
 		ok = false
 	}
+	if err := in.deleteIngresses("kubedock.id=" + id); err != nil {
+		klog.Errorf("error deleting ingresses: %s", err)
+		ok = false
+	}
+	if err := in.deleteNetworkPolicies("kubedock.id=" + id); err != nil {
+		klog.Errorf("error deleting network policies: %s", err)
+		ok = false
+	}
+	if err := in.deleteLeases("kubedock.id=" + id); err != nil {
+		klog.Errorf("error deleting leases: %s", err)
+		ok = false
+	}
 	if !ok {
 		return fmt.Errorf("failed deleting container %s", id)
 	}
 	return nil
 }
 
-// DeleteContainer will delete given container object in kubernetes.
+// DeleteContainer will delete given container object in kubernetes. The
+// configmaps are owned by the pod (or job) and are removed by kubernetes,
+// configmaps of which the owner could not be set are removed explicitly.
+// Services are owned as well, but are removed explicitly, as the names of
+// these (network aliases) are likely to be reused right away.
 func (in *instance) DeleteContainer(tainr *types.Container) error {
 	ok := true
 	if err := in.deleteServices("kubedock.containerid=" + tainr.ShortID); err != nil {
 		klog.Errorf("error deleting services: %s", err)
 		ok = false
 	}
-	if err := in.deleteConfigMaps("kubedock.containerid=" + tainr.ShortID); err != nil {
+	if err := in.deleteUnownedConfigMaps("kubedock.containerid=" + tainr.ShortID); err != nil {
 		klog.Errorf("error deleting configmaps: %s", err)
 		ok = false
 	}
+	if err := in.deleteJobs("kubedock.containerid=" + tainr.ShortID); err != nil {
+		klog.Errorf("error deleting jobs: %s", err)
+		ok = false
+	}
 	if err := in.deletePods("kubedock.containerid=" + tainr.ShortID); err != nil {
 		klog.Errorf("error deleting pods: %s", err)
 		ok = false
@@ -84,36 +121,17 @@ func (in *instance) DeleteOlderThan(keepmax time.Duration) error {
 	if err := in.DeleteConfigMapsOlderThan(keepmax); err != nil {
 		return err
 	}
-	if err := in.DeletePodsOlderThan(keepmax); err != nil {
-		return err
-	}
 	return in.DeleteServicesOlderThan(keepmax)
 }
 
-// DeleteContainersOlderThan will delete containers than are orchestrated
-// by kubedock and are older than the given keepmax duration.
+// DeleteContainersOlderThan will delete containers (jobs and pods) than are
+// orchestrated by kubedock and are older than the given keepmax duration.
+// The services and configmaps owned by these are removed by kubernetes.
 func (in *instance) DeleteContainersOlderThan(keepmax time.Duration) error {
-	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: "kubedock=true",
-	})
-	if err != nil {
+	if err := in.DeleteJobsOlderThan(keepmax); err != nil {
 		return err
 	}
-	for _, pod := range pods.Items {
-		if in.isOlderThan(pod.ObjectMeta, keepmax) {
-			klog.V(3).Infof("deleting pod: %s", pod.Name)
-			if err := in.deleteServices("kubedock.containerid=" + pod.Name); err != nil {
-				klog.Errorf("error deleting services: %s", err)
-			}
-			if err := in.deleteConfigMaps("kubedock.containerid=" + pod.Name); err != nil {
-				klog.Errorf("error deleting configmaps: %s", err)
-			}
-			if err := in.cli.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{}); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	return in.DeletePodsOlderThan(keepmax)
 }
 
 // DeleteServicesOlderThan will delete services than are orchestrated
@@ -126,7 +144,7 @@ func (in *instance) DeleteServicesOlderThan(keepmax time.Duration) error {
 		return err
 	}
 	for _, svc := range svcs.Items {
-		if in.isOlderThan(svc.ObjectMeta, keepmax) {
+		if in.isOlderThan(svc.ObjectMeta, keepmax) && !isTunnel(svc.ObjectMeta) {
 			klog.V(3).Infof("deleting service: %s", svc.Name)
 			if err := in.cli.CoreV1().Services(svc.Namespace).Delete(context.Background(), svc.Name, metav1.DeleteOptions{}); err != nil {
 				return err
@@ -166,7 +184,7 @@ func (in *instance) DeletePodsOlderThan(keepmax time.Duration) error {
 		return err
 	}
 	for _, pod := range pods.Items {
-		if in.isOlderThan(pod.ObjectMeta, keepmax) {
+		if in.isOlderThan(pod.ObjectMeta, keepmax) && !isTunnel(pod.ObjectMeta) {
 			klog.V(3).Infof("deleting pod: %s", pod.Name)
 			background := metav1.DeletePropagationBackground
 			if err := in.cli.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{
@@ -224,6 +242,27 @@ func (in *instance) deleteConfigMaps(selector string) error {
 	return nil
 }
 
+// deleteUnownedConfigMaps will delete the k8s configmap resources which
+// match the given label selector, and which are not owned by another
+// resource (e.g. because kubedock was not allowed to set the owner).
+func (in *instance) deleteUnownedConfigMaps(selector string) error {
+	cms, err := in.cli.CoreV1().ConfigMaps(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms.Items {
+		if len(cm.OwnerReferences) > 0 {
+			continue
+		}
+		if err := in.cli.CoreV1().ConfigMaps(cm.Namespace).Delete(context.Background(), cm.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 // deletePods will delete k8s pod resources which match the given label
 // selector.
 func (in *instance) deletePods(selector string) error {
@@ -272,3 +311,16 @@ func (in *instance) WatchDeleteContainer(tainr *types.Container) (chan struct{},
 
 	return delch, nil
 }
+
+// ignoreForbidden will return nil if given error, returned when listing
+// resources of given kind, is a forbidden error. Jobs, ingresses, network
+// policies and leases are only created for optional features, and require
+// additional permissions; if kubedock is not allowed to list them, it can't
+// have created any either, and there is nothing to clean up.
+func ignoreForbidden(kind string, err error) error {
+	if errors.IsForbidden(err) {
+		klog.V(3).Infof("not allowed to list %s: %s", kind, err)
+		return nil
+	}
+	return err
+}
@@ -508,3 +508,28 @@ func TestWatchDeleteContainer(t *testing.T) {
 		t.Errorf("expected timeout, but no timeout occurred")
 	}
 }
+
+func TestDeleteContainerUnownedConfigMaps(t *testing.T) {
+	labels := map[string]string{"kubedock.containerid": "tb303"}
+	owned := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:            "owned",
+		Namespace:       "default",
+		Labels:          labels,
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Pod", Name: "tb303"}},
+	}}
+	unowned := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "unowned",
+		Namespace: "default",
+		Labels:    labels,
+	}}
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(owned, unowned)}
+	if err := kub.DeleteContainer(&types.Container{ID: "rc752", ShortID: "tb303"}); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, err := kub.cli.CoreV1().ConfigMaps("default").Get(context.Background(), "unowned", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected configmap without owner to be deleted")
+	}
+	if _, err := kub.cli.CoreV1().ConfigMaps("default").Get(context.Background(), "owned", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected owned configmap to be left for the garbage collector")
+	}
+}
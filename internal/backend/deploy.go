@@ -3,11 +3,12 @@ package backend
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog"
@@ -22,6 +24,7 @@ import (
 	"github.com/joyrex2001/kubedock/internal/config"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/util/exec"
+	"github.com/joyrex2001/kubedock/internal/util/podtemplate"
 	"github.com/joyrex2001/kubedock/internal/util/portforward"
 	"github.com/joyrex2001/kubedock/internal/util/reverseproxy"
 	"github.com/joyrex2001/kubedock/internal/util/tar"
@@ -43,6 +46,39 @@ const (
 	SetupInitContainerName = "setup"
 )
 
+const (
+	// portForwardMinBackoff is the initial delay before a failed
+	// port-forward is reconnected
+	portForwardMinBackoff = time.Second
+	// portForwardMaxBackoff is the maximum delay before a failed
+	// port-forward is reconnected
+	portForwardMaxBackoff = 30 * time.Second
+)
+
+// fatalWaitingReasons are the container waiting reasons that will not
+// resolve without intervention, and should fail the deployment right away.
+var fatalWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// DeployError is the error that is returned when a container can't be
+// started due to a kubernetes condition, e.g. an image that can't be pulled.
+type DeployError struct {
+	// Reason is the kubernetes reason (e.g. ImagePullBackOff)
+	Reason string
+	// Message is the kubernetes message describing the failure
+	Message string
+}
+
+// Error will return the error message of the DeployError.
+func (e *DeployError) Error() string {
+	return fmt.Sprintf("failed to start container; %s: %s", e.Reason, e.Message)
+}
+
 // StartContainer will start given container object in kubernetes and
 // waits until it's started, or failed with an error.
 func (in *instance) StartContainer(tainr *types.Container) (DeployState, error) {
@@ -56,7 +92,9 @@ func (in *instance) StartContainer(tainr *types.Container) (DeployState, error)
 			_ = in.GetLogs(tainr, &logOpts, stop, os.Stderr)
 			close(stop)
 		}
-		_ = in.cli.CoreV1().Pods(in.namespace).Delete(context.Background(), tainr.GetPodName(), metav1.DeleteOptions{})
+		_ = in.deleteWorkload(tainr)
+		// the configmaps might not be owned by the workload yet
+		_ = in.deleteConfigMaps("kubedock.containerid=" + tainr.ShortID)
 	}
 	return state, err
 }
@@ -67,27 +105,31 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 		return DeployFailed, err
 	}
 
-	pod := in.podTemplate.DeepCopy()
+	if _, err := tainr.GetWorkload(); err != nil {
+		return DeployFailed, err
+	}
+
+	tmpl := in.getPodTemplate(tainr)
+	pod := tmpl.Pod.DeepCopy()
 	pod.ObjectMeta.Name = tainr.GetPodName()
 	pod.ObjectMeta.Namespace = in.namespace
 	pod.ObjectMeta.Labels = in.getLabels(pod.ObjectMeta.Labels, tainr)
 	pod.ObjectMeta.Annotations = in.getAnnotations(pod.ObjectMeta.Annotations, tainr)
-
-	if tainr.Hostname == "" {
-		pod.ObjectMeta.Annotations["kubedock.hostalias/0"] = tainr.GetPodName()
-	} else {
-		pod.ObjectMeta.Annotations["kubedock.hostalias/0"] = tainr.Hostname
+	if tmpl.Name != "" {
+		pod.ObjectMeta.Annotations["kubedock.podtemplate"] = tmpl.Name
+	}
+	if in.kuburl != "" {
+		pod.ObjectMeta.Annotations[AnnotationURL] = in.kuburl
 	}
-	for i, hostname := range tainr.NetworkAliases {
-		pod.ObjectMeta.Annotations[fmt.Sprintf("kubedock.hostalias/%d", i+1)] = hostname
+
+	for k, v := range getNetworkAnnotations(tainr) {
+		pod.ObjectMeta.Annotations[k] = v
 	}
-	inetwork := 0
-	for network := range tainr.Networks {
-		pod.ObjectMeta.Annotations[fmt.Sprintf("kubedock.network/%d", inetwork)] = network
-		inetwork++
+	for k, v := range getNetworkLabels(tainr) {
+		pod.ObjectMeta.Labels[k] = v
 	}
 
-	container := in.containerTemplate
+	container := tmpl.Container
 	container.Image = tainr.Image
 	container.Name = "main"
 	container.Command = tainr.Entrypoint
@@ -110,12 +152,50 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 	}
 	pod.Spec.NodeSelector = nodeSel
 
-	pod.Spec.Containers = []corev1.Container{container}
+	tols, err := tainr.GetTolerations(pod.Spec.Tolerations)
+	if err != nil {
+		return DeployFailed, err
+	}
+	pod.Spec.Tolerations = tols
+
+	affinity, err := tainr.GetAffinity(pod.Spec.Affinity)
+	if err != nil {
+		return DeployFailed, err
+	}
+	pod.Spec.Affinity = affinity
+
+	tscs, err := tainr.GetTopologySpreadConstraints(pod.Spec.TopologySpreadConstraints, map[string]string{"kubedock.id": config.InstanceID})
+	if err != nil {
+		return DeployFailed, err
+	}
+	pod.Spec.TopologySpreadConstraints = tscs
+
+	pod.Spec.PriorityClassName = tainr.GetPriorityClassName(pod.Spec.PriorityClassName)
+	pod.Spec.RuntimeClassName = tainr.GetRuntimeClassName(pod.Spec.RuntimeClassName)
+
+	// the first container of the template is used as the template for the
+	// main container, any other containers are kept as sidecars
+	sidecars := []corev1.Container{}
+	if len(pod.Spec.Containers) > 1 {
+		sidecars = pod.Spec.Containers[1:]
+	}
+	pod.Spec.Containers = append([]corev1.Container{container}, sidecars...)
 
 	if tainr.Hostname != "" {
 		pod.Spec.Hostname = tainr.Hostname
 	}
+	if aliases := in.getHostAliases(tainr); len(aliases) > 0 {
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, aliases...)
+	}
+	nwaliases, err := in.getNetworkHostAliases(tainr)
+	if err != nil {
+		return DeployFailed, err
+	}
+	pod.Spec.HostAliases = append(pod.Spec.HostAliases, nwaliases...)
 	pod.Spec.ServiceAccountName = tainr.GetServiceAccountName(pod.Spec.ServiceAccountName)
+	if in.dnsServer != "" {
+		in.setDNSConfig(pod)
+	}
 	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
 
 	ads, err := tainr.GetActiveDeadlineSeconds()
@@ -154,13 +234,35 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 		}
 	}
 
+	if in.podPatch != "" {
+		pod, err = in.patchPod(pod, in.podPatch, true)
+		if err != nil {
+			return DeployFailed, err
+		}
+	}
+
+	if patch, ok := tainr.Labels[types.LabelPodPatch]; ok && patch != "" {
+		pod, err = in.patchPod(pod, patch, false)
+		if err != nil {
+			return DeployFailed, err
+		}
+	}
+
 	duplicateRequest := false
-	if _, err := in.cli.CoreV1().Pods(in.namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+	if err := in.createWorkload(tainr, pod); err != nil && !errors.IsAlreadyExists(err) {
 		return DeployFailed, err
 	} else if errors.IsAlreadyExists(err) {
 		duplicateRequest = true
 	}
 
+	owner, err := in.getOwnerReference(tainr)
+	if err != nil {
+		return DeployFailed, err
+	}
+	if err := in.setConfigMapsOwner(tainr, owner); err != nil {
+		return DeployFailed, err
+	}
+
 	if tainr.HasVolumes() || tainr.HasPreArchives() {
 		if err := in.copyVolumeFolders(tainr, in.timeOut); err != nil {
 			return DeployFailed, err
@@ -175,11 +277,14 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 	if err := in.MapContainerTCPPorts(tainr); err != nil {
 		return DeployFailed, err
 	}
+	if err := in.MapContainerUDPPorts(tainr); err != nil {
+		return DeployFailed, err
+	}
 
 	// Since service names are not necessary unique and can collide between different containers, we should be smart
 	// on it's idempotency, so we only drop errors due to already existing kubernetes objects
 	// when we detect duplicate requests.
-	if err := in.createServices(tainr); err != nil && !(duplicateRequest && errors.IsAlreadyExists(err)) {
+	if err := in.createServices(tainr, owner); err != nil && !(duplicateRequest && errors.IsAlreadyExists(err)) {
 		return state, err
 	}
 
@@ -192,6 +297,55 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 	return state, nil
 }
 
+// getPodTemplate will return the pod template that should be used for given
+// container. If none of the templates with match rules match the container,
+// the default template is returned.
+func (in *instance) getPodTemplate(tainr *types.Container) *podtemplate.Template {
+	if tmpl := podtemplate.Select(in.podTemplates, tainr.Image, tainr.Labels); tmpl != nil {
+		klog.V(3).Infof("using podtemplate %s for container %s", tmpl.Name, tainr.ShortID)
+		return tmpl
+	}
+	return &podtemplate.Template{Name: in.podTemplateName, Pod: in.podTemplate, Container: in.containerTemplate}
+}
+
+// patchPod will apply given patch to the pod. The patch is either provided
+// inline, or as a reference to a configmap (configmap:name/key) in the
+// kubedock namespace. References to a local file (file:path) are only
+// allowed if allowFile is set, which is the case for the patch configured
+// by the operator, but not for patches requested via container labels.
+func (in *instance) patchPod(pod *corev1.Pod, patch string, allowFile bool) (*corev1.Pod, error) {
+	var dat []byte
+	switch {
+	case strings.HasPrefix(patch, "configmap:"):
+		name, key, ok := strings.Cut(strings.TrimPrefix(patch, "configmap:"), "/")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid pod patch reference %s, expected configmap:name/key", patch)
+		}
+		cm, err := in.cli.CoreV1().ConfigMaps(in.namespace).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed reading pod patch %s: %w", patch, err)
+		}
+		val, ok := cm.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("failed reading pod patch %s: key %s not found", patch, key)
+		}
+		dat = []byte(val)
+	case strings.HasPrefix(patch, "file:"):
+		if !allowFile {
+			return nil, fmt.Errorf("invalid pod patch %s, file references are only allowed in --pod-patch", patch)
+		}
+		d, err := in.readFile(strings.TrimPrefix(patch, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed reading pod patch %s: %w", patch, err)
+		}
+		dat = d
+	default:
+		dat = []byte(patch)
+	}
+	klog.V(3).Infof("patching pod %s", pod.Name)
+	return podtemplate.Patch(pod, dat, "main")
+}
+
 // CreatePortForwards sets up port-forwards for all available ports that
 // are configured in the container.
 func (in *instance) CreatePortForwards(tainr *types.Container) {
@@ -201,11 +355,33 @@ func (in *instance) CreatePortForwards(tainr *types.Container) {
 	if err := in.portForward(tainr, tainr.MappedPorts); err != nil {
 		klog.Errorf("port-forward failed: %s", err)
 	}
+	if len(tainr.UDPHostPorts) > 0 || len(tainr.UDPMappedPorts) > 0 {
+		in.udpForward(tainr)
+	}
+}
+
+// udpForward will relay the udp ports of given container directly to the
+// pod ip, as kubernetes port-forwards only support tcp. This requires the
+// pod network to be reachable from kubedock, hence the udp ports are not
+// relayed (nor published) if kubedock runs outside the cluster.
+func (in *instance) udpForward(tainr *types.Container) {
+	if !config.InCluster() {
+		klog.Errorf("not relaying udp ports of container %s, port-forward does not support udp, and the pod ip is not reachable from outside the cluster", tainr.ShortID)
+		return
+	}
+	ip, err := in.GetPodIP(tainr)
+	if err != nil {
+		klog.Errorf("udp relay failed: %s", err)
+		return
+	}
+	klog.Warningf("port-forward does not support udp, relaying udp ports directly to pod ip %s", ip)
+	in.udpReverseProxy(tainr, ip, tainr.UDPHostPorts)
+	in.udpReverseProxy(tainr, ip, tainr.UDPMappedPorts)
 }
 
 // portForward will create port-forwards for all mapped ports.
 func (in *instance) portForward(tainr *types.Container, ports map[int]int) error {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
@@ -213,23 +389,99 @@ func (in *instance) portForward(tainr *types.Container, ports map[int]int) error
 		if src < 0 {
 			continue
 		}
+		ip := in.getListenIP(tainr, src, dst, "tcp", "")
+		if ip != "" {
+			tainr.SetListenIP(src, "tcp", ip)
+		}
 		stop := make(chan struct{}, 1)
 		tainr.AddStopChannel(stop)
-		go func(src, dst int) {
-			err := portforward.ToPod(portforward.Request{
-				RestConfig: in.cfg,
-				Pod:        *pod,
-				LocalPort:  src,
-				PodPort:    dst,
-				StopCh:     stop,
-				ReadyCh:    make(chan struct{}, 1),
-			})
+		getPod := func() (*corev1.Pod, error) { return in.getPod(tainr) }
+		go in.supervisePortForward("container "+tainr.ShortID, pod, getPod, ip, src, dst, stop)
+	}
+	return nil
+}
+
+// supervisePortForward will keep the port-forward of given local ip and
+// port to given pod port running, until the stop channel is signalled. If the
+// port-forward fails, e.g. because the connection to the api server was
+// lost, it is reconnected on the same local port with an exponential
+// backoff, for as long as the pod is running. The pod is fetched again with
+// the given function before reconnecting, and the given name is used to
+// describe the port-forward in the logs.
+func (in *instance) supervisePortForward(name string, pod *corev1.Pod, getPod func() (*corev1.Pod, error), ip string, src, dst int, stop <-chan struct{}) {
+	delay := portForwardMinBackoff
+	for {
+		ready := make(chan struct{}, 1)
+		err := portforward.ToPod(portforward.Request{
+			RestConfig: in.cfg,
+			Pod:        *pod,
+			LocalIP:    ip,
+			LocalPort:  src,
+			PodPort:    dst,
+			StopCh:     stop,
+			ReadyCh:    ready,
+		})
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		select {
+		case <-ready:
+			delay = portForwardMinBackoff
+		default:
+		}
+		if err == nil {
+			err = fmt.Errorf("port-forward closed")
+		}
+		klog.Warningf("port-forward %d->%d of %s failed: %s, reconnecting in %s", src, dst, name, err, delay)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > portForwardMaxBackoff {
+				delay = portForwardMaxBackoff
+			}
+			p, err := getPod()
+			if errors.IsNotFound(err) {
+				klog.Infof("stopped port-forward %d->%d, pod of %s is gone", src, dst, name)
+				return
+			}
 			if err != nil {
-				klog.Errorf("port-forward failed: %s", err)
+				klog.Warningf("port-forward %d->%d of %s can't get pod: %s, retrying in %s", src, dst, name, err, delay)
+				continue
 			}
-		}(src, dst)
+			if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				klog.Infof("stopped port-forward %d->%d, %s is not running anymore", src, dst, name)
+				return
+			}
+			if p.Status.Phase != corev1.PodRunning {
+				klog.V(3).Infof("port-forward %d->%d of %s waiting for pod to run, retrying in %s", src, dst, name, delay)
+				continue
+			}
+			pod = p
+			break
+		}
+		klog.Infof("reconnecting port-forward %d->%d of %s", src, dst, name)
 	}
-	return nil
+}
+
+// DialContainer will open a connection to given port of given container
+// via the port-forward api.
+func (in *instance) DialContainer(tainr *types.Container, port int) (net.Conn, error) {
+	pod, err := in.getPod(tainr)
+	if err != nil {
+		return nil, err
+	}
+	return portforward.Dial(portforward.Request{
+		RestConfig: in.cfg,
+		Pod:        *pod,
+		PodPort:    port,
+	})
 }
 
 // CreateReverseProxies sets up reverse-proxies for all fixed ports that
@@ -237,6 +489,33 @@ func (in *instance) portForward(tainr *types.Container, ports map[int]int) error
 func (in *instance) CreateReverseProxies(tainr *types.Container) {
 	in.reverseProxy(tainr, tainr.HostPorts)
 	in.reverseProxy(tainr, tainr.MappedPorts)
+	in.udpReverseProxy(tainr, tainr.HostIP, tainr.UDPHostPorts)
+	in.udpReverseProxy(tainr, tainr.HostIP, tainr.UDPMappedPorts)
+}
+
+// udpReverseProxy will create udp relays to given ip of given container for
+// given ports.
+func (in *instance) udpReverseProxy(tainr *types.Container, ip string, ports map[int]int) {
+	for src, dst := range ports {
+		if src < 0 {
+			continue
+		}
+		klog.Infof("udp relay for %d to %d", src, dst)
+		lip := in.getListenIP(tainr, src, dst, "udp", "0.0.0.0")
+		tainr.SetListenIP(src, "udp", lip)
+		stop := make(chan struct{}, 1)
+		tainr.AddStopChannel(stop)
+		err := reverseproxy.ProxyUDP(reverseproxy.Request{
+			LocalIP:    lip,
+			LocalPort:  src,
+			RemotePort: dst,
+			RemoteIP:   ip,
+			StopCh:     stop,
+		})
+		if err != nil {
+			klog.Errorf("error setting up udp relay for %d to %d: %s", src, dst, err)
+		}
+	}
 }
 
 // reverseProxy will create reverse proxies to given container for
@@ -247,6 +526,8 @@ func (in *instance) reverseProxy(tainr *types.Container, ports map[int]int) {
 		if src < 0 {
 			continue
 		}
+		ip := in.getListenIP(tainr, src, dst, "tcp", "0.0.0.0")
+		tainr.SetListenIP(src, "tcp", ip)
 		wg.Add(1)
 		go func(src, dst int) {
 			defer wg.Done()
@@ -254,6 +535,7 @@ func (in *instance) reverseProxy(tainr *types.Container, ports map[int]int) {
 			stop := make(chan struct{}, 1)
 			tainr.AddStopChannel(stop)
 			err := reverseproxy.Proxy(reverseproxy.Request{
+				LocalIP:    ip,
 				LocalPort:  src,
 				RemotePort: dst,
 				RemoteIP:   tainr.HostIP,
@@ -268,9 +550,24 @@ func (in *instance) reverseProxy(tainr *types.Container, ports map[int]int) {
 	wg.Wait()
 }
 
+// getListenIP will return the ip on which the port-forward or reverse-proxy
+// of given host port to given container port should listen. This is the
+// host ip that was requested in the port binding, or the configured
+// default, or the given fallback if neither is set. An empty fallback lets
+// port-forwards listen on localhost, which includes both ipv4 and ipv6.
+func (in *instance) getListenIP(tainr *types.Container, src, dst int, proto, fallback string) string {
+	if ip := tainr.GetBindIP(src, dst, proto); ip != "" {
+		return ip
+	}
+	if in.proxyBindIP != "" {
+		return in.proxyBindIP
+	}
+	return fallback
+}
+
 // GetPodIP will return the ip of the given container.
 func (in *instance) GetPodIP(tainr *types.Container) (string, error) {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return "", err
 	}
@@ -279,8 +576,49 @@ func (in *instance) GetPodIP(tainr *types.Container) (string, error) {
 
 // createServices will create k8s service objects for each provided
 // external name, mapped with provided hostports ports.
-func (in *instance) createServices(tainr *types.Container) error {
+func (in *instance) createServices(tainr *types.Container, owner metav1.OwnerReference) error {
 	for _, svc := range in.getServices(tainr) {
+		svc.ObjectMeta.OwnerReferences = []metav1.OwnerReference{owner}
+		if _, err := in.cli.CoreV1().Services(in.namespace).Create(context.Background(), &svc, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateServices will reconcile the k8s service objects of given running
+// container with its current network aliases; services of aliases that are
+// no longer present are deleted, and services for new aliases are created.
+func (in *instance) updateServices(tainr *types.Container) error {
+	current, err := in.cli.CoreV1().Services(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.containerid=" + tainr.ShortID + ",!" + LabelExpose,
+	})
+	if err != nil {
+		return err
+	}
+	svcs := map[string]corev1.Service{}
+	for _, svc := range in.getServices(tainr) {
+		svcs[svc.Name] = svc
+	}
+	for _, svc := range current.Items {
+		if _, ok := svcs[svc.Name]; ok {
+			delete(svcs, svc.Name)
+			continue
+		}
+		klog.V(4).Infof("Deleting service %s", svc.Name)
+		if err := in.cli.CoreV1().Services(svc.Namespace).Delete(context.Background(), svc.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	if len(svcs) == 0 {
+		return nil
+	}
+	owner, err := in.getOwnerReference(tainr)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs {
+		svc.ObjectMeta.OwnerReferences = []metav1.OwnerReference{owner}
 		if _, err := in.cli.CoreV1().Services(in.namespace).Create(context.Background(), &svc, metav1.CreateOptions{}); err != nil {
 			return err
 		}
@@ -296,35 +634,28 @@ func (in *instance) getServices(tainr *types.Container) []corev1.Service {
 		return svcs
 	}
 	ports := tainr.GetServicePorts()
-	if len(ports) == 0 {
+	udpPorts := tainr.GetServiceUDPPorts()
+	if len(ports) == 0 && len(udpPorts) == 0 {
 		// no ports available, can't create a service without ports
 		if len(tainr.NetworkAliases) > 0 {
 			klog.Infof("ignoring network aliases %v, no ports mapped", tainr.NetworkAliases)
 		}
 		return svcs
 	}
-	valid := regexp.MustCompile("^[a-z]([-a-z0-9]*[a-z0-9])?$")
-
-	// gather all aliases, ignore duplicates, convert to lower case
-	aliases := make(map[string]bool)
-	if tainr.Hostname != "" {
-		aliases[strings.ToLower(tainr.Hostname)] = true
-	}
-	for _, alias := range tainr.NetworkAliases {
-		aliases[strings.ToLower(alias)] = true
-	}
-	for alias := range aliases {
-		if ok := valid.MatchString(alias); !ok {
-			klog.Infof("ignoring network alias %s, invalid name", alias)
-			continue
+	for _, sa := range in.getServiceAliases(tainr) {
+		klog.V(4).Infof("Creating service %s", sa.name)
+		labels := in.getLabels(nil, tainr)
+		annotations := in.getAnnotations(nil, tainr)
+		if sa.network != "" {
+			labels[getNetworkLabel(sa.network)] = "true"
+			annotations[AnnotationAlias] = sa.alias
 		}
-		klog.V(4).Infof("Creating service %s", alias)
 		svc := corev1.Service{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace:   in.namespace,
-				Name:        alias,
-				Labels:      in.getLabels(nil, tainr),
-				Annotations: in.getAnnotations(nil, tainr),
+				Name:        sa.name,
+				Labels:      labels,
+				Annotations: annotations,
 			},
 			Spec: corev1.ServiceSpec{
 				Selector: in.getPodMatchLabels(tainr),
@@ -339,6 +670,14 @@ func (in *instance) getServices(tainr *types.Container) []corev1.Service {
 				TargetPort: intstr.IntOrString{IntVal: int32(dst)},
 			})
 		}
+		for src, dst := range udpPorts {
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+				Name:       fmt.Sprintf("udp-%d-%d", src, dst),
+				Protocol:   corev1.ProtocolUDP,
+				Port:       int32(src),
+				TargetPort: intstr.IntOrString{IntVal: int32(dst)},
+			})
+		}
 		svcs = append(svcs, svc)
 	}
 	return svcs
@@ -352,12 +691,17 @@ func (in *instance) getContainerPorts(tainr *types.Container) []corev1.Container
 		n := fmt.Sprintf("kd-tcp-%d", pp)
 		res = append(res, corev1.ContainerPort{ContainerPort: int32(pp), Name: n, Protocol: corev1.ProtocolTCP})
 	}
+	for _, pp := range tainr.GetContainerUDPPorts() {
+		n := fmt.Sprintf("kd-udp-%d", pp)
+		res = append(res, corev1.ContainerPort{ContainerPort: int32(pp), Name: n, Protocol: corev1.ProtocolUDP})
+	}
 	return res
 }
 
 // getLabels will return a map of labels to be added to the container. This
-// map contains the labels that link to the container definition, as well
-// as additional labels which are used internally by kubedock.
+// map contains the labels that link to the container definition, the labels
+// explicitly requested via the pod-label prefix, as well as additional labels
+// which are used internally by kubedock.
 func (in *instance) getLabels(labels map[string]string, tainr *types.Container) map[string]string {
 	if labels == nil {
 		labels = map[string]string{}
@@ -366,17 +710,13 @@ func (in *instance) getLabels(labels map[string]string, tainr *types.Container)
 		labels[k] = v
 	}
 	for k, v := range tainr.Labels {
-		kk := in.toKubernetesKey(k)
-		kv := in.toKubernetesValue(v)
-		if kk == "" && k != "" {
-			klog.V(3).Infof("not adding `%s` as a label: incompatible key", k)
-			continue
-		}
-		if kv == "" && v != "" {
-			klog.V(3).Infof("not adding `%s` with value `%s` as a label: incompatible value", k, v)
+		if strings.HasPrefix(k, types.LabelPodLabelPrefix) || strings.HasPrefix(k, types.LabelPodAnnotationPrefix) {
 			continue
 		}
-		labels[kk] = kv
+		in.addLabel(labels, k, v)
+	}
+	for k, v := range tainr.GetPodLabels() {
+		in.addLabel(labels, k, v)
 	}
 	for k, v := range config.SystemLabels {
 		labels[k] = v
@@ -387,7 +727,9 @@ func (in *instance) getLabels(labels map[string]string, tainr *types.Container)
 
 // getAnnotations will return a map of annotations to be added to the
 // container. This map contains the labels as specified in the container
-// definition.
+// definition, and the annotations requested via the pod-annotation prefix.
+// Annotation values are not restricted like label values, and are copied
+// as-is.
 func (in *instance) getAnnotations(annotations map[string]string, tainr *types.Container) map[string]string {
 	if annotations == nil {
 		annotations = map[string]string{}
@@ -398,10 +740,35 @@ func (in *instance) getAnnotations(annotations map[string]string, tainr *types.C
 	for k, v := range tainr.Labels {
 		annotations[k] = v
 	}
+	for k, v := range tainr.GetPodAnnotations() {
+		kk := in.toKubernetesKey(k)
+		if kk == "" {
+			klog.V(3).Infof("not adding `%s` as an annotation: incompatible key", k)
+			continue
+		}
+		annotations[kk] = v
+	}
 	annotations["kubedock.containername"] = tainr.Name
 	return annotations
 }
 
+// addLabel will add given key and value to the map of labels, after making
+// them compatible with kubernetes. If this is not possible, the label will
+// be ignored.
+func (in *instance) addLabel(labels map[string]string, k, v string) {
+	kk := in.toKubernetesKey(k)
+	kv := in.toKubernetesValue(v)
+	if kk == "" && k != "" {
+		klog.V(3).Infof("not adding `%s` as a label: incompatible key", k)
+		return
+	}
+	if kv == "" && v != "" {
+		klog.V(3).Infof("not adding `%s` with value `%s` as a label: incompatible value", k, v)
+		return
+	}
+	labels[kk] = kv
+}
+
 // getPodMatchLabels will return the map of labels that can be used to
 // match running pods for this container.
 func (in *instance) getPodMatchLabels(tainr *types.Container) map[string]string {
@@ -424,10 +791,18 @@ func (in *instance) waitReadyState(tainr *types.Container, wait int) (DeployStat
 
 // GetContainerStatus will return the state of the deployed container.
 func (in *instance) GetContainerStatus(tainr *types.Container) (DeployState, error) {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
+	if err != nil && errors.IsNotFound(err) && tainr.IsJob() {
+		return in.getJobStatus(tainr)
+	}
 	if err != nil {
 		return DeployFailed, err
 	}
+	return in.getPodStatus(pod)
+}
+
+// getPodStatus will return the state of the main container in given pod.
+func (in *instance) getPodStatus(pod *corev1.Pod) (DeployState, error) {
 	for _, status := range pod.Status.ContainerStatuses {
 		if status.Name != "main" {
 			continue
@@ -443,30 +818,56 @@ func (in *instance) GetContainerStatus(tainr *types.Container) (DeployState, err
 		if status.RestartCount > 0 {
 			return DeployFailed, fmt.Errorf("failed to start container")
 		}
-		if status.State.Waiting != nil && status.State.Waiting.Reason == "ImagePullBackOff" {
-			return DeployFailed, fmt.Errorf("failed to start container; error pulling image")
-		}
 		if status.State.Running != nil {
 			return DeployRunning, nil
 		}
 	}
+	if err := in.getDeployError(pod); err != nil {
+		return DeployFailed, err
+	}
 	if pod.Status.Phase == corev1.PodFailed {
 		return DeployFailed, fmt.Errorf("failed to start container")
 	}
 	return DeployPending, nil
 }
 
+// getDeployError will return a DeployError if given pod can't be started
+// due to a condition that will not resolve by itself, e.g. an image that
+// can't be pulled, or a pod that can't be scheduled.
+func (in *instance) getDeployError(pod *corev1.Pod) error {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return &DeployError{Reason: cond.Reason, Message: cond.Message}
+		}
+	}
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if wait := status.State.Waiting; wait != nil && fatalWaitingReasons[wait.Reason] {
+			return &DeployError{Reason: wait.Reason, Message: fmt.Sprintf("container %s: %s", status.Name, wait.Message)}
+		}
+	}
+	return nil
+}
+
 // waitInitContainerRunning will wait for a specific container in the
 // deployment to be ready.
 func (in *instance) waitInitContainerRunning(tainr *types.Container, name string, wait int) error {
 	for max := 0; max < wait; max++ {
-		pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+		pod, err := in.getPod(tainr)
+		if err != nil && errors.IsNotFound(err) && tainr.IsJob() {
+			time.Sleep(time.Second)
+			continue
+		}
 		if err != nil {
 			return err
 		}
 		if pod.Status.Phase == corev1.PodFailed {
 			return fmt.Errorf("failed to start container")
 		}
+		if err := in.getDeployError(pod); err != nil {
+			return err
+		}
 		for _, status := range pod.Status.InitContainerStatuses {
 			if status.Name != name {
 				continue
@@ -490,7 +891,7 @@ func (in *instance) createSetupInitContainer(tainr *types.Container) (*corev1.Co
 	if err != nil {
 		return nil, err
 	}
-	container := in.containerTemplate
+	container := in.getPodTemplate(tainr).Container
 	container.Name = SetupInitContainerName
 	container.Image = in.initImage
 	container.ImagePullPolicy = pulpol
@@ -503,6 +904,30 @@ func (in *instance) createSetupInitContainer(tainr *types.Container) (*corev1.Co
 	return &container, nil
 }
 
+// setInitContainer will add given init container to the pod. If an init
+// container with the same name already exists, it will be replaced, any
+// other init containers (e.g. from the pod template) are preserved.
+func (in *instance) setInitContainer(pod *corev1.Pod, container *corev1.Container) {
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == container.Name {
+			pod.Spec.InitContainers[i] = *container
+			return
+		}
+	}
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, *container)
+}
+
+// getMainContainer will return a reference to the "main" container in the
+// given pod. If not present, it will return the first container instead.
+func (in *instance) getMainContainer(pod *corev1.Pod) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == "main" {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return &pod.Spec.Containers[0]
+}
+
 // addSetupInitContainer returns the setup init container if it already exists
 // or creates it otherwise.
 func (in *instance) addSetupInitContainer(tainr *types.Container, pod *corev1.Pod) (*corev1.Container, error) {
@@ -560,9 +985,10 @@ func (in *instance) addVolumes(tainr *types.Container, pod *corev1.Pod) error {
 	}
 
 	initContainer.VolumeMounts = append(initContainer.VolumeMounts, mounts...)
-	pod.Spec.InitContainers = []corev1.Container{*initContainer}
+	in.setInitContainer(pod, initContainer)
 	pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
-	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, mounts...)
+	main := in.getMainContainer(pod)
+	main.VolumeMounts = append(main.VolumeMounts, mounts...)
 
 	return nil
 }
@@ -614,9 +1040,10 @@ func (in *instance) addPreArchives(tainr *types.Container, pod *corev1.Pod) erro
 	}
 
 	initContainer.VolumeMounts = append(initContainer.VolumeMounts, mounts...)
-	pod.Spec.InitContainers = []corev1.Container{*initContainer}
+	in.setInitContainer(pod, initContainer)
 	pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
-	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, mounts...)
+	main := in.getMainContainer(pod)
+	main.VolumeMounts = append(main.VolumeMounts, mounts...)
 
 	return nil
 }
@@ -629,7 +1056,7 @@ func (in *instance) addDindSidecar(tainr *types.Container, pod *corev1.Pod) erro
 		return err
 	}
 
-	container := in.containerTemplate
+	container := in.getPodTemplate(tainr).Container
 	container.Name = "dind-sidecar"
 	container.Image = in.dindImage
 	container.ImagePullPolicy = pulpol
@@ -647,7 +1074,8 @@ func (in *instance) addDindSidecar(tainr *types.Container, pod *corev1.Pod) erro
 		MountPath: "/var/run",
 	}
 	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, mount)
-	pod.Spec.Containers[1].VolumeMounts = append(pod.Spec.Containers[1].VolumeMounts, mount)
+	main := in.getMainContainer(pod)
+	main.VolumeMounts = append(main.VolumeMounts, mount)
 
 	return nil
 }
@@ -731,6 +1159,56 @@ func (in *instance) createConfigMapFromRaw(tainr *types.Container, files map[str
 	return in.cli.CoreV1().ConfigMaps(in.namespace).Create(context.Background(), &cm, metav1.CreateOptions{})
 }
 
+// getOwnerReference will return an owner reference to the workload (pod or
+// job) of given container, which can be added to the auxiliary resources so
+// kubernetes will clean these up when the workload is removed.
+func (in *instance) getOwnerReference(tainr *types.Container) (metav1.OwnerReference, error) {
+	if tainr.IsJob() {
+		job, err := in.cli.BatchV1().Jobs(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+		if err != nil {
+			return metav1.OwnerReference{}, err
+		}
+		return metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: job.Name, UID: job.UID}, nil
+	}
+	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	if err != nil {
+		return metav1.OwnerReference{}, err
+	}
+	return metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: pod.Name, UID: pod.UID}, nil
+}
+
+// setConfigMapsOwner will add given owner reference to the configmaps that
+// were created for given container. The configmaps are created before the
+// workload, hence the owner is added afterwards. If kubedock is not allowed
+// to patch configmaps, they will be cleaned up by kubedock instead.
+func (in *instance) setConfigMapsOwner(tainr *types.Container, owner metav1.OwnerReference) error {
+	cms, err := in.cli.CoreV1().ConfigMaps(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.containerid=" + tainr.ShortID,
+	})
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{owner},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms.Items {
+		_, err := in.cli.CoreV1().ConfigMaps(cm.Namespace).Patch(context.Background(), cm.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+		if errors.IsForbidden(err) {
+			klog.Warningf("not allowed to set owner of configmap %s: %s", cm.Name, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // copyVolumeFolders will copy the configured volumes of the container to
 // the running init container, and signal the init container when finished
 // with copying.
@@ -739,7 +1217,7 @@ func (in *instance) copyVolumeFolders(tainr *types.Container, wait int) error {
 		return err
 	}
 
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
@@ -785,7 +1263,7 @@ func (in *instance) fileID(file string) string {
 // touchFileInContainer will touch a file in given container to signal
 // processes running in the container.
 func (in *instance) touchFileInContainer(tainr *types.Container, container, filename string) error {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
@@ -6,15 +6,19 @@ import (
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
 
 	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/util/podtemplate"
 )
 
 var tarSingle = []byte{
@@ -359,6 +363,181 @@ func TestStartContainerAddsActiveDeadlineSeconds(t *testing.T) {
 	}
 }
 
+func TestStartContainerPodPatch(t *testing.T) {
+	pt := &corev1.Pod{Status: corev1.PodStatus{
+		ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "main", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+		},
+	}}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "patches", Namespace: "default"},
+		Data:       map[string]string{"hostnet": "spec:\n  hostNetwork: true\n"},
+	}
+	tests := []struct {
+		patch   string
+		hostnet bool
+		err     bool
+	}{
+		{patch: `{"spec":{"hostNetwork":true}}`, hostnet: true},
+		{patch: `configmap:patches/hostnet`, hostnet: true},
+		{patch: `configmap:patches/notfound`, err: true},
+		{patch: `configmap:patches`, err: true},
+		{patch: `file:notfound.yaml`, err: true},
+		{patch: `file:/etc/hostname`, err: true},
+		{patch: `{"spec":{"hostNetwork":"yes"}}`, err: true},
+	}
+	for i, tst := range tests {
+		kub := &instance{
+			namespace:   "default",
+			cli:         fake.NewSimpleClientset(cm),
+			podTemplate: pt,
+			timeOut:     10,
+		}
+		in := &types.Container{ID: "rc752", ShortID: "tb303", Name: "f1spirit", Labels: map[string]string{
+			"com.joyrex2001.kubedock.pod-patch": tst.patch,
+		}}
+		_, err := kub.StartContainer(in)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		if tst.err {
+			continue
+		}
+		pod, err := kub.cli.CoreV1().Pods("default").Get(context.Background(), "kubedock-f1spirit-tb303", metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		if pod.Spec.HostNetwork != tst.hostnet {
+			t.Errorf("failed test %d - expected hostNetwork %t, but got %t", i, tst.hostnet, pod.Spec.HostNetwork)
+		}
+	}
+}
+
+func TestGetPodTemplate(t *testing.T) {
+	tmpls, err := podtemplate.TemplatesFromPath("../util/podtemplate/test/templates/10-elastic.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	kub := &instance{
+		podTemplate:     &corev1.Pod{},
+		podTemplateName: "default.yaml",
+		podTemplates:    tmpls,
+	}
+	tests := []struct {
+		in   *types.Container
+		name string
+	}{
+		{in: &types.Container{Image: "docker.elastic.co/elasticsearch/elasticsearch:8.12.0"}, name: "10-elastic.yaml"},
+		{in: &types.Container{Image: "busybox"}, name: "default.yaml"},
+	}
+	for i, tst := range tests {
+		tmpl := kub.getPodTemplate(tst.in)
+		if tmpl.Name != tst.name {
+			t.Errorf("failed test %d - expected template %s, but got %s", i, tst.name, tmpl.Name)
+		}
+	}
+}
+
+func TestStartContainerTemplateContainers(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	pt := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "wait-for-mesh", Image: "busybox"},
+				{Name: "log-shipper", Image: "fluentbit", RestartPolicy: &always},
+			},
+			Containers: []corev1.Container{
+				{Name: "template"},
+				{Name: "proxy", Image: "envoy"},
+			},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "proxy", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "main", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+			},
+		},
+	}
+	kub := &instance{
+		namespace:   "default",
+		cli:         fake.NewSimpleClientset(),
+		podTemplate: pt,
+		timeOut:     10,
+	}
+	in := &types.Container{ID: "rc752", ShortID: "tb303", Name: "f1spirit", Image: "alpine"}
+	state, err := kub.StartContainer(in)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if state != DeployCompleted {
+		t.Errorf("expected state to be determined by main container, but got %d", state)
+	}
+	pod, err := kub.cli.CoreV1().Pods("default").Get(context.Background(), "kubedock-f1spirit-tb303", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	names := []string{}
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"main", "proxy"}) {
+		t.Errorf("expected main container and proxy sidecar, but got %v", names)
+	}
+	if len(pod.Spec.InitContainers) != 2 {
+		t.Errorf("expected init containers of template to be preserved, but got %v", pod.Spec.InitContainers)
+	}
+}
+
+func TestStartContainerOwnerReferences(t *testing.T) {
+	pt := &corev1.Pod{Status: corev1.PodStatus{
+		ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		},
+	}}
+	kub := &instance{
+		namespace:   "default",
+		cli:         fake.NewSimpleClientset(),
+		podTemplate: pt,
+		timeOut:     10,
+	}
+	in := &types.Container{ID: "rc752", ShortID: "tb303", Name: "f1spirit", NetworkAliases: []string{"tr909"}, ExposedPorts: map[string]interface{}{"909/tcp": 1}}
+	if _, err := kub.StartContainer(in); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	svc, err := kub.cli.CoreV1().Services("default").Get(context.Background(), "tr909", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	exp := []metav1.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "kubedock-f1spirit-tb303"}}
+	if !reflect.DeepEqual(svc.OwnerReferences, exp) {
+		t.Errorf("expected owner references %v, but got %v", exp, svc.OwnerReferences)
+	}
+}
+
+func TestSetConfigMapsOwner(t *testing.T) {
+	kub := &instance{
+		namespace: "default",
+		cli: fake.NewSimpleClientset(
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "tb303-vf", Namespace: "default", Labels: map[string]string{"kubedock.containerid": "tb303"}}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "tr808-vf", Namespace: "default", Labels: map[string]string{"kubedock.containerid": "tr808"}}},
+		),
+	}
+	owner := metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "kubedock-f1spirit-tb303", UID: "6502"}
+	if err := kub.setConfigMapsOwner(&types.Container{ShortID: "tb303"}, owner); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	cm, _ := kub.cli.CoreV1().ConfigMaps("default").Get(context.Background(), "tb303-vf", metav1.GetOptions{})
+	if !reflect.DeepEqual(cm.OwnerReferences, []metav1.OwnerReference{owner}) {
+		t.Errorf("expected owner reference on tb303-vf, but got %v", cm.OwnerReferences)
+	}
+	cm, _ = kub.cli.CoreV1().ConfigMaps("default").Get(context.Background(), "tr808-vf", metav1.GetOptions{})
+	if len(cm.OwnerReferences) != 0 {
+		t.Errorf("expected no owner reference on tr808-vf, but got %v", cm.OwnerReferences)
+	}
+}
+
 func TestStartContainerIdempotency(t *testing.T) {
 	// Test that calling StartContainer twice doesn't delete the pod
 	existingPod := &corev1.Pod{
@@ -496,6 +675,70 @@ func TestWaitReadyState(t *testing.T) {
 	}
 }
 
+func TestGetDeployError(t *testing.T) {
+	tests := []struct {
+		status corev1.PodStatus
+		reason string
+	}{
+		{status: corev1.PodStatus{}, reason: ""},
+		{
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			}},
+			reason: "",
+		},
+		{
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "InvalidImageName", Message: "couldn't parse image name"}}},
+			}},
+			reason: "InvalidImageName",
+		},
+		{
+			status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "setup", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}}},
+			}},
+			reason: "ErrImagePull",
+		},
+		{
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CreateContainerConfigError", Message: "secret not found"}}},
+			}},
+			reason: "CreateContainerConfigError",
+		},
+		{
+			status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/3 nodes are available"},
+			}},
+			reason: "Unschedulable",
+		},
+	}
+	for i, tst := range tests {
+		kub := &instance{}
+		err := kub.getDeployError(&corev1.Pod{Status: tst.status})
+		reason := ""
+		if derr, ok := err.(*DeployError); ok {
+			reason = derr.Reason
+		}
+		if reason != tst.reason {
+			t.Errorf("failed test %d - expected reason '%s', but got '%s'", i, tst.reason, reason)
+		}
+	}
+
+	kub := &instance{
+		namespace: "default",
+		cli: fake.NewSimpleClientset(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubedock-f1spirit-tb303", Namespace: "default"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}}},
+			}},
+		}),
+	}
+	state, err := kub.waitReadyState(&types.Container{ShortID: "tb303", Name: "f1spirit"}, 30)
+	if state != DeployFailed || err == nil || err.Error() != "failed to start container; ImagePullBackOff: container main: Back-off pulling image" {
+		t.Errorf("expected immediate ImagePullBackOff failure, but got %d, %s", state, err)
+	}
+}
+
 func TestWaitInitContainerRunning(t *testing.T) {
 	tests := []struct {
 		in   *types.Container
@@ -704,6 +947,32 @@ func TestAddVolumes(t *testing.T) {
 	}
 }
 
+func TestAddVolumesPreservesInitContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "wait-for-mesh"}},
+			Containers:     []corev1.Container{{Name: "proxy"}, {Name: "main"}},
+		},
+	}
+	kub := &instance{cli: fake.NewSimpleClientset()}
+	in := &types.Container{Binds: []string{".:/remote:rw"}}
+	if err := kub.addVolumes(in, pod); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if err := kub.addVolumes(in, pod); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if len(pod.Spec.InitContainers) != 2 || pod.Spec.InitContainers[1].Name != SetupInitContainerName {
+		t.Errorf("expected template init container and setup container, but got %v", pod.Spec.InitContainers)
+	}
+	if len(pod.Spec.Containers[0].VolumeMounts) != 0 {
+		t.Errorf("expected no volume mounts on sidecar container")
+	}
+	if len(pod.Spec.Containers[1].VolumeMounts) != 2 {
+		t.Errorf("expected volume mounts on main container, but got %v", pod.Spec.Containers[1].VolumeMounts)
+	}
+}
+
 func TestAddVolumesAndPreArchives(t *testing.T) {
 	tests := []struct {
 		in    *types.Container
@@ -773,6 +1042,8 @@ func TestGetLabels(t *testing.T) {
 		{in: &types.Container{Labels: map[string]string{"/": "abc"}}, labels: nil, count: 3},
 		{in: &types.Container{Labels: map[string]string{"computer": "msx"}}, labels: map[string]string{"computer": "msx"}, count: 4},
 		{in: &types.Container{Labels: map[string]string{"computer": "msx"}}, labels: map[string]string{"game": "on"}, count: 5},
+		{in: &types.Container{Labels: map[string]string{"com.joyrex2001.kubedock.pod-label/cost-center": "r&d"}}, labels: nil, count: 4},
+		{in: &types.Container{Labels: map[string]string{"com.joyrex2001.kubedock.pod-label/_": "msx"}}, labels: nil, count: 3},
 	}
 
 	for i, tst := range tests {
@@ -785,6 +1056,29 @@ func TestGetLabels(t *testing.T) {
 	}
 }
 
+func TestGetLabelsPassthrough(t *testing.T) {
+	kub := &instance{}
+	tainr := &types.Container{ShortID: "rc768", Labels: map[string]string{
+		"com.joyrex2001.kubedock.pod-label/cost-center":                  "r&d",
+		"com.joyrex2001.kubedock.pod-label/kubedock.containerid":         "hijack",
+		"com.joyrex2001.kubedock.pod-annotation/sidecar.istio.io/inject": "false",
+	}}
+	lbls := kub.getLabels(nil, tainr)
+	if lbls["cost-center"] != "rd" {
+		t.Errorf("expected sanitized cost-center label, but got %v", lbls)
+	}
+	if lbls["kubedock.containerid"] != "rc768" {
+		t.Errorf("expected system label not to be overridden, but got %v", lbls)
+	}
+	if _, ok := lbls["com.joyrex2001.kubedock.pod-label/cost-center"]; ok {
+		t.Errorf("expected prefixed label not to be added, but got %v", lbls)
+	}
+	annot := kub.getAnnotations(nil, tainr)
+	if annot["sidecar.istio.io/inject"] != "false" {
+		t.Errorf("expected sidecar.istio.io/inject annotation, but got %v", annot)
+	}
+}
+
 func TestGetServices(t *testing.T) {
 	tests := []struct {
 		in    *types.Container
@@ -804,6 +1098,8 @@ func TestGetServices(t *testing.T) {
 		{in: &types.Container{NetworkAliases: []string{"tb303", "tr909"}, ExposedPorts: map[string]interface{}{"100/tcp": 1}, HostPorts: map[int]int{200: 200}}, svcs: 2, ports: 2},
 		{in: &types.Container{NetworkAliases: []string{"tb303_"}, ExposedPorts: map[string]interface{}{"100/tcp": 1}}, svcs: 0, ports: 0},
 		{in: &types.Container{NetworkAliases: []string{"303"}, ExposedPorts: map[string]interface{}{"100/tcp": 1}}, svcs: 0, ports: 0},
+		{in: &types.Container{NetworkAliases: []string{"tb303"}, ExposedPorts: map[string]interface{}{"53/udp": 1}}, svcs: 1, ports: 1},
+		{in: &types.Container{NetworkAliases: []string{"tb303"}, ExposedPorts: map[string]interface{}{"53/udp": 1, "53/tcp": 1}}, svcs: 1, ports: 2},
 	}
 	for i, tst := range tests {
 		kub := &instance{}
@@ -848,6 +1144,7 @@ func TestGetAnnotations(t *testing.T) {
 		{in: &types.Container{Labels: map[string]string{"computer": "msx"}}, annotations: nil, count: 2},
 		{in: &types.Container{Labels: map[string]string{"computer": "msx"}}, annotations: map[string]string{"computer": "msx"}, count: 2},
 		{in: &types.Container{Labels: map[string]string{"computer": "msx"}}, annotations: map[string]string{"game": "on"}, count: 3},
+		{in: &types.Container{Labels: map[string]string{"com.joyrex2001.kubedock.pod-annotation/sidecar.istio.io/inject": "false"}}, annotations: nil, count: 3},
 	}
 
 	for i, tst := range tests {
@@ -858,3 +1155,37 @@ func TestGetAnnotations(t *testing.T) {
 		}
 	}
 }
+
+func TestSupervisePortForward(t *testing.T) {
+	tainr := &types.Container{ID: "tb303tb303", ShortID: "tb303"}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: tainr.GetPodName(), Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	}
+
+	tests := []struct {
+		objs []runtime.Object
+		stop bool
+	}{
+		{objs: []runtime.Object{}},             // 0 pod is gone
+		{objs: []runtime.Object{pod}},          // 1 pod is not running anymore
+		{objs: []runtime.Object{}, stop: true}, // 2 stopped
+	}
+	for i, tst := range tests {
+		kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(tst.objs...), cfg: &rest.Config{Host: "http://127.0.0.1:1"}}
+		stop := make(chan struct{}, 1)
+		if tst.stop {
+			close(stop)
+		}
+		done := make(chan struct{})
+		go func() {
+			kub.supervisePortForward("container tb303", pod, func() (*corev1.Pod, error) { return kub.getPod(tainr) }, "", 0, 80, stop)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Errorf("failed test %d - expected port-forward supervisor to stop", i)
+		}
+	}
+}
@@ -1,14 +1,11 @@
 package backend
 
 import (
-	"context"
 	"io"
 	"strconv"
 	"strings"
 	"sync"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/util/exec"
 	"github.com/joyrex2001/kubedock/internal/util/ioproxy"
@@ -16,7 +13,7 @@ import (
 
 // ExecContainer will execute given exec object in kubernetes.
 func (in *instance) ExecContainer(tainr *types.Container, ex *types.Exec, stdin io.Reader, stdout io.Writer) (int, error) {
-	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+const (
+	// ExposeNodePort will expose the container ports via a NodePort service.
+	ExposeNodePort = "nodeport"
+	// ExposeLoadBalancer will expose the container ports via a LoadBalancer
+	// service.
+	ExposeLoadBalancer = "loadbalancer"
+	// ExposeIngress will expose the (http) container ports via an ingress.
+	ExposeIngress = "ingress"
+	// LabelExpose is the label that is added to the services and ingresses
+	// that expose a container.
+	LabelExpose = "kubedock.expose"
+)
+
+// ExposeContainer will make the ports of given running container reachable
+// from outside the cluster, according to the configured expose mode. For
+// services, the externally reachable ports are stored as the mapped ports
+// of the container, and the host as its host ip. For ingresses, the hosts
+// are stored as the ingress hosts of the container.
+func (in *instance) ExposeContainer(tainr *types.Container) error {
+	switch in.expose {
+	case ExposeNodePort, ExposeLoadBalancer:
+		return in.exposeService(tainr)
+	case ExposeIngress:
+		return in.exposeIngress(tainr)
+	}
+	return fmt.Errorf("unsupported expose mode %s", in.expose)
+}
+
+// getExposeName will return the name of the service and ingress that
+// expose given container.
+func getExposeName(tainr *types.Container) string {
+	return "kubedock-expose-" + tainr.ShortID
+}
+
+// createExposeService will create the service that exposes all ports of
+// given container with given type, and returns the created service. If
+// the service already exists, the existing service is returned.
+func (in *instance) createExposeService(tainr *types.Container, typ corev1.ServiceType) (*corev1.Service, error) {
+	owner, err := in.getOwnerReference(tainr)
+	if err != nil {
+		return nil, err
+	}
+	labels := in.getLabels(nil, tainr)
+	labels[LabelExpose] = "true"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       in.namespace,
+			Name:            getExposeName(tainr),
+			Labels:          labels,
+			Annotations:     in.getAnnotations(nil, tainr),
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     typ,
+			Selector: in.getPodMatchLabels(tainr),
+			Ports:    []corev1.ServicePort{},
+		},
+	}
+	done := map[string]bool{}
+	add := func(proto corev1.Protocol, ports map[int]int) {
+		for _, dst := range ports {
+			name := fmt.Sprintf("%s-%d", strings.ToLower(string(proto)), dst)
+			if done[name] {
+				continue
+			}
+			done[name] = true
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+				Name:       name,
+				Protocol:   proto,
+				Port:       int32(dst),
+				TargetPort: intstr.IntOrString{IntVal: int32(dst)},
+			})
+		}
+	}
+	add(corev1.ProtocolTCP, tainr.GetServicePorts())
+	if typ != corev1.ServiceTypeClusterIP {
+		add(corev1.ProtocolUDP, tainr.GetServiceUDPPorts())
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return nil, nil
+	}
+
+	klog.V(3).Infof("exposing container %s via %s service %s", tainr.ShortID, typ, svc.Name)
+	res, err := in.cli.CoreV1().Services(in.namespace).Create(context.Background(), svc, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return in.cli.CoreV1().Services(in.namespace).Get(context.Background(), svc.Name, metav1.GetOptions{})
+	}
+	return res, err
+}
+
+// exposeService will expose the ports of given container via a NodePort or
+// LoadBalancer service. For NodePort services, the configured expose host
+// is used as host ip, as the ip of the node is usually not reachable.
+func (in *instance) exposeService(tainr *types.Container) error {
+	typ := corev1.ServiceTypeNodePort
+	if in.expose == ExposeLoadBalancer {
+		typ = corev1.ServiceTypeLoadBalancer
+	}
+	svc, err := in.createExposeService(tainr, typ)
+	if err != nil || svc == nil {
+		return err
+	}
+
+	host := in.exposeHost
+	if typ == corev1.ServiceTypeLoadBalancer {
+		host, err = in.waitLoadBalancer(svc.Name)
+		if err != nil {
+			return err
+		}
+	}
+	if host == "" {
+		return fmt.Errorf("exposing containers via nodeport requires an expose host")
+	}
+
+	tainr.HostIP = host
+	tainr.MappedPorts = map[int]int{}
+	tainr.UDPMappedPorts = map[int]int{}
+	for _, port := range svc.Spec.Ports {
+		src := int(port.Port)
+		if typ == corev1.ServiceTypeNodePort {
+			src = int(port.NodePort)
+		}
+		if port.Protocol == corev1.ProtocolUDP {
+			tainr.MapUDPPort(src, port.TargetPort.IntValue())
+		} else {
+			tainr.MapPort(src, port.TargetPort.IntValue())
+		}
+	}
+	return nil
+}
+
+// waitLoadBalancer will wait until the LoadBalancer service with given name
+// has an external ip or hostname, and returns it.
+func (in *instance) waitLoadBalancer(name string) (string, error) {
+	for max := 0; max < in.timeOut; max++ {
+		svc, err := in.cli.CoreV1().Services(in.namespace).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		for _, ing := range svc.Status.LoadBalancer.Ingress {
+			if ing.IP != "" {
+				return ing.IP, nil
+			}
+			if ing.Hostname != "" {
+				return ing.Hostname, nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return "", fmt.Errorf("timeout waiting for external ip of service %s", name)
+}
+
+// exposeIngress will expose the http ports of given container via an
+// ingress, with a host for every port, in the form of
+// <short id>-<port>.<expose host>. As only http services can be reached
+// this way, only the ports that are marked as http with the expose-http
+// label are exposed.
+func (in *instance) exposeIngress(tainr *types.Container) error {
+	if in.exposeHost == "" {
+		return fmt.Errorf("exposing containers via ingress requires an expose host")
+	}
+	https, err := tainr.GetHTTPPorts()
+	if err != nil {
+		return err
+	}
+	if len(https) == 0 {
+		klog.V(3).Infof("not exposing container %s, no http ports", tainr.ShortID)
+		return nil
+	}
+	svc, err := in.createExposeService(tainr, corev1.ServiceTypeClusterIP)
+	if err != nil || svc == nil {
+		return err
+	}
+
+	owner, err := in.getOwnerReference(tainr)
+	if err != nil {
+		return err
+	}
+	prefix := networkingv1.PathTypePrefix
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       in.namespace,
+			Name:            svc.Name,
+			Labels:          svc.Labels,
+			Annotations:     in.getAnnotations(nil, tainr),
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+	}
+	if in.ingressClass != "" {
+		ing.Spec.IngressClassName = &in.ingressClass
+	}
+	hosts := map[int]string{}
+	for _, port := range svc.Spec.Ports {
+		if port.Protocol != corev1.ProtocolTCP || !https[int(port.Port)] {
+			continue
+		}
+		host := fmt.Sprintf("%s-%d.%s", tainr.ShortID, port.Port, in.exposeHost)
+		hosts[int(port.Port)] = host
+		ing.Spec.Rules = append(ing.Spec.Rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &prefix,
+						Backend: networkingv1.IngressBackend{
+							Service: &networkingv1.IngressServiceBackend{
+								Name: svc.Name,
+								Port: networkingv1.ServiceBackendPort{Number: port.Port},
+							},
+						},
+					}},
+				},
+			},
+		})
+	}
+
+	if len(ing.Spec.Rules) == 0 {
+		return nil
+	}
+
+	klog.V(3).Infof("exposing container %s via ingress %s", tainr.ShortID, ing.Name)
+	if _, err := in.cli.NetworkingV1().Ingresses(in.namespace).Create(context.Background(), ing, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	tainr.IngressHosts = hosts
+	return nil
+}
+
+// deleteIngresses will delete the ingresses which match the given label
+// selector.
+func (in *instance) deleteIngresses(selector string) error {
+	ings, err := in.cli.NetworkingV1().Ingresses(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return ignoreForbidden("ingresses", err)
+	}
+	for _, ing := range ings.Items {
+		if err := in.cli.NetworkingV1().Ingresses(ing.Namespace).Delete(context.Background(), ing.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
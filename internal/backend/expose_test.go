@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestExposeNodePort(t *testing.T) {
+	tainr := &types.Container{
+		ID:           "tb303tb303",
+		ShortID:      "tb303",
+		ExposedPorts: map[string]interface{}{"80/tcp": 1, "53/udp": 1},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: tainr.GetPodName(), Namespace: "default"},
+		Status:     corev1.PodStatus{HostIP: "10.0.0.1"},
+	}
+	// the fake clientset doesn't allocate node ports, hence the service
+	// is created upfront with the node ports already allocated.
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: getExposeName(tainr), Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{
+				{Name: "tcp-80", Protocol: corev1.ProtocolTCP, Port: 80, TargetPort: intstr.FromInt(80), NodePort: 30080},
+				{Name: "udp-53", Protocol: corev1.ProtocolUDP, Port: 53, TargetPort: intstr.FromInt(53), NodePort: 30053},
+			},
+		},
+	}
+
+	tests := []struct {
+		host   string
+		hostIP string
+		err    bool
+	}{
+		{host: "", err: true},                        // 0
+		{host: "tb303.local", hostIP: "tb303.local"}, // 1
+	}
+	for i, tst := range tests {
+		kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(pod, svc), expose: ExposeNodePort, exposeHost: tst.host}
+		err := kub.ExposeContainer(tainr)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		if tainr.HostIP != tst.hostIP {
+			t.Errorf("failed test %d - expected host ip %s, but got %s", i, tst.hostIP, tainr.HostIP)
+		}
+		if !reflect.DeepEqual(tainr.MappedPorts, map[int]int{30080: 80}) {
+			t.Errorf("failed test %d - unexpected mapped ports %v", i, tainr.MappedPorts)
+		}
+		if !reflect.DeepEqual(tainr.UDPMappedPorts, map[int]int{30053: 53}) {
+			t.Errorf("failed test %d - unexpected mapped udp ports %v", i, tainr.UDPMappedPorts)
+		}
+	}
+}
+
+func TestExposeIngress(t *testing.T) {
+	tainr := &types.Container{
+		ID:           "tb303tb303",
+		ShortID:      "tb303",
+		ExposedPorts: map[string]interface{}{"80/tcp": 1, "8080/tcp": 1, "5432/tcp": 1, "53/udp": 1},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tainr.GetPodName(), Namespace: "default"}}
+
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(pod), expose: ExposeIngress}
+	if err := kub.ExposeContainer(tainr); err == nil {
+		t.Errorf("expected error when exposing via ingress without expose host")
+	}
+
+	kub.exposeHost = "apps.local"
+	kub.ingressClass = "nginx"
+	if err := kub.ExposeContainer(tainr); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(tainr.IngressHosts) != 0 {
+		t.Errorf("expected no ingress hosts without http ports, but got %v", tainr.IngressHosts)
+	}
+
+	tainr.Labels = map[string]string{types.LabelExposeHTTP: "80, 8080"}
+	if err := kub.ExposeContainer(tainr); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	hosts := map[int]string{80: "tb303-80.apps.local", 8080: "tb303-8080.apps.local"}
+	if !reflect.DeepEqual(tainr.IngressHosts, hosts) {
+		t.Errorf("expected ingress hosts %v, but got %v", hosts, tainr.IngressHosts)
+	}
+
+	svc, err := kub.cli.CoreV1().Services("default").Get(context.Background(), getExposeName(tainr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if svc.Spec.Type != corev1.ServiceTypeClusterIP || len(svc.Spec.Ports) != 3 {
+		t.Errorf("expected cluster ip service with only the tcp ports, but got %v", svc.Spec)
+	}
+	ing, err := kub.cli.NetworkingV1().Ingresses("default").Get(context.Background(), getExposeName(tainr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName != "nginx" {
+		t.Errorf("expected ingress class nginx")
+	}
+	if len(ing.Spec.Rules) != 2 {
+		t.Errorf("expected 2 ingress rules, but got %d", len(ing.Spec.Rules))
+	}
+
+	if err := kub.deleteIngresses(LabelExpose + "=true"); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if _, err := kub.cli.NetworkingV1().Ingresses("default").Get(context.Background(), ing.Name, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected ingress to be deleted")
+	}
+}
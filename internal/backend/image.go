@@ -1,13 +1,24 @@
 package backend
 
 import (
+	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/util/image"
 )
 
 // GetImageExposedPorts will inspect the image in the registry and return the
 // configured exposed ports from the image, or will return an error if failed.
-func (in *instance) GetImageExposedPorts(img string) (map[string]struct{}, error) {
-	cfg, err := image.InspectConfig("docker://" + img)
+// If a platform is given, the image should have a variant available for that
+// specific platform.
+func (in *instance) GetImageExposedPorts(img, platform string) (map[string]struct{}, error) {
+	pl := &types.Platform{}
+	if platform != "" {
+		var err error
+		pl, err = types.ParsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg, err := image.InspectConfig("docker://"+img, pl.OS, pl.Architecture, pl.Variant)
 	if err != nil {
 		return nil, err
 	}
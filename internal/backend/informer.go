@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// StatusHandler is called with the short id of the container and its
+// current state whenever the pod of a container is updated.
+type StatusHandler func(id string, state DeployState, err error)
+
+// WatchContainers will start a shared pod informer that is scoped to the
+// pods orchestrated by this kubedock instance. Once the cache is synced,
+// pod lookups (status, pod ip and readiness) are served from the cache,
+// and every pod update is reported to the given handler. The informer is
+// stopped when the given stop channel is closed. If the cache didn't sync
+// within the configured timeout, an error is returned and pods are looked
+// up via the api instead.
+func (in *instance) WatchContainers(stop <-chan struct{}, handler StatusHandler) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(in.cli, 0,
+		informers.WithNamespace(in.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = "kubedock.id=" + config.InstanceID
+		}),
+	)
+	pods := factory.Core().V1().Pods()
+	if _, err := pods.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			in.notifyStatus(obj, handler)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			in.notifyStatus(obj, handler)
+		},
+	}); err != nil {
+		return err
+	}
+	factory.Start(stop)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(in.timeOut)*time.Second)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), pods.Informer().HasSynced) {
+		return fmt.Errorf("timed out waiting for pod informer to sync")
+	}
+	in.podLister = pods.Lister()
+	return nil
+}
+
+// notifyStatus will call given handler with the state of the container
+// that is running in given pod.
+func (in *instance) notifyStatus(obj interface{}, handler StatusHandler) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	id := pod.Labels["kubedock.containerid"]
+	if id == "" {
+		return
+	}
+	state, err := in.getPodStatus(pod)
+	klog.V(5).Infof("pod %s of container %s in state %d", pod.Name, id, state)
+	handler(id, state, err)
+}
+
+// IsPodCached will return true if the pod informer is enabled, and the pod
+// of given container is available in its cache. Otherwise, pod lookups for
+// the container are done via the api.
+func (in *instance) IsPodCached(tainr *types.Container) bool {
+	if in.podLister == nil {
+		return false
+	}
+	_, err := in.getCachedPod(tainr)
+	return err == nil
+}
+
+// getCachedPod will return the pod that runs given container from the
+// informer cache. It returns a not found error if the pod is not (yet)
+// available in the cache.
+func (in *instance) getCachedPod(tainr *types.Container) (*corev1.Pod, error) {
+	if !tainr.IsJob() {
+		return in.podLister.Pods(in.namespace).Get(tainr.GetPodName())
+	}
+	pods, err := in.podLister.Pods(in.namespace).List(labels.SelectorFromSet(map[string]string{
+		"kubedock.containerid": tainr.ShortID,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, errors.NewNotFound(corev1.Resource("pods"), tainr.GetPodName())
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+	return pods[0], nil
+}
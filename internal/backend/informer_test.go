@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestWatchContainers(t *testing.T) {
+	tainr := &types.Container{ShortID: "tb303", Name: "f1spirit"}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tainr.GetPodName(),
+			Namespace: "default",
+			Labels:    map[string]string{"kubedock.id": config.InstanceID, "kubedock.containerid": "tb303"},
+		},
+		Status: corev1.PodStatus{
+			PodIP: "10.0.0.1",
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+	other := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other",
+			Namespace: "default",
+			Labels:    map[string]string{"kubedock.id": "other", "kubedock.containerid": "tr808"},
+		},
+	}
+
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(pod, other), timeOut: 10}
+	if kub.IsPodCached(tainr) {
+		t.Errorf("expected pod not to be cached without informer")
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+
+	states := make(chan DeployState, 10)
+	if err := kub.WatchContainers(stop, func(id string, state DeployState, err error) {
+		if id != "tb303" {
+			t.Errorf("unexpected status update for container %s", id)
+		}
+		states <- state
+	}); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if state := <-states; state != DeployRunning {
+		t.Errorf("expected state %d, but got %d", DeployRunning, state)
+	}
+
+	if _, err := kub.getCachedPod(tainr); err != nil {
+		t.Errorf("expected pod to be served from cache, but got %s", err)
+	}
+	if !kub.IsPodCached(tainr) {
+		t.Errorf("expected pod to be cached")
+	}
+	if kub.IsPodCached(&types.Container{ShortID: "tr808", Name: "other"}) {
+		t.Errorf("expected pod of other instance not to be cached")
+	}
+
+	completed := pod.DeepCopy()
+	completed.Status.ContainerStatuses[0].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}
+	if _, err := kub.cli.CoreV1().Pods("default").UpdateStatus(context.Background(), completed, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	select {
+	case state := <-states:
+		if state != DeployCompleted {
+			t.Errorf("expected state %d, but got %d", DeployCompleted, state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected a status update for completed container")
+	}
+	if state, _ := kub.GetContainerStatus(tainr); state != DeployCompleted {
+		t.Errorf("expected cached state %d, but got %d", DeployCompleted, state)
+	}
+}
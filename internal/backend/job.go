@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// createWorkload will create the workload for given container, which is
+// either the given pod, or a job which wraps the given pod.
+func (in *instance) createWorkload(tainr *types.Container, pod *corev1.Pod) error {
+	if !tainr.IsJob() {
+		_, err := in.cli.CoreV1().Pods(in.namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		return err
+	}
+	_, err := in.cli.BatchV1().Jobs(in.namespace).Create(context.Background(), in.getJob(pod), metav1.CreateOptions{})
+	return err
+}
+
+// getJob will return a job that wraps given pod. The job will not retry
+// failed pods, and will be removed by kubernetes after the configured ttl
+// if kubedock didn't clean it up.
+func (in *instance) getJob(pod *corev1.Pod) *batchv1.Job {
+	backoff := int32(0)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoff,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+				},
+				Spec: pod.Spec,
+			},
+		},
+	}
+	if in.jobTTL > 0 {
+		ttl := in.jobTTL
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	return job
+}
+
+// getPod will return the pod that runs given container. If the container
+// runs as a job, it will return the most recent pod created by the job. If
+// the pod informer is running, the pod is served from its cache, and only
+// looked up via the api if it's not (yet) available in the cache.
+func (in *instance) getPod(tainr *types.Container) (*corev1.Pod, error) {
+	if in.podLister != nil {
+		pod, err := in.getCachedPod(tainr)
+		if err == nil {
+			return pod, nil
+		}
+		klog.V(5).Infof("pod of container %s not in cache: %s", tainr.ShortID, err)
+	}
+	if !tainr.IsJob() {
+		return in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	}
+	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.containerid=" + tainr.ShortID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, errors.NewNotFound(corev1.Resource("pods"), tainr.GetPodName())
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[j].CreationTimestamp.Before(&pods.Items[i].CreationTimestamp)
+	})
+	return &pods.Items[0], nil
+}
+
+// getJobStatus will return the state of the job of given container, which
+// is used when the job didn't create a pod (yet).
+func (in *instance) getJobStatus(tainr *types.Container) (DeployState, error) {
+	job, err := in.cli.BatchV1().Jobs(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	if err != nil {
+		return DeployFailed, err
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return DeployFailed, fmt.Errorf("failed to start container; %s", cond.Message)
+		}
+	}
+	return DeployPending, nil
+}
+
+// deleteWorkload will delete the workload (pod or job) of given container.
+func (in *instance) deleteWorkload(tainr *types.Container) error {
+	if !tainr.IsJob() {
+		return in.cli.CoreV1().Pods(in.namespace).Delete(context.Background(), tainr.GetPodName(), metav1.DeleteOptions{})
+	}
+	background := metav1.DeletePropagationBackground
+	return in.cli.BatchV1().Jobs(in.namespace).Delete(context.Background(), tainr.GetPodName(), metav1.DeleteOptions{
+		PropagationPolicy: &background,
+	})
+}
+
+// deleteJobs will delete k8s job resources, including their pods, which
+// match the given label selector.
+func (in *instance) deleteJobs(selector string) error {
+	jobs, err := in.cli.BatchV1().Jobs(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return ignoreForbidden("jobs", err)
+	}
+	background := metav1.DeletePropagationBackground
+	for _, job := range jobs.Items {
+		if err := in.cli.BatchV1().Jobs(job.Namespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &background,
+		}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteJobsOlderThan will delete jobs than are orchestrated by kubedock
+// and are older than the given keepmax duration.
+func (in *instance) DeleteJobsOlderThan(keepmax time.Duration) error {
+	jobs, err := in.cli.BatchV1().Jobs(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock=true",
+	})
+	if err != nil {
+		return ignoreForbidden("jobs", err)
+	}
+	for _, job := range jobs.Items {
+		if in.isOlderThan(job.ObjectMeta, keepmax) {
+			klog.V(3).Infof("deleting job: %s", job.Name)
+			background := metav1.DeletePropagationBackground
+			if err := in.cli.BatchV1().Jobs(job.Namespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{
+				PropagationPolicy: &background,
+			}); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestCreateWorkload(t *testing.T) {
+	tests := []struct {
+		in   *types.Container
+		pods int
+		jobs int
+	}{
+		{in: &types.Container{ShortID: "tb303", Name: "f1spirit"}, pods: 1, jobs: 0},
+		{in: &types.Container{ShortID: "tb303", Name: "f1spirit", Labels: map[string]string{"com.joyrex2001.kubedock.workload": "job"}}, pods: 0, jobs: 1},
+	}
+	for i, tst := range tests {
+		kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(), jobTTL: 600}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: tst.in.GetPodName(), Namespace: "default", Labels: map[string]string{"kubedock.containerid": "tb303"}},
+			Spec:       corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever},
+		}
+		if err := kub.createWorkload(tst.in, pod); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		pods, _ := kub.cli.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+		if len(pods.Items) != tst.pods {
+			t.Errorf("failed test %d - expected %d pods, but got %d", i, tst.pods, len(pods.Items))
+		}
+		jobs, _ := kub.cli.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+		if len(jobs.Items) != tst.jobs {
+			t.Errorf("failed test %d - expected %d jobs, but got %d", i, tst.jobs, len(jobs.Items))
+		}
+		if len(jobs.Items) == 0 {
+			continue
+		}
+		job := jobs.Items[0]
+		if *job.Spec.BackoffLimit != 0 {
+			t.Errorf("failed test %d - expected backoffLimit 0, but got %d", i, *job.Spec.BackoffLimit)
+		}
+		if job.Spec.TTLSecondsAfterFinished == nil || *job.Spec.TTLSecondsAfterFinished != 600 {
+			t.Errorf("failed test %d - expected ttlSecondsAfterFinished 600", i)
+		}
+		if job.Spec.Template.Labels["kubedock.containerid"] != "tb303" {
+			t.Errorf("failed test %d - expected pod labels in job template", i)
+		}
+	}
+}
+
+func TestGetContainerStatusJob(t *testing.T) {
+	tainr := &types.Container{ShortID: "tb303", Name: "f1spirit", Labels: map[string]string{"com.joyrex2001.kubedock.workload": "job"}}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: tainr.GetPodName(), Namespace: "default"}}
+	failed := job.DeepCopy()
+	failed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "quota exceeded"}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tainr.GetPodName() + "-x8k2p",
+			Namespace: "default",
+			Labels:    map[string]string{"kubedock.containerid": "tb303"},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}},
+	}
+
+	tests := []struct {
+		kub   *instance
+		state DeployState
+		err   bool
+	}{
+		{kub: &instance{namespace: "default", cli: fake.NewSimpleClientset(job)}, state: DeployPending},
+		{kub: &instance{namespace: "default", cli: fake.NewSimpleClientset(failed)}, state: DeployFailed, err: true},
+		{kub: &instance{namespace: "default", cli: fake.NewSimpleClientset(job, pod)}, state: DeployRunning},
+		{kub: &instance{namespace: "default", cli: fake.NewSimpleClientset()}, state: DeployFailed, err: true},
+	}
+	for i, tst := range tests {
+		state, err := tst.kub.GetContainerStatus(tainr)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if state != tst.state {
+			t.Errorf("failed test %d - expected state %d, but got %d", i, tst.state, state)
+		}
+	}
+}
+
+func TestDeleteContainerJob(t *testing.T) {
+	tainr := &types.Container{ShortID: "tb303", Name: "f1spirit", Labels: map[string]string{"com.joyrex2001.kubedock.workload": "job"}}
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: tainr.GetPodName(), Namespace: "default", Labels: map[string]string{"kubedock.containerid": "tb303"}}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", Labels: map[string]string{"kubedock.containerid": "tr808"}}},
+	)}
+	if err := kub.DeleteContainer(tainr); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	jobs, _ := kub.cli.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+	if len(jobs.Items) != 1 || jobs.Items[0].Name != "other" {
+		t.Errorf("expected only job of other container to remain, but got %v", jobs.Items)
+	}
+}
+
+func TestDeleteJobsOlderThan(t *testing.T) {
+	tests := []struct {
+		cnt int
+		kub *instance
+	}{
+		{
+			kub: &instance{
+				namespace: "default",
+				cli: fake.NewSimpleClientset(&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: "f1spirit", Namespace: "default"},
+				}),
+			},
+			cnt: 1,
+		},
+		{
+			kub: &instance{
+				namespace: "default",
+				cli: fake.NewSimpleClientset(&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: "f1spirit", Namespace: "default", Labels: map[string]string{"kubedock": "true"}},
+				}),
+			},
+			cnt: 0,
+		},
+	}
+	for i, tst := range tests {
+		if err := tst.kub.DeleteJobsOlderThan(100 * time.Millisecond); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		jobs, _ := tst.kub.cli.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+		if len(jobs.Items) != tst.cnt {
+			t.Errorf("failed test %d - expected %d remaining jobs, but got %d", i, tst.cnt, len(jobs.Items))
+		}
+	}
+}
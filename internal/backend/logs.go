@@ -40,12 +40,12 @@ func (in *instance) GetLogsRaw(tainr *types.Container, opts *LogOptions, stop ch
 func (in *instance) getLogs(tainr *types.Container, opts *LogOptions, stop chan struct{}, out io.Writer) error {
 	options := newPodLogOptions(opts)
 
-	_, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	pod, err := in.getPod(tainr)
 	if err != nil {
 		return err
 	}
 
-	req := in.cli.CoreV1().Pods(in.namespace).GetLogs(tainr.GetPodName(), &options)
+	req := in.cli.CoreV1().Pods(in.namespace).GetLogs(pod.Name, &options)
 	stream, err := req.Stream(context.Background())
 	if err != nil {
 		return err
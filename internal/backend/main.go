@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 
 	"github.com/joyrex2001/kubedock/internal/model/types"
@@ -34,23 +36,52 @@ type Backend interface {
 	ExecContainer(*types.Container, *types.Exec, io.Reader, io.Writer) (int, error)
 	GetLogs(*types.Container, *LogOptions, chan struct{}, io.Writer) error
 	GetLogsRaw(*types.Container, *LogOptions, chan struct{}, io.Writer) error
-	GetImageExposedPorts(string) (map[string]struct{}, error)
+	GetImageExposedPorts(string, string) (map[string]struct{}, error)
+	WatchContainers(<-chan struct{}, StatusHandler) error
+	IsPodCached(*types.Container) bool
+	PersistContainer(*types.Container, []*types.Network) error
+	AdoptContainers() ([]*types.Container, []*types.Network, error)
+	RegisterReplica() error
+	GetReplicas() (map[string]string, error)
+	GetOwnerURL(string) (string, error)
+	CreateNetworkPolicy(*types.Network) error
+	DeleteNetworkPolicy(*types.Network) error
+	UpdateContainerNetworks(*types.Container) error
+	ExposeContainer(*types.Container) error
+	StartHostTunnel(bool, <-chan struct{}) error
+	GetHostGateway() string
+	DialContainer(*types.Container, int) (net.Conn, error)
 }
 
 // instance is the internal representation of the Backend object.
 type instance struct {
-	cli               kubernetes.Interface
-	cfg               *rest.Config
-	podTemplate       *corev1.Pod
-	containerTemplate corev1.Container
-	initImage         string
-	dindImage         string
-	disableDind       bool
-	imagePullSecrets  []string
-	namespace         string
-	timeOut           int
-	kuburl            string
-	disableServices   bool
+	cli                   kubernetes.Interface
+	cfg                   *rest.Config
+	podTemplate           *corev1.Pod
+	podTemplateName       string
+	podTemplates          []*podtemplate.Template
+	podPatch              string
+	containerTemplate     corev1.Container
+	initImage             string
+	dindImage             string
+	disableDind           bool
+	imagePullSecrets      []string
+	namespace             string
+	timeOut               int
+	jobTTL                int32
+	kuburl                string
+	disableServices       bool
+	networkPolicies       bool
+	networkScopedServices bool
+	dnsServer             string
+	dnsSearches           []string
+	expose                string
+	exposeHost            string
+	ingressClass          string
+	proxyBindIP           string
+	hostPorts             []int
+	hostGateway           string
+	podLister             listerscorev1.PodLister
 }
 
 // Config is the structure to instantiate a Backend object
@@ -74,9 +105,18 @@ type Config struct {
 	// TimeOut is the max amount of time to wait until a container started
 	// or deleted.
 	TimeOut time.Duration
-	// PodTemplate refers to an optional file containing a pod resource that
-	// should be used as the base for creating pod resources.
+	// JobTTL is the time after which finished jobs are removed by kubernetes
+	// when running containers as a job.
+	JobTTL time.Duration
+	// PodTemplate refers to an optional comma-separated list of files or
+	// directories containing pod resources that should be used as the base
+	// for creating pod resources. Templates with match rules are used for
+	// matching containers, the first template without rules is the default.
 	PodTemplate string
+	// PodPatch is an optional strategic merge or json patch that is applied
+	// to all pods, either inline, or as a reference to a configmap
+	// (configmap:name/key) or a local file (file:path).
+	PodPatch string
 	// KubedockURL contains the url of this kubedock instance, to be used in
 	// docker-in-docker instances/sidecars.
 	KubedockURL string
@@ -84,31 +124,83 @@ type Config struct {
 	// Disable the creation of services. A networking solution such as kubedock-dns
 	// should be used.
 	DisableServices bool
+	// NetworkPolicies will isolate docker networks with network policies
+	// when set to true.
+	NetworkPolicies bool
+	// NetworkScopedServices will create the services of the network aliases
+	// per network, named after the alias and the network, instead of a
+	// single service per alias.
+	NetworkScopedServices bool
+	// DNSServer is the optional ip of the nameserver that is configured for
+	// the deployed pods, instead of the cluster dns.
+	DNSServer string
+	// DNSSearches are the search domains configured for the deployed pods,
+	// when DNSServer is set.
+	DNSSearches []string
+	// Expose is the optional mode in which the container ports are exposed
+	// outside the cluster (nodeport, loadbalancer or ingress).
+	Expose string
+	// ExposeHost is the externally reachable host of the nodes when exposing
+	// via nodeport, or the domain of the ingress hosts when exposing via
+	// ingress.
+	ExposeHost string
+	// IngressClass is the optional ingress class of the created ingresses.
+	IngressClass string
+	// ProxyBindIP is the default ip the port-forwards and reverse-proxies
+	// listen on, when no host ip is requested in the port binding.
+	ProxyBindIP string
+	// HostPorts are the ports on the kubedock host that are reachable from
+	// the containers via the host tunnel.
+	HostPorts []int
 }
 
 // New will return a Backend instance.
 func New(cfg Config) (Backend, error) {
 	pod := &corev1.Pod{}
+	podname := ""
+	tmpls := []*podtemplate.Template{}
 	if cfg.PodTemplate != "" {
-		var err error
-		pod, err = podtemplate.PodFromFile(cfg.PodTemplate)
+		all, err := podtemplate.TemplatesFromPath(cfg.PodTemplate)
 		if err != nil {
 			return nil, fmt.Errorf("error opening podtemplate: %w", err)
 		}
+		for _, tmpl := range all {
+			if tmpl.HasRules() {
+				tmpls = append(tmpls, tmpl)
+				continue
+			}
+			if podname == "" {
+				pod = tmpl.Pod
+				podname = tmpl.Name
+			}
+		}
 	}
 
 	return &instance{
-		cli:               cfg.Client,
-		cfg:               cfg.RestConfig,
-		initImage:         cfg.InitImage,
-		dindImage:         cfg.DindImage,
-		disableDind:       cfg.DisableDind,
-		namespace:         cfg.Namespace,
-		imagePullSecrets:  cfg.ImagePullSecrets,
-		podTemplate:       pod,
-		containerTemplate: podtemplate.ContainerFromPod(pod),
-		kuburl:            cfg.KubedockURL,
-		timeOut:           int(cfg.TimeOut.Seconds()),
-		disableServices:   cfg.DisableServices,
+		cli:                   cfg.Client,
+		cfg:                   cfg.RestConfig,
+		initImage:             cfg.InitImage,
+		dindImage:             cfg.DindImage,
+		disableDind:           cfg.DisableDind,
+		namespace:             cfg.Namespace,
+		imagePullSecrets:      cfg.ImagePullSecrets,
+		podTemplate:           pod,
+		podTemplateName:       podname,
+		podTemplates:          tmpls,
+		podPatch:              cfg.PodPatch,
+		containerTemplate:     podtemplate.ContainerFromPod(pod),
+		kuburl:                cfg.KubedockURL,
+		timeOut:               int(cfg.TimeOut.Seconds()),
+		jobTTL:                int32(cfg.JobTTL.Seconds()),
+		disableServices:       cfg.DisableServices,
+		networkPolicies:       cfg.NetworkPolicies,
+		networkScopedServices: cfg.NetworkScopedServices,
+		dnsServer:             cfg.DNSServer,
+		dnsSearches:           cfg.DNSSearches,
+		expose:                cfg.Expose,
+		exposeHost:            cfg.ExposeHost,
+		ingressClass:          cfg.IngressClass,
+		proxyBindIP:           cfg.ProxyBindIP,
+		hostPorts:             cfg.HostPorts,
 	}, nil
 }
@@ -0,0 +1,330 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/util/stringid"
+)
+
+const (
+	// LabelNetworkPrefix is the prefix of the pod labels that identify the
+	// networks a container is connected to; kubedock.network/<short id>=true.
+	LabelNetworkPrefix = "kubedock.network/"
+	// AnnotationAlias is the annotation of a network scoped service that
+	// contains the alias the service is created for.
+	AnnotationAlias = "kubedock.alias"
+)
+
+// validServiceName matches the aliases that are valid service names.
+var validServiceName = regexp.MustCompile("^[a-z]([-a-z0-9]*[a-z0-9])?$")
+
+// getNetworkLabel will return the pod label that identifies given network.
+func getNetworkLabel(id string) string {
+	return LabelNetworkPrefix + stringid.TruncateID(id)
+}
+
+// getNetworkLabels will return the pod labels that identify the networks
+// given container is connected to.
+func getNetworkLabels(tainr *types.Container) map[string]string {
+	res := map[string]string{}
+	for id := range tainr.Networks {
+		res[getNetworkLabel(id)] = "true"
+	}
+	return res
+}
+
+// getNetworkAnnotations will return the pod annotations that describe the
+// hostnames and networks of given container, as used by e.g. kubedock-dns.
+func getNetworkAnnotations(tainr *types.Container) map[string]string {
+	res := map[string]string{}
+	if tainr.Hostname == "" {
+		res["kubedock.hostalias/0"] = tainr.GetPodName()
+	} else {
+		res["kubedock.hostalias/0"] = tainr.Hostname
+	}
+	for i, hostname := range tainr.NetworkAliases {
+		res[fmt.Sprintf("kubedock.hostalias/%d", i+1)] = hostname
+	}
+	inetwork := 0
+	for network := range tainr.Networks {
+		res[fmt.Sprintf("kubedock.network/%d", inetwork)] = network
+		inetwork++
+	}
+	return res
+}
+
+// serviceAlias is an alias of a container that is made resolvable with a
+// service. If services are network scoped, network is the id of the network
+// the alias is resolvable in.
+type serviceAlias struct {
+	name    string
+	alias   string
+	network string
+}
+
+// getServiceAliases will return the aliases of given container for which a
+// service is created; the hostname and the network aliases, converted to
+// lower case, without duplicates and invalid names. If services are network
+// scoped, an alias is returned for every network it is resolvable in, named
+// after the alias and the network. Aliases that were added when connecting
+// to specific networks, are only resolvable within these networks.
+func (in *instance) getServiceAliases(tainr *types.Container) []serviceAlias {
+	aliases := []string{}
+	done := map[string]bool{}
+	for _, alias := range append([]string{tainr.Hostname}, tainr.NetworkAliases...) {
+		alias = strings.ToLower(alias)
+		if alias == "" || done[alias] {
+			continue
+		}
+		done[alias] = true
+		if !validServiceName.MatchString(alias) {
+			klog.Infof("ignoring network alias %s, invalid name", alias)
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+
+	res := []serviceAlias{}
+	if !in.networkScopedServices {
+		for _, alias := range aliases {
+			res = append(res, serviceAlias{name: alias, alias: alias})
+		}
+		return res
+	}
+
+	scope := map[string]map[string]bool{}
+	for id, eas := range tainr.EndpointAliases {
+		for _, alias := range eas {
+			alias = strings.ToLower(alias)
+			if _, ok := scope[alias]; !ok {
+				scope[alias] = map[string]bool{}
+			}
+			scope[alias][id] = true
+		}
+	}
+	for id := range tainr.Networks {
+		for _, alias := range aliases {
+			if nids, ok := scope[alias]; ok && !nids[id] {
+				continue
+			}
+			res = append(res, serviceAlias{name: getScopedServiceName(alias, id), alias: alias, network: id})
+		}
+	}
+	return res
+}
+
+// getScopedServiceName will return the name of the service of given alias
+// within given network; <alias>-<short network id>. The alias is truncated
+// if required to keep the name within the limits of a service name.
+func getScopedServiceName(alias, network string) string {
+	id := stringid.TruncateID(network)
+	if max := 62 - len(id); len(alias) > max {
+		alias = strings.TrimRight(alias[:max], "-")
+	}
+	return alias + "-" + id
+}
+
+// getNetworkHostAliases will return the host aliases that make the aliases
+// of the other containers resolvable within the networks given container is
+// connected to, if services are network scoped. The aliases are resolved to
+// the cluster ips of the network scoped services that exist when the pod is
+// created; aliases of containers that are started later are resolved by the
+// embedded dns server.
+func (in *instance) getNetworkHostAliases(tainr *types.Container) ([]corev1.HostAlias, error) {
+	if !in.networkScopedServices || in.disableServices {
+		return nil, nil
+	}
+	ips := []string{}
+	hosts := map[string][]string{}
+	done := map[string]bool{}
+	for id := range tainr.Networks {
+		svcs, err := in.cli.CoreV1().Services(in.namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: "kubedock.id=" + config.InstanceID + "," + getNetworkLabel(id) + "=true",
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, svc := range svcs.Items {
+			ip := svc.Spec.ClusterIP
+			alias := svc.Annotations[AnnotationAlias]
+			if ip == "" || ip == corev1.ClusterIPNone || alias == "" || done[alias] {
+				continue
+			}
+			if svc.Labels["kubedock.containerid"] == tainr.ShortID {
+				continue
+			}
+			done[alias] = true
+			if _, ok := hosts[ip]; !ok {
+				ips = append(ips, ip)
+			}
+			hosts[ip] = append(hosts[ip], alias)
+		}
+	}
+	res := []corev1.HostAlias{}
+	for _, ip := range ips {
+		res = append(res, corev1.HostAlias{IP: ip, Hostnames: hosts[ip]})
+	}
+	return res, nil
+}
+
+// setDNSConfig will configure the kubedock dns server as the nameserver of
+// given pod, using the configured search domains.
+func (in *instance) setDNSConfig(pod *corev1.Pod) {
+	ndots := "5"
+	pod.Spec.DNSPolicy = corev1.DNSNone
+	pod.Spec.DNSConfig = &corev1.PodDNSConfig{
+		Nameservers: []string{in.dnsServer},
+		Searches:    in.dnsSearches,
+		Options:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+	}
+}
+
+// getNetworkPolicyName will return the name of the network policy that
+// isolates given network.
+func getNetworkPolicyName(netw *types.Network) string {
+	return "kubedock-network-" + stringid.TruncateID(netw.ID)
+}
+
+// CreateNetworkPolicy will create a network policy for given network, if
+// network policies are enabled. Containers that are connected to the
+// network can only be reached by other containers in the same network,
+// and by pods that are not orchestrated by kubedock (e.g. the test runner).
+// If the network is internal, the containers are only allowed to connect
+// to containers in the same network, and to dns. Creating a policy that
+// already exists is not considered an error.
+func (in *instance) CreateNetworkPolicy(netw *types.Network) error {
+	if !in.networkPolicies {
+		return nil
+	}
+	_, err := in.cli.NetworkingV1().NetworkPolicies(in.namespace).Create(context.Background(), in.getNetworkPolicy(netw), metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteNetworkPolicy will delete the network policy of given network, if
+// network policies are enabled.
+func (in *instance) DeleteNetworkPolicy(netw *types.Network) error {
+	if !in.networkPolicies {
+		return nil
+	}
+	err := in.cli.NetworkingV1().NetworkPolicies(in.namespace).Delete(context.Background(), getNetworkPolicyName(netw), metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// getNetworkPolicy will return the network policy for given network.
+func (in *instance) getNetworkPolicy(netw *types.Network) *networkingv1.NetworkPolicy {
+	members := metav1.LabelSelector{MatchLabels: map[string]string{getNetworkLabel(netw.ID): "true"}}
+	others := metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "kubedock", Operator: metav1.LabelSelectorOpDoesNotExist},
+	}}
+
+	egress := []networkingv1.NetworkPolicyEgressRule{{}}
+	if netw.Internal {
+		udp := corev1.ProtocolUDP
+		tcp := corev1.ProtocolTCP
+		dns := intstr.FromInt32(53)
+		egress = []networkingv1.NetworkPolicyEgressRule{
+			{To: []networkingv1.NetworkPolicyPeer{{PodSelector: &members}}},
+			{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}}},
+		}
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getNetworkPolicyName(netw),
+			Namespace: in.namespace,
+			Labels: map[string]string{
+				"kubedock":    "true",
+				"kubedock.id": config.InstanceID,
+			},
+			Annotations: map[string]string{"kubedock.network": netw.Name},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: members,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{
+					{PodSelector: &members},
+					{PodSelector: &others, NamespaceSelector: &metav1.LabelSelector{}},
+				},
+			}},
+			Egress: egress,
+		},
+	}
+}
+
+// UpdateContainerNetworks will reconcile the kubernetes resources of given
+// running container with the networks it's currently connected to, and the
+// network aliases it currently has. It updates the network labels and
+// annotations of the pod, and creates or deletes the alias services.
+func (in *instance) UpdateContainerNetworks(tainr *types.Container) error {
+	pod, err := in.getPod(tainr)
+	if err != nil {
+		return err
+	}
+	labels := map[string]interface{}{}
+	for k := range pod.Labels {
+		if strings.HasPrefix(k, LabelNetworkPrefix) {
+			labels[k] = nil
+		}
+	}
+	for k, v := range getNetworkLabels(tainr) {
+		labels[k] = v
+	}
+	annotations := map[string]interface{}{}
+	for k := range pod.Annotations {
+		if strings.HasPrefix(k, "kubedock.hostalias/") || strings.HasPrefix(k, "kubedock.network/") {
+			annotations[k] = nil
+		}
+	}
+	for k, v := range getNetworkAnnotations(tainr) {
+		annotations[k] = v
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": labels, "annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	klog.V(3).Infof("updating networks of pod %s: %s", pod.Name, patch)
+	if _, err := in.cli.CoreV1().Pods(pod.Namespace).Patch(context.Background(), pod.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	return in.updateServices(tainr)
+}
+
+// deleteNetworkPolicies will delete the network policies which match the
+// given label selector.
+func (in *instance) deleteNetworkPolicies(selector string) error {
+	nps, err := in.cli.NetworkingV1().NetworkPolicies(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return ignoreForbidden("network policies", err)
+	}
+	for _, np := range nps.Items {
+		if err := in.cli.NetworkingV1().NetworkPolicies(np.Namespace).Delete(context.Background(), np.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestNetworkPolicy(t *testing.T) {
+	tests := []struct {
+		netw    *types.Network
+		enabled bool
+		policy  bool
+		egress  int
+	}{
+		{ // 0
+			netw:    &types.Network{ID: "tb303tb303tb303", Name: "tb303"},
+			enabled: false,
+			policy:  false,
+		},
+		{ // 1
+			netw:    &types.Network{ID: "tb303tb303tb303", Name: "tb303"},
+			enabled: true,
+			policy:  true,
+			egress:  1,
+		},
+		{ // 2
+			netw:    &types.Network{ID: "tr808tr808tr808", Name: "tr808", Internal: true},
+			enabled: true,
+			policy:  true,
+			egress:  2,
+		},
+	}
+
+	for i, tst := range tests {
+		kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(), networkPolicies: tst.enabled}
+		if err := kub.CreateNetworkPolicy(tst.netw); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := kub.CreateNetworkPolicy(tst.netw); err != nil {
+			t.Errorf("failed test %d - unexpected error recreating policy %s", i, err)
+		}
+		np, err := kub.cli.NetworkingV1().NetworkPolicies("default").Get(context.Background(), getNetworkPolicyName(tst.netw), metav1.GetOptions{})
+		if (err == nil) != tst.policy {
+			t.Errorf("failed test %d - expected policy %t, but got error %v", i, tst.policy, err)
+		}
+		if err != nil {
+			continue
+		}
+		if np.Spec.PodSelector.MatchLabels[getNetworkLabel(tst.netw.ID)] != "true" {
+			t.Errorf("failed test %d - expected pod selector on network label, got %v", i, np.Spec.PodSelector)
+		}
+		if len(np.Spec.Egress) != tst.egress {
+			t.Errorf("failed test %d - expected %d egress rules, but got %d", i, tst.egress, len(np.Spec.Egress))
+		}
+		if err := kub.DeleteNetworkPolicy(tst.netw); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := kub.DeleteNetworkPolicy(tst.netw); err != nil {
+			t.Errorf("failed test %d - unexpected error deleting removed policy %s", i, err)
+		}
+	}
+}
+
+func TestUpdateContainerNetworks(t *testing.T) {
+	tainr := &types.Container{
+		ID:             "tb303tb303",
+		ShortID:        "tb303",
+		Networks:       map[string]interface{}{"sh101sh101sh101": nil},
+		NetworkAliases: []string{"f1spirit"},
+		ExposedPorts:   map[string]interface{}{"100/tcp": 1},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tainr.GetPodName(),
+			Namespace: "default",
+			Labels: map[string]string{
+				"kubedock.id":                      config.InstanceID,
+				"kubedock.containerid":             "tb303",
+				getNetworkLabel("tr808tr808tr808"): "true",
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "gradius",
+			Namespace: "default",
+			Labels:    map[string]string{"kubedock.containerid": "tb303"},
+		},
+	}
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(pod, svc), networkPolicies: true}
+	if err := kub.UpdateContainerNetworks(tainr); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	res, err := kub.cli.CoreV1().Pods("default").Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, ok := res.Labels[getNetworkLabel("tr808tr808tr808")]; ok {
+		t.Errorf("expected label of disconnected network to be removed")
+	}
+	if res.Labels[getNetworkLabel("sh101sh101sh101")] != "true" {
+		t.Errorf("expected label of connected network to be added")
+	}
+	if res.Labels["kubedock.containerid"] != "tb303" {
+		t.Errorf("expected other labels to be kept")
+	}
+	if res.Annotations["kubedock.hostalias/1"] != "f1spirit" {
+		t.Errorf("expected hostalias annotation of network alias, but got %v", res.Annotations)
+	}
+	if _, err := kub.cli.CoreV1().Services("default").Get(context.Background(), "gradius", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected service of removed alias to be deleted")
+	}
+	if _, err := kub.cli.CoreV1().Services("default").Get(context.Background(), "f1spirit", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected service of new alias to be created: %s", err)
+	}
+}
+
+func TestGetServiceAliases(t *testing.T) {
+	tests := []struct {
+		in     *types.Container
+		scoped bool
+		names  []string
+	}{
+		{ // 0
+			in:    &types.Container{Hostname: "Gradius", NetworkAliases: []string{"gradius", "f1spirit", "in_valid"}},
+			names: []string{"f1spirit", "gradius"},
+		},
+		{ // 1
+			in: &types.Container{
+				Hostname:       "gradius",
+				NetworkAliases: []string{"f1spirit"},
+				Networks:       map[string]interface{}{"sh101sh101sh101": nil, "tr808tr808tr808": nil},
+			},
+			scoped: true,
+			names:  []string{"f1spirit-sh101sh101sh", "f1spirit-tr808tr808tr", "gradius-sh101sh101sh", "gradius-tr808tr808tr"},
+		},
+		{ // 2
+			in: &types.Container{
+				NetworkAliases:  []string{"gradius", "f1spirit"},
+				Networks:        map[string]interface{}{"sh101sh101sh101": nil, "tr808tr808tr808": nil},
+				EndpointAliases: map[string][]string{"tr808tr808tr808": {"f1spirit"}},
+			},
+			scoped: true,
+			names:  []string{"f1spirit-tr808tr808tr", "gradius-sh101sh101sh", "gradius-tr808tr808tr"},
+		},
+		{ // 3
+			in: &types.Container{
+				NetworkAliases: []string{"f1spirit"},
+				Networks:       map[string]interface{}{"sh101sh101sh101": nil, "tr808tr808tr808": nil, "tb303tb303tb303": nil},
+				EndpointAliases: map[string][]string{
+					"sh101sh101sh101": {"f1spirit"},
+					"tr808tr808tr808": {"F1Spirit"},
+				},
+			},
+			scoped: true,
+			names:  []string{"f1spirit-sh101sh101sh", "f1spirit-tr808tr808tr"},
+		},
+	}
+	for i, tst := range tests {
+		kub := &instance{networkScopedServices: tst.scoped}
+		names := []string{}
+		for _, sa := range kub.getServiceAliases(tst.in) {
+			names = append(names, sa.name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tst.names) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.names, names)
+		}
+	}
+}
+
+func TestGetScopedServiceName(t *testing.T) {
+	tests := []struct {
+		alias   string
+		network string
+		out     string
+	}{
+		{alias: "gradius", network: "sh101sh101sh101", out: "gradius-sh101sh101sh"},                                         // 0
+		{alias: strings.Repeat("a", 49) + "-b", network: "sh101sh101sh101", out: strings.Repeat("a", 49) + "-sh101sh101sh"}, // 1
+	}
+	for i, tst := range tests {
+		if res := getScopedServiceName(tst.alias, tst.network); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+		if res := getScopedServiceName(tst.alias, tst.network); len(res) > 63 {
+			t.Errorf("failed test %d - service name %s exceeds 63 characters", i, res)
+		}
+	}
+}
+
+func TestGetNetworkHostAliases(t *testing.T) {
+	svc := func(name, alias, network, id, ip string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					"kubedock.id":            config.InstanceID,
+					"kubedock.containerid":   id,
+					getNetworkLabel(network): "true",
+				},
+				Annotations: map[string]string{AnnotationAlias: alias},
+			},
+			Spec: corev1.ServiceSpec{ClusterIP: ip},
+		}
+	}
+	cli := fake.NewSimpleClientset(
+		svc("db-sh101sh101sh", "db", "sh101sh101sh101", "mx1", "10.0.0.1"),
+		svc("db-tr808tr808tr", "db", "tr808tr808tr808", "mx2", "10.0.0.2"),
+		svc("app-sh101sh101sh", "app", "sh101sh101sh101", "tb303", "10.0.0.3"),
+	)
+	tainr := &types.Container{ShortID: "tb303", Networks: map[string]interface{}{"sh101sh101sh101": nil}}
+
+	kub := &instance{namespace: "default", cli: cli}
+	if res, err := kub.getNetworkHostAliases(tainr); err != nil || len(res) != 0 {
+		t.Errorf("expected no host aliases if services are not network scoped, but got %v", res)
+	}
+
+	kub.networkScopedServices = true
+	res, err := kub.getNetworkHostAliases(tainr)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	exp := []corev1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"db"}}}
+	if !reflect.DeepEqual(res, exp) {
+		t.Errorf("expected host aliases %v, but got %v", exp, res)
+	}
+}
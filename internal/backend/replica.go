@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+const (
+	// AnnotationURL is the annotation that contains the url of the kubedock
+	// instance that owns the resource.
+	AnnotationURL = "kubedock.url"
+	// replicaLeaseDuration is the duration after which a replica that didn't
+	// renew its lease is considered gone.
+	replicaLeaseDuration = 60
+)
+
+// RegisterReplica will create, or renew, the lease that advertises this
+// kubedock instance, and the url it can be reached on, to the other
+// replicas in the namespace. It should be renewed well within 60 seconds.
+func (in *instance) RegisterReplica() error {
+	now := metav1.NewMicroTime(time.Now())
+	name := "kubedock-replica-" + config.InstanceID
+	lease, err := in.cli.CoordinationV1().Leases(in.namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		duration := int32(replicaLeaseDuration)
+		id := config.InstanceID
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   in.namespace,
+				Labels:      map[string]string{"kubedock.id": config.InstanceID, "kubedock.replica": "true"},
+				Annotations: map[string]string{AnnotationURL: in.kuburl},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &id,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = in.cli.CoordinationV1().Leases(in.namespace).Create(context.Background(), lease, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	lease.Spec.RenewTime = &now
+	_, err = in.cli.CoordinationV1().Leases(in.namespace).Update(context.Background(), lease, metav1.UpdateOptions{})
+	return err
+}
+
+// GetReplicas will return the urls of the other kubedock replicas in the
+// namespace that have renewed their lease in time, indexed by their
+// instance id.
+func (in *instance) GetReplicas() (map[string]string, error) {
+	leases, err := in.cli.CoordinationV1().Leases(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.replica=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	for _, lease := range leases.Items {
+		id := lease.Labels["kubedock.id"]
+		url := lease.Annotations[AnnotationURL]
+		if id == config.InstanceID || url == "" || lease.Spec.RenewTime == nil {
+			continue
+		}
+		duration := time.Duration(replicaLeaseDuration) * time.Second
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+		if lease.Spec.RenewTime.Add(duration).Before(time.Now()) {
+			klog.V(3).Infof("ignoring expired replica %s", id)
+			continue
+		}
+		res[id] = url
+	}
+	return res, nil
+}
+
+// GetOwnerURL will return the url of the kubedock instance that owns the
+// pod of the container with given short id, as recorded in the pod
+// annotations. It returns an empty string if the pod does not exist.
+func (in *instance) GetOwnerURL(id string) (string, error) {
+	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.containerid=" + id,
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		if pod.Labels["kubedock.id"] == config.InstanceID {
+			continue
+		}
+		if url := pod.Annotations[AnnotationURL]; url != "" {
+			return url, nil
+		}
+	}
+	return "", nil
+}
+
+// deleteLeases will delete the replica leases which match the given label
+// selector.
+func (in *instance) deleteLeases(selector string) error {
+	leases, err := in.cli.CoordinationV1().Leases(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector + ",kubedock.replica=true",
+	})
+	if err != nil {
+		return ignoreForbidden("leases", err)
+	}
+	for _, lease := range leases.Items {
+		if err := in.cli.CoordinationV1().Leases(lease.Namespace).Delete(context.Background(), lease.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
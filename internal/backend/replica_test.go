@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+func getReplicaLease(id, url string, renew time.Time) *coordinationv1.Lease {
+	duration := int32(60)
+	now := metav1.NewMicroTime(renew)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kubedock-replica-" + id,
+			Namespace:   "default",
+			Labels:      map[string]string{"kubedock.id": id, "kubedock.replica": "true"},
+			Annotations: map[string]string{"kubedock.url": url},
+		},
+		Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &duration, RenewTime: &now},
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	kub := &instance{namespace: "default", kuburl: "http://10.0.0.1:2475", cli: fake.NewSimpleClientset(
+		getReplicaLease("tb303", "http://10.0.0.2:2475", time.Now()),
+		getReplicaLease("tr808", "http://10.0.0.3:2475", time.Now().Add(-5*time.Minute)),
+	)}
+	for i := 0; i < 2; i++ {
+		if err := kub.RegisterReplica(); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+	}
+	lease, err := kub.cli.CoordinationV1().Leases("default").Get(context.Background(), "kubedock-replica-"+config.InstanceID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected lease of this replica, but got %s", err)
+	}
+	if lease.Annotations["kubedock.url"] != "http://10.0.0.1:2475" {
+		t.Errorf("expected url annotation on lease, but got %v", lease.Annotations)
+	}
+
+	replicas, err := kub.GetReplicas()
+	if err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if len(replicas) != 1 || replicas["tb303"] != "http://10.0.0.2:2475" {
+		t.Errorf("expected only replica tb303, but got %v", replicas)
+	}
+
+	if err := kub.deleteLeases("kubedock.id=" + config.InstanceID); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	leases, _ := kub.cli.CoordinationV1().Leases("default").List(context.Background(), metav1.ListOptions{})
+	if len(leases.Items) != 2 {
+		t.Errorf("expected 2 remaining leases, but got %d", len(leases.Items))
+	}
+}
+
+func TestGetOwnerURL(t *testing.T) {
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "f1spirit",
+			Namespace:   "default",
+			Labels:      map[string]string{"kubedock.id": "tb303", "kubedock.containerid": "123456789abc"},
+			Annotations: map[string]string{"kubedock.url": "http://10.0.0.2:2475"},
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "salamander",
+			Namespace:   "default",
+			Labels:      map[string]string{"kubedock.id": config.InstanceID, "kubedock.containerid": "abc123456789"},
+			Annotations: map[string]string{"kubedock.url": "http://10.0.0.1:2475"},
+		}},
+	)}
+	tests := []struct {
+		id  string
+		url string
+	}{
+		{id: "123456789abc", url: "http://10.0.0.2:2475"}, // 0
+		{id: "abc123456789", url: ""},                     // 1
+		{id: "cba987654321", url: ""},                     // 2
+	}
+	for i, tst := range tests {
+		url, err := kub.GetOwnerURL(tst.id)
+		if err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if url != tst.url {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.url, url)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/tunnel"
+	"github.com/joyrex2001/kubedock/internal/util/myip"
+	"github.com/joyrex2001/kubedock/internal/util/stringid"
+)
+
+const (
+	// LabelTunnel is the label that is added to the pod and service of the
+	// host tunnel.
+	LabelTunnel = "kubedock.tunnel"
+	// HostGatewayName is the hostname via which containers can reach the
+	// ports on the kubedock host.
+	HostGatewayName = "host.docker.internal"
+	// HostGateway is the special value of an extra host that is replaced
+	// with the ip of the host gateway.
+	HostGateway = "host-gateway"
+	// TunnelControlPort is the port the tunnel agent accepts the tunnel
+	// connections of kubedock on.
+	TunnelControlPort = 7070
+	// tunnelTokenKey is the key in the secret of the host tunnel that
+	// contains the token that authenticates kubedock at the agent.
+	tunnelTokenKey = "token"
+)
+
+// getTunnelName will return the name of the pod and service of the host
+// tunnel of this kubedock instance.
+func getTunnelName() string {
+	return "kubedock-tunnel-" + config.InstanceID
+}
+
+// StartHostTunnel will deploy the host tunnel agent, which relays the
+// connections to the configured host ports to kubedock, and connects to
+// it. Kubedock connects to the agent via a port-forward if portfw is set,
+// otherwise via the pod ip, and authenticates with the token that is
+// stored in the secret of the tunnel. The cluster ip of the service of the
+// agent is used as the ip of the host gateway. The tunnel is closed when
+// the given stop channel is closed.
+func (in *instance) StartHostTunnel(portfw bool, stop <-chan struct{}) error {
+	if len(in.hostPorts) == 0 {
+		return nil
+	}
+	for _, port := range in.hostPorts {
+		if port == TunnelControlPort {
+			return fmt.Errorf("port %d is reserved for the host tunnel", port)
+		}
+	}
+
+	token, err := in.getTunnelToken()
+	if err != nil {
+		return err
+	}
+	svc, err := in.createTunnel()
+	if err != nil {
+		return err
+	}
+	if err := in.createTunnelPolicy(portfw); err != nil {
+		return err
+	}
+	pod, err := in.waitTunnelRunning()
+	if err != nil {
+		return err
+	}
+
+	dial := func() (net.Conn, error) {
+		pod, err := in.getTunnelPod()
+		if err != nil {
+			return nil, err
+		}
+		return net.DialTimeout("tcp", net.JoinHostPort(pod.Status.PodIP, fmt.Sprintf("%d", TunnelControlPort)), 5*time.Second)
+	}
+	if portfw {
+		src, err := getFreePort()
+		if err != nil {
+			return err
+		}
+		go in.supervisePortForward("host tunnel", pod, in.getTunnelPod, "127.0.0.1", src, TunnelControlPort, stop)
+		addr := fmt.Sprintf("127.0.0.1:%d", src)
+		dial = func() (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, 5*time.Second)
+		}
+	}
+	tunnel.NewClient(tunnel.ClientConfig{Dial: dial, Token: token, Ports: in.hostPorts}).Run(stop)
+
+	in.hostGateway = svc.Spec.ClusterIP
+	klog.Infof("host ports %v reachable from containers via %s (%s)", in.hostPorts, HostGatewayName, in.hostGateway)
+	return nil
+}
+
+// GetHostGateway will return the ip via which containers can reach the
+// kubedock host, or an empty string if the host tunnel is not started.
+func (in *instance) GetHostGateway() string {
+	return in.hostGateway
+}
+
+// getTunnelLabels will return the labels of the resources of the host
+// tunnel.
+func getTunnelLabels() map[string]string {
+	labels := map[string]string{}
+	for k, v := range config.DefaultLabels {
+		labels[k] = v
+	}
+	for k, v := range config.SystemLabels {
+		labels[k] = v
+	}
+	labels[LabelTunnel] = "true"
+	return labels
+}
+
+// getTunnelToken will return the token that authenticates kubedock at the
+// host tunnel agent. The token is stored in a secret, which is passed to
+// the agent via its environment. If the secret exists already (e.g. when
+// adopted), the existing token is used.
+func (in *instance) getTunnelToken() (string, error) {
+	name := getTunnelName()
+	sec, err := in.cli.CoreV1().Secrets(in.namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err == nil {
+		if token := string(sec.Data[tunnelTokenKey]); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("secret %s does not contain a tunnel token", name)
+	}
+	if !errors.IsNotFound(err) {
+		return "", err
+	}
+	token := stringid.GenerateRandomID()
+	sec = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   in.namespace,
+			Name:        name,
+			Labels:      getTunnelLabels(),
+			Annotations: config.DefaultAnnotations,
+		},
+		Data: map[string][]byte{tunnelTokenKey: []byte(token)},
+	}
+	if _, err := in.cli.CoreV1().Secrets(in.namespace).Create(context.Background(), sec, metav1.CreateOptions{}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// setTunnelTokenOwner will make the pod of the host tunnel the owner of
+// the secret with the token, so it's removed together with the pod. The
+// secret is created before the pod, hence the owner is added afterwards.
+func (in *instance) setTunnelTokenOwner() error {
+	pod, err := in.getTunnelPod()
+	if err != nil {
+		return err
+	}
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: pod.Name, UID: pod.UID}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"ownerReferences": []metav1.OwnerReference{owner}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = in.cli.CoreV1().Secrets(in.namespace).Patch(context.Background(), pod.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// createTunnelPolicy will create the network policy of the host tunnel
+// agent, which allows all pods to connect to the tunneled ports, but only
+// kubedock to connect to the control port. If kubedock connects via a
+// port-forward, which is not subject to network policies, the control port
+// is not reachable via the network at all.
+func (in *instance) createTunnelPolicy(portfw bool) error {
+	tcp := corev1.ProtocolTCP
+	ports := []networkingv1.NetworkPolicyPort{}
+	for _, p := range in.hostPorts {
+		port := intstr.FromInt32(int32(p))
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &port})
+	}
+	ingress := []networkingv1.NetworkPolicyIngressRule{{Ports: ports}}
+	if !portfw {
+		ip, err := myip.Get()
+		if err != nil {
+			return err
+		}
+		cidr := ip + "/32"
+		if net.ParseIP(ip).To4() == nil {
+			cidr = ip + "/128"
+		}
+		ctrl := intstr.FromInt32(TunnelControlPort)
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &ctrl}},
+			From:  []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}},
+		})
+	}
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: in.namespace,
+			Name:      getTunnelName(),
+			Labels:    getTunnelLabels(),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"kubedock.id": config.InstanceID, LabelTunnel: "true"}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     ingress,
+		},
+	}
+	_, err := in.cli.NetworkingV1().NetworkPolicies(in.namespace).Create(context.Background(), np, metav1.CreateOptions{})
+	if errors.IsForbidden(err) {
+		klog.Warningf("not allowed to restrict access to the host tunnel with a network policy: %s", err)
+		return nil
+	}
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createTunnel will create the pod and service of the host tunnel agent,
+// and returns the service. Existing resources (e.g. when adopted) are
+// reused.
+func (in *instance) createTunnel() (*corev1.Service, error) {
+	name := getTunnelName()
+	labels := getTunnelLabels()
+
+	ports := []string{}
+	cports := []corev1.ContainerPort{{Name: "control", ContainerPort: TunnelControlPort, Protocol: corev1.ProtocolTCP}}
+	sports := []corev1.ServicePort{}
+	for _, port := range in.hostPorts {
+		ports = append(ports, fmt.Sprintf("%d", port))
+		cports = append(cports, corev1.ContainerPort{ContainerPort: int32(port), Protocol: corev1.ProtocolTCP})
+		sports = append(sports, corev1.ServicePort{
+			Name:       fmt.Sprintf("tcp-%d", port),
+			Protocol:   corev1.ProtocolTCP,
+			Port:       int32(port),
+			TargetPort: intstr.IntOrString{IntVal: int32(port)},
+		})
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   in.namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: config.DefaultAnnotations,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "tunnel",
+				Image:   in.initImage,
+				Command: []string{"kubedock", "tunnel", "--control-addr", fmt.Sprintf(":%d", TunnelControlPort), "--ports", strings.Join(ports, ",")},
+				Ports:   cports,
+				Env: []corev1.EnvVar{{
+					Name: "TUNNEL_TOKEN",
+					ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: name},
+						Key:                  tunnelTokenKey,
+					}},
+				}},
+			}},
+			RestartPolicy: corev1.RestartPolicyAlways,
+		},
+	}
+	for _, ps := range in.imagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: ps})
+	}
+
+	klog.V(3).Infof("creating host tunnel %s", name)
+	if _, err := in.cli.CoreV1().Pods(in.namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	if err := in.setTunnelTokenOwner(); err != nil {
+		klog.Warningf("error setting owner of host tunnel secret: %s", err)
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   in.namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: config.DefaultAnnotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"kubedock.id": config.InstanceID, LabelTunnel: "true"},
+			Ports:    sports,
+		},
+	}
+	res, err := in.cli.CoreV1().Services(in.namespace).Create(context.Background(), svc, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return in.cli.CoreV1().Services(in.namespace).Get(context.Background(), name, metav1.GetOptions{})
+	}
+	return res, err
+}
+
+// getTunnelPod will return the pod of the host tunnel agent.
+func (in *instance) getTunnelPod() (*corev1.Pod, error) {
+	return in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), getTunnelName(), metav1.GetOptions{})
+}
+
+// waitTunnelRunning will wait until the host tunnel agent is running, and
+// returns its pod.
+func (in *instance) waitTunnelRunning() (*corev1.Pod, error) {
+	for max := 0; max < in.timeOut; max++ {
+		pod, err := in.getTunnelPod()
+		if err != nil {
+			return nil, err
+		}
+		if pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" {
+			return pod, nil
+		}
+		time.Sleep(time.Second)
+	}
+	return nil, fmt.Errorf("timeout starting host tunnel")
+}
+
+// isTunnel will check if given resource metadata belongs to the host
+// tunnel of this kubedock instance, which should be kept while running.
+func isTunnel(met metav1.ObjectMeta) bool {
+	return met.Labels[LabelTunnel] == "true" && met.Labels["kubedock.id"] == config.InstanceID
+}
+
+// getHostAliases will return the host aliases for the pod of given
+// container. This contains the host gateway, if the host tunnel is
+// started, and the extra hosts of the container, where the special
+// host-gateway ip is replaced with the ip of the host gateway.
+func (in *instance) getHostAliases(tainr *types.Container) []corev1.HostAlias {
+	ips := []string{}
+	hosts := map[string][]string{}
+	add := func(ip, host string) {
+		if _, ok := hosts[ip]; !ok {
+			ips = append(ips, ip)
+		}
+		hosts[ip] = append(hosts[ip], host)
+	}
+	if in.hostGateway != "" {
+		add(in.hostGateway, HostGatewayName)
+	}
+	for _, eh := range tainr.ExtraHosts {
+		host, ip, ok := strings.Cut(eh, ":")
+		if !ok || host == "" || ip == "" {
+			klog.Warningf("ignoring invalid extra host %s", eh)
+			continue
+		}
+		if ip == HostGateway {
+			if in.hostGateway == "" {
+				klog.Warningf("ignoring extra host %s, host tunnel is not enabled", eh)
+				continue
+			}
+			ip = in.hostGateway
+		}
+		add(ip, host)
+	}
+	res := []corev1.HostAlias{}
+	for _, ip := range ips {
+		res = append(res, corev1.HostAlias{IP: ip, Hostnames: hosts[ip]})
+	}
+	return res
+}
+
+// getFreePort will return a random available local tcp port.
+func getFreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
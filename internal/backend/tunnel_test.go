@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestGetHostAliases(t *testing.T) {
+	tests := []struct {
+		gateway string
+		hosts   []string
+		out     []corev1.HostAlias
+	}{
+		{ // 0
+			gateway: "",
+			hosts:   []string{},
+			out:     []corev1.HostAlias{},
+		},
+		{ // 1
+			gateway: "10.0.0.1",
+			hosts:   []string{},
+			out:     []corev1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"host.docker.internal"}}},
+		},
+		{ // 2
+			gateway: "10.0.0.1",
+			hosts:   []string{"tb303:host-gateway", "tr808:10.0.0.2", "invalid"},
+			out: []corev1.HostAlias{
+				{IP: "10.0.0.1", Hostnames: []string{"host.docker.internal", "tb303"}},
+				{IP: "10.0.0.2", Hostnames: []string{"tr808"}},
+			},
+		},
+		{ // 3
+			gateway: "",
+			hosts:   []string{"tb303:host-gateway", "tr808:::1"},
+			out:     []corev1.HostAlias{{IP: "::1", Hostnames: []string{"tr808"}}},
+		},
+	}
+	for i, tst := range tests {
+		kub := &instance{hostGateway: tst.gateway}
+		res := kub.getHostAliases(&types.Container{ExtraHosts: tst.hosts})
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetTunnelToken(t *testing.T) {
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset()}
+	token, err := kub.getTunnelToken()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if token == "" {
+		t.Errorf("expected a tunnel token")
+	}
+	if res, err := kub.getTunnelToken(); err != nil || res != token {
+		t.Errorf("expected existing token %s to be reused, but got %s (%v)", token, res, err)
+	}
+	sec, err := kub.cli.CoreV1().Secrets("default").Get(context.Background(), getTunnelName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if string(sec.Data[tunnelTokenKey]) != token || !isTunnel(sec.ObjectMeta) {
+		t.Errorf("unexpected tunnel secret %v", sec)
+	}
+}
+
+func TestCreateTunnelPolicy(t *testing.T) {
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(), hostPorts: []int{8080, 5432}}
+	if err := kub.createTunnelPolicy(true); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if err := kub.createTunnelPolicy(true); err != nil {
+		t.Fatalf("unexpected error recreating policy %s", err)
+	}
+	np, err := kub.cli.NetworkingV1().NetworkPolicies("default").Get(context.Background(), getTunnelName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(np.Spec.Ingress) != 1 || len(np.Spec.Ingress[0].Ports) != 2 {
+		t.Errorf("expected only the host ports to be allowed, but got %v", np.Spec.Ingress)
+	}
+	if np.Spec.PodSelector.MatchLabels[LabelTunnel] != "true" {
+		t.Errorf("expected policy to select the tunnel pod")
+	}
+}
+
+func TestCreateTunnel(t *testing.T) {
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset(), initImage: "kubedock", hostPorts: []int{8080, 5432}}
+	if _, err := kub.createTunnel(); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, err := kub.createTunnel(); err != nil {
+		t.Fatalf("unexpected error recreating tunnel %s", err)
+	}
+	pod, err := kub.cli.CoreV1().Pods("default").Get(context.Background(), getTunnelName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if cmd := strings.Join(pod.Spec.Containers[0].Command, " "); !strings.HasSuffix(cmd, "tunnel --control-addr :7070 --ports 8080,5432") {
+		t.Errorf("unexpected tunnel command %s", cmd)
+	}
+	if !isTunnel(pod.ObjectMeta) {
+		t.Errorf("expected pod to be recognized as tunnel")
+	}
+	if env := pod.Spec.Containers[0].Env; len(env) != 1 || env[0].Name != "TUNNEL_TOKEN" || env[0].ValueFrom.SecretKeyRef.Name != getTunnelName() {
+		t.Errorf("expected tunnel token to be passed from secret, but got %v", env)
+	}
+	svc, err := kub.cli.CoreV1().Services("default").Get(context.Background(), getTunnelName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(svc.Spec.Ports) != 2 {
+		t.Errorf("expected 2 service ports, but got %d", len(svc.Spec.Ports))
+	}
+
+	kub.hostPorts = []int{TunnelControlPort}
+	if err := kub.StartHostTunnel(false, make(chan struct{})); err == nil {
+		t.Errorf("expected error when tunneling the control port")
+	}
+}
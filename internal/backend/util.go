@@ -82,3 +82,34 @@ OUTER:
 	}
 	return nil
 }
+
+// MapContainerUDPPorts will map random available udp ports to the udp ports
+// in the container.
+func (in *instance) MapContainerUDPPorts(tainr *types.Container) error {
+OUTER:
+	for _, pp := range tainr.GetContainerUDPPorts() {
+		// skip explicitly bound ports
+		for src, dst := range tainr.UDPHostPorts {
+			if src > 0 && dst == pp {
+				continue OUTER
+			}
+		}
+		// skip already mapped ports (for idempotency)
+		for _, dst := range tainr.UDPMappedPorts {
+			if dst == pp {
+				continue OUTER
+			}
+		}
+		addr, err := net.ResolveUDPAddr("udp", "0.0.0.0:0")
+		if err != nil {
+			return err
+		}
+		l, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return err
+		}
+		tainr.MapUDPPort(l.LocalAddr().(*net.UDPAddr).Port, pp)
+		defer l.Close()
+	}
+	return nil
+}
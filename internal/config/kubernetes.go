@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+
 	"github.com/spf13/viper"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -36,6 +38,13 @@ func init() {
 	SystemLabels["kubedock.id"] = InstanceID
 }
 
+// SetInstanceID will override the generated instance id with given id,
+// which allows a restarted kubedock to identify its own resources.
+func SetInstanceID(id string) {
+	InstanceID = id
+	SystemLabels["kubedock.id"] = id
+}
+
 // AddDefaultLabel will add a label that will be added to all containers
 // started by this kubedock instance.
 func AddDefaultLabel(key, value string) {
@@ -48,6 +57,12 @@ func AddDefaultAnnotation(key, value string) {
 	DefaultAnnotations[key] = value
 }
 
+// InCluster will return true if kubedock is running inside a kubernetes
+// cluster, in which case the pod network is reachable.
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
 // GetKubernetes will return a kubernetes config object.
 func GetKubernetes() (*rest.Config, error) {
 	var err error
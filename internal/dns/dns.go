@@ -0,0 +1,269 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"k8s.io/klog"
+)
+
+// ttl is the time-to-live of the answers, which is kept short as the
+// containers and their aliases are short-lived as well.
+const ttl = 5
+
+// Resolver will return the ips of given hostname, as seen by the client
+// with given ip. It returns nil if the hostname is unknown.
+type Resolver func(client net.IP, name string) []net.IP
+
+// Config is the structure to instantiate a Server object.
+type Config struct {
+	// Addr is the address the dns server listens on, for both udp and tcp.
+	Addr string
+	// Resolver is the function that resolves the hostnames of containers.
+	Resolver Resolver
+	// Upstream is the optional address (host:port) of the dns server that
+	// handles queries for hostnames that are not known by the resolver.
+	Upstream string
+	// Domains are the search domains that are removed from queried names
+	// before they are resolved, e.g. namespace.svc.cluster.local.
+	Domains []string
+}
+
+// Server is a dns server that answers queries for the hostnames of
+// containers, and forwards all other queries to the upstream dns server,
+// if configured.
+type Server struct {
+	cfg Config
+}
+
+// New will return a new Server instance.
+func New(cfg Config) *Server {
+	domains := []string{}
+	for _, d := range cfg.Domains {
+		if d = strings.Trim(strings.ToLower(d), "."); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	cfg.Domains = domains
+	return &Server{cfg: cfg}
+}
+
+// ListenAndServe will start listening for dns queries on udp and tcp. The
+// queries are served in the background, until the stop channel is closed.
+func (s *Server) ListenAndServe(stop <-chan struct{}) error {
+	pc, err := net.ListenPacket("udp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	klog.Infof("dns server listening on %s", s.cfg.Addr)
+	go func() {
+		<-stop
+		pc.Close()
+		ln.Close()
+	}()
+	go s.serveUDP(pc)
+	go s.serveTCP(ln)
+	return nil
+}
+
+// serveUDP will serve the dns queries received on given packet connection.
+func (s *Server) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := append([]byte{}, buf[:n]...)
+		go func() {
+			res, err := s.handle(clientIP(addr), req, "udp")
+			if err != nil {
+				klog.V(3).Infof("error handling dns query: %s", err)
+				return
+			}
+			if _, err := pc.WriteTo(res, addr); err != nil {
+				klog.V(3).Infof("error writing dns response: %s", err)
+			}
+		}()
+	}
+}
+
+// serveTCP will serve the dns queries received on given listener.
+func (s *Server) serveTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				req, err := readTCP(conn)
+				if err != nil {
+					return
+				}
+				res, err := s.handle(clientIP(conn.RemoteAddr()), req, "tcp")
+				if err != nil {
+					klog.V(3).Infof("error handling dns query: %s", err)
+					return
+				}
+				if err := writeTCP(conn, res); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle will return the response for given dns query. Queries for known
+// hostnames are answered directly, other queries are forwarded upstream.
+func (s *Server) handle(client net.IP, req []byte, network string) ([]byte, error) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+	var ips []net.IP
+	if q.Class == dnsmessage.ClassINET && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA) {
+		ips = s.resolve(client, name)
+	}
+	if ips == nil && s.cfg.Upstream != "" {
+		klog.V(5).Infof("forwarding dns query for %s", name)
+		return forward(s.cfg.Upstream, network, req)
+	}
+
+	klog.V(5).Infof("dns query for %s from %s: %v", name, client, ips)
+	rcode := dnsmessage.RCodeSuccess
+	if ips == nil {
+		rcode = dnsmessage.RCodeNameError
+	}
+	res := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 hdr.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   hdr.RecursionDesired,
+		RecursionAvailable: s.cfg.Upstream != "",
+		RCode:              rcode,
+	})
+	res.EnableCompression()
+	if err := res.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := res.Question(q); err != nil {
+		return nil, err
+	}
+	if err := res.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+			a := dnsmessage.AResource{}
+			copy(a.A[:], ip4)
+			if err := res.AResource(rh, a); err != nil {
+				return nil, err
+			}
+		} else if ip4 == nil && q.Type == dnsmessage.TypeAAAA {
+			aaaa := dnsmessage.AAAAResource{}
+			copy(aaaa.AAAA[:], ip.To16())
+			if err := res.AAAAResource(rh, aaaa); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res.Finish()
+}
+
+// resolve will resolve given name with the resolver. If the name is not
+// known, it will retry with the search domains removed from the name.
+func (s *Server) resolve(client net.IP, name string) []net.IP {
+	if ips := s.cfg.Resolver(client, name); ips != nil {
+		return ips
+	}
+	for _, d := range s.cfg.Domains {
+		if host := strings.TrimSuffix(name, "."+d); host != name && !strings.Contains(host, ".") {
+			if ips := s.cfg.Resolver(client, host); ips != nil {
+				return ips
+			}
+		}
+	}
+	return nil
+}
+
+// forward will send given dns query to the upstream dns server, and returns
+// its response.
+func forward(upstream, network string, req []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if network == "tcp" {
+		if err := writeTCP(conn, req); err != nil {
+			return nil, err
+		}
+		return readTCP(conn)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readTCP will read a length-prefixed dns message from given connection.
+func readTCP(conn net.Conn) ([]byte, error) {
+	var l uint16
+	if err := binary.Read(conn, binary.BigEndian, &l); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, l)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCP will write given dns message length-prefixed to given connection.
+func writeTCP(conn net.Conn, msg []byte) error {
+	if len(msg) > 65535 {
+		return fmt.Errorf("dns message too large")
+	}
+	buf := make([]byte, 2, len(msg)+2)
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	_, err := conn.Write(append(buf, msg...))
+	return err
+}
+
+// clientIP will return the ip of given remote address.
+func clientIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func query(t *testing.T, name string, typ dnsmessage.Type) []byte {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 303, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  typ,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	req, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("unexpected error packing query: %s", err)
+	}
+	return req
+}
+
+func answer(t *testing.T, res []byte) (dnsmessage.RCode, []string) {
+	msg := dnsmessage.Message{}
+	if err := msg.Unpack(res); err != nil {
+		t.Fatalf("unexpected error unpacking response: %s", err)
+	}
+	ips := []string{}
+	for _, a := range msg.Answers {
+		switch r := a.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(r.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(r.AAAA[:]).String())
+		}
+	}
+	return msg.Header.RCode, ips
+}
+
+func TestHandle(t *testing.T) {
+	resolver := func(client net.IP, name string) []net.IP {
+		if name == "tb303" && client.String() == "10.0.0.1" {
+			return []net.IP{net.ParseIP("10.0.0.2")}
+		}
+		return nil
+	}
+	srv := New(Config{Resolver: resolver, Domains: []string{"default.svc.cluster.local."}})
+
+	tests := []struct {
+		name  string
+		typ   dnsmessage.Type
+		rcode dnsmessage.RCode
+		ips   []string
+	}{
+		{name: "tb303.", typ: dnsmessage.TypeA, rcode: dnsmessage.RCodeSuccess, ips: []string{"10.0.0.2"}},                           // 0
+		{name: "TB303.", typ: dnsmessage.TypeA, rcode: dnsmessage.RCodeSuccess, ips: []string{"10.0.0.2"}},                           // 1
+		{name: "tb303.default.svc.cluster.local.", typ: dnsmessage.TypeA, rcode: dnsmessage.RCodeSuccess, ips: []string{"10.0.0.2"}}, // 2
+		{name: "tb303.other.svc.cluster.local.", typ: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError, ips: []string{}},           // 3
+		{name: "tb303.", typ: dnsmessage.TypeAAAA, rcode: dnsmessage.RCodeSuccess, ips: []string{}},                                  // 4
+		{name: "tr808.", typ: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError, ips: []string{}},                                   // 5
+		{name: "tb303.", typ: dnsmessage.TypeMX, rcode: dnsmessage.RCodeNameError, ips: []string{}},                                  // 6
+	}
+	for i, tst := range tests {
+		res, err := srv.handle(net.ParseIP("10.0.0.1"), query(t, tst.name, tst.typ), "udp")
+		if err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		rcode, ips := answer(t, res)
+		if rcode != tst.rcode {
+			t.Errorf("failed test %d - expected rcode %s, but got %s", i, tst.rcode, rcode)
+		}
+		if !reflect.DeepEqual(ips, tst.ips) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.ips, ips)
+		}
+	}
+}
+
+func TestForward(t *testing.T) {
+	upstream := New(Config{
+		Resolver: func(client net.IP, name string) []net.IP {
+			if name == "example.com" {
+				return []net.IP{net.ParseIP("10.0.0.3")}
+			}
+			return nil
+		},
+	})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer pc.Close()
+	go upstream.serveUDP(pc)
+
+	srv := New(Config{
+		Resolver: func(client net.IP, name string) []net.IP { return nil },
+		Upstream: pc.LocalAddr().String(),
+	})
+	res, err := srv.handle(net.ParseIP("10.0.0.1"), query(t, "example.com.", dnsmessage.TypeA), "udp")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if _, ips := answer(t, res); !reflect.DeepEqual(ips, []string{"10.0.0.3"}) {
+		t.Errorf("expected forwarded answer 10.0.0.3, but got %v", ips)
+	}
+}
+
+func TestReadResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	conf := "search default.svc.cluster.local svc.cluster.local\nnameserver 10.96.0.10\nnameserver 10.96.0.11\noptions ndots:5\n"
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	rc, err := ReadResolvConf(path)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if rc.Nameserver != "10.96.0.10:53" {
+		t.Errorf("expected nameserver 10.96.0.10:53, but got %s", rc.Nameserver)
+	}
+	if !reflect.DeepEqual(rc.Search, []string{"default.svc.cluster.local", "svc.cluster.local"}) {
+		t.Errorf("unexpected search domains %v", rc.Search)
+	}
+}
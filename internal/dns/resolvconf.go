@@ -0,0 +1,43 @@
+package dns
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// ResolvConf contains the nameserver and search domains of a resolv.conf.
+type ResolvConf struct {
+	// Nameserver is the address (host:port) of the first nameserver.
+	Nameserver string
+	// Search contains the search domains.
+	Search []string
+}
+
+// ReadResolvConf will read the first nameserver and the search domains of
+// given resolv.conf file.
+func ReadResolvConf(path string) (*ResolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res := &ResolvConf{Search: []string{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if res.Nameserver == "" {
+				res.Nameserver = net.JoinHostPort(fields[1], "53")
+			}
+		case "search", "domain":
+			res.Search = append(res.Search, fields[1:]...)
+		}
+	}
+	return res, scanner.Err()
+}
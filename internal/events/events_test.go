@@ -26,6 +26,20 @@ func TestEvents(t *testing.T) {
 	events.Publish(msgid, Container, Die)
 }
 
+func TestPublishWithAttributes(t *testing.T) {
+	events := New()
+	el, id := events.Subscribe()
+	defer events.Unsubscribe(id)
+	go events.PublishWithAttributes("1234-5678", Container, Error, map[string]string{"reason": "ImagePullBackOff"})
+	msg := <-el
+	if msg.Action != Error {
+		t.Errorf("invalid action %s - expected %s", msg.Action, Error)
+	}
+	if msg.Attributes["reason"] != "ImagePullBackOff" {
+		t.Errorf("invalid attributes %v", msg.Attributes)
+	}
+}
+
 func TestMatch(t *testing.T) {
 	tests := []struct {
 		filter string
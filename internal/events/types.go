@@ -2,11 +2,12 @@ package events
 
 // Message is the structure that defines the details of the event.
 type Message struct {
-	ID       string
-	Type     string
-	Action   string
-	Time     int64
-	TimeNano int64
+	ID         string
+	Type       string
+	Action     string
+	Attributes map[string]string
+	Time       int64
+	TimeNano   int64
 }
 
 const (
@@ -14,6 +15,8 @@ const (
 	Image = "image"
 	// Container defines the event/filter type container
 	Container = "container"
+	// Network defines the event/filter type network
+	Network = "network"
 	// Type defines the filter type Type
 	Type = "type"
 	// Create defines the event action create (container)
@@ -26,4 +29,11 @@ const (
 	Detach = "detach"
 	// Pull defines the event action image (container)
 	Pull = "pull"
+	// Connect defines the event action connect (network)
+	Connect = "connect"
+	// Disconnect defines the event action disconnect (network)
+	Disconnect = "disconnect"
+	// Error defines the event action error (container), which is published
+	// when kubernetes fails to start the container
+	Error = "error"
 )
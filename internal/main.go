@@ -3,22 +3,24 @@ package internal
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/viper"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/leaderelection"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
 	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/dns"
+	"github.com/joyrex2001/kubedock/internal/model"
+	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/reaper"
 	"github.com/joyrex2001/kubedock/internal/server"
 	"github.com/joyrex2001/kubedock/internal/util/myip"
@@ -26,6 +28,11 @@ import (
 
 // Main is the main entry point for starting this service.
 func Main() {
+	if id := viper.GetString("instance-id"); id != "" {
+		config.SetInstanceID(id)
+	} else if viper.GetBool("adopt") {
+		klog.Fatalf("adopt requires an explicit --instance-id, otherwise the kept resources can't be adopted")
+	}
 	klog.Infof("%s / kubedock.id=%s", config.VersionString(), config.InstanceID)
 
 	cfg, err := config.GetKubernetes()
@@ -38,54 +45,58 @@ func Main() {
 		klog.Fatalf("error instantiating kubernetes client: %s", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// check if this instance runs in its own namespace, if so, create it
+	// based on the template namespace (defaults to the configured namespace)
+	ephemeral := viper.GetBool("ephemeral-namespace")
+	if ephemeral {
+		tmpl := viper.GetString("kubernetes.namespace-template")
+		if tmpl == "" {
+			tmpl = viper.GetString("kubernetes.namespace")
+		}
+		ns, err := createEphemeralNamespace(cli, tmpl, getImagePullSecrets())
+		if err != nil {
+			klog.Fatalf("error creating ephemeral namespace: %s", err)
+		}
+		klog.Infof("created ephemeral namespace %s from template %s", ns, tmpl)
+		viper.Set("kubernetes.namespace", ns)
+	}
+
+	// check if this instance requires locking of the namespace, if so,
+	// acquire the lock on the (first free) namespace before starting
+	runctx := ctx
+	if ephemeral && (viper.GetBool("lock.enabled") || isNamespacePool()) {
+		klog.Info("ignoring namespace locking, as an ephemeral namespace is used")
+	} else if viper.GetBool("lock.enabled") || isNamespacePool() {
+		if viper.GetBool("replicas") {
+			klog.Warning("namespace locking enabled, only one replica will be active")
+		}
+		namespaces, err := getNamespacePool(cli)
+		if err != nil {
+			klog.Fatalf("error retrieving namespaces to lock: %s", err)
+		}
+		ready := lockTimeoutHandler()
+		ns, lctx := acquireNamespace(ctx, cli, namespaces)
+		ready <- struct{}{}
+		klog.Infof("acquired lock on namespace %s", ns)
+		viper.Set("kubernetes.namespace", ns)
+		runctx = lctx
+	}
+
 	kub, err := getBackend(cfg, cli)
 	if err != nil {
 		klog.Fatalf("error instantiating backend: %s", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	exitHandler(kub, cancel)
-
-	// check if this instance requires locking of the namespace, if not
-	// just start the show...
-	if !viper.GetBool("lock.enabled") {
-		run(ctx, kub)
-		select {}
-	}
-
-	// exclusive mode, use the k8s leader election as a locking mechanism
-	lock := &resourcelock.LeaseLock{
-		LeaseMeta: metav1.ObjectMeta{
-			Name:      "kubedock-lock",
-			Namespace: viper.GetString("kubernetes.namespace"),
-		},
-		Client: cli.CoordinationV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity: config.InstanceID,
-		},
-	}
-
-	ready := lockTimeoutHandler()
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-		Lock:            lock,
-		ReleaseOnCancel: true,
-		LeaseDuration:   60 * time.Second,
-		RenewDeadline:   15 * time.Second,
-		RetryPeriod:     5 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-				ready <- struct{}{}
-				run(ctx, kub)
-			},
-			OnStoppedLeading: func() {
-				klog.V(3).Infof("lost lock on namespace %s", viper.GetString("kubernetes.namespace"))
-			},
-			OnNewLeader: func(identity string) {
-				klog.V(3).Infof("new leader elected: %s", identity)
-			},
-		},
-	})
+	if err := initStore(cli, kub); err != nil {
+		klog.Fatalf("error instantiating state store: %s", err)
+	}
+
+	exitHandler(kub, cli, cancel)
+
+	run(runctx, kub)
 	select {}
 }
 
@@ -97,8 +108,27 @@ func getBackend(cfg *rest.Config, cli kubernetes.Interface) (backend.Backend, er
 	disdind := viper.GetBool("kubernetes.disable-dind")
 	timeout := viper.GetDuration("kubernetes.timeout")
 	podtmpl := viper.GetString("kubernetes.pod-template")
+	podptch := viper.GetString("kubernetes.pod-patch")
+	jobttl := viper.GetDuration("kubernetes.job-ttl")
 	imgpsr := strings.ReplaceAll(viper.GetString("kubernetes.image-pull-secrets"), " ", "")
 	dissvcs := viper.GetBool("disable-services")
+	netpols := viper.GetBool("network-policies")
+	expose := viper.GetString("expose")
+	exphost := viper.GetString("expose-host")
+	ingcls := viper.GetString("ingress-class")
+	bindip := viper.GetString("proxy-bind-ip")
+	hostps, err := getHostPorts()
+	if err != nil {
+		return nil, err
+	}
+	dnssrv, dnssrch, err := getDNSConfig()
+	if err != nil {
+		return nil, err
+	}
+	netsvcs, err := getNetworkScopedServices(dnssrv)
+	if err != nil {
+		return nil, err
+	}
 
 	optlog := ""
 	imgps := []string{}
@@ -111,6 +141,27 @@ func getBackend(cfg *rest.Config, cli kubernetes.Interface) (backend.Backend, er
 	if disdind {
 		klog.Infof("docker-in-docker support disabled")
 	}
+	if netpols {
+		klog.Infof("isolating networks with network policies")
+	}
+	if netsvcs {
+		klog.Infof("creating network scoped services for network aliases")
+	}
+	if bindip != "" && net.ParseIP(bindip) == nil {
+		return nil, fmt.Errorf("invalid proxy bind ip %s", bindip)
+	}
+	if err := checkWorkload(); err != nil {
+		return nil, err
+	}
+	switch expose {
+	case "", backend.ExposeLoadBalancer:
+	case backend.ExposeNodePort, backend.ExposeIngress:
+		if exphost == "" {
+			return nil, fmt.Errorf("exposing containers via %s requires --expose-host", expose)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported expose mode %s", expose)
+	}
 
 	kuburl, err := getKubedockURL()
 	if err != nil {
@@ -119,20 +170,165 @@ func getBackend(cfg *rest.Config, cli kubernetes.Interface) (backend.Backend, er
 	klog.V(3).Infof("kubedock url: %s", kuburl)
 
 	return backend.New(backend.Config{
-		Client:           cli,
-		RestConfig:       cfg,
-		Namespace:        ns,
-		InitImage:        initimg,
-		DindImage:        dindimg,
-		DisableDind:      disdind,
-		ImagePullSecrets: imgps,
-		PodTemplate:      podtmpl,
-		KubedockURL:      kuburl,
-		TimeOut:          timeout,
-		DisableServices:  dissvcs,
+		Client:                cli,
+		RestConfig:            cfg,
+		Namespace:             ns,
+		InitImage:             initimg,
+		DindImage:             dindimg,
+		DisableDind:           disdind,
+		ImagePullSecrets:      imgps,
+		PodTemplate:           podtmpl,
+		PodPatch:              podptch,
+		JobTTL:                jobttl,
+		KubedockURL:           kuburl,
+		TimeOut:               timeout,
+		DisableServices:       dissvcs,
+		NetworkPolicies:       netpols,
+		NetworkScopedServices: netsvcs,
+		Expose:                expose,
+		ExposeHost:            exphost,
+		IngressClass:          ingcls,
+		ProxyBindIP:           bindip,
+		HostPorts:             hostps,
+		DNSServer:             dnssrv,
+		DNSSearches:           dnssrch,
 	})
 }
 
+// initStore will configure the optional durable store of the database,
+// which is either a local file (file:path), or a secret in the namespace
+// (secret:name).
+func initStore(cli kubernetes.Interface, kub backend.Backend) error {
+	uri := viper.GetString("state-store")
+	if uri == "" {
+		return nil
+	}
+	var store model.Store
+	switch {
+	case strings.HasPrefix(uri, "file:"):
+		store = model.NewFileStore(strings.TrimPrefix(uri, "file:"))
+	case strings.HasPrefix(uri, "secret:"):
+		store = model.NewSecretStore(cli, viper.GetString("kubernetes.namespace"), strings.TrimPrefix(uri, "secret:"))
+	default:
+		return fmt.Errorf("unsupported state store %s, expected file:path or secret:name", uri)
+	}
+	db, err := model.New()
+	if err != nil {
+		return err
+	}
+	klog.Infof("using state store: %s", uri)
+	if err := db.UseStore(store); err != nil {
+		return err
+	}
+	return reconcileStore(db, kub)
+}
+
+// reconcileStore will update the state of the restored running containers
+// with the state of their pods, as these may have been stopped or deleted
+// while kubedock was not running.
+func reconcileStore(db *model.Database, kub backend.Backend) error {
+	tainrs, err := db.GetContainers()
+	if err != nil {
+		return err
+	}
+	for _, tainr := range tainrs {
+		if !tainr.Running {
+			continue
+		}
+		state, err := kub.GetContainerStatus(tainr)
+		if state != backend.DeployFailed && state != backend.DeployCompleted {
+			continue
+		}
+		if err != nil {
+			klog.V(2).Infof("restored container %s failed: %s", tainr.ShortID, err)
+		}
+		cp := *tainr
+		cp.Running = false
+		cp.Completed = (state == backend.DeployCompleted)
+		cp.Failed = !cp.Completed
+		cp.Finished = time.Now()
+		if err := db.SaveContainer(&cp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWorkload will check if the configured default workload is supported.
+func checkWorkload() error {
+	switch w := strings.ToLower(viper.GetString("kubernetes.workload")); w {
+	case "", types.WorkloadPod, types.WorkloadJob:
+		return nil
+	default:
+		return fmt.Errorf("unsupported workload %s, expected %s or %s", w, types.WorkloadPod, types.WorkloadJob)
+	}
+}
+
+// getHostPorts will return the ports on the kubedock host that should be
+// reachable from the containers via the host tunnel.
+func getHostPorts() ([]int, error) {
+	ports := []int{}
+	for _, p := range strings.Split(strings.ReplaceAll(viper.GetString("host-ports"), " ", ""), ",") {
+		if p == "" {
+			continue
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid host port %s", p)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// getDNSConfig will return the ip of the embedded dns server, and the search
+// domains of kubedock itself, if the dns server should be configured as the
+// nameserver of the deployed pods.
+func getDNSConfig() (string, []string, error) {
+	if !viper.GetBool("dns") || !viper.GetBool("dns-inject") {
+		return "", nil, nil
+	}
+	if addr := viper.GetString("dns-listen-addr"); addr != "" {
+		if _, port, err := net.SplitHostPort(addr); err != nil || port != "53" {
+			return "", nil, fmt.Errorf("dns-inject requires the dns server to listen on port 53")
+		}
+	}
+	ip := viper.GetString("dns-advertise-ip")
+	if ip == "" && !config.InCluster() {
+		return "", nil, fmt.Errorf("dns-inject requires dns-advertise-ip when kubedock runs outside the cluster")
+	}
+	if ip == "" {
+		var err error
+		if ip, err = myip.Get(); err != nil {
+			return "", nil, err
+		}
+	}
+	if net.ParseIP(ip) == nil {
+		return "", nil, fmt.Errorf("invalid dns advertise ip %s", ip)
+	}
+	searches := []string{}
+	if rc, err := dns.ReadResolvConf("/etc/resolv.conf"); err == nil {
+		searches = rc.Search
+	}
+	klog.Infof("using embedded dns server %s as nameserver of pods", ip)
+	return ip, searches, nil
+}
+
+// getNetworkScopedServices will return if the services of network aliases
+// should be created per network. The host aliases that point to these
+// services are only set when a pod is created, hence the aliases of
+// containers that are started later are resolved via the embedded dns
+// server, which is required to be configured as nameserver of the pods.
+func getNetworkScopedServices(dnssrv string) (bool, error) {
+	if !viper.GetBool("network-scoped-services") || viper.GetBool("disable-services") {
+		return false, nil
+	}
+	if dnssrv == "" {
+		return false, fmt.Errorf("network-scoped-services requires the embedded dns server to be enabled with dns and dns-inject")
+	}
+	return true, nil
+}
+
 // getKubedockURL returns the uri that can be used externally to reach
 // this kubedock instance.
 func getKubedockURL() (string, error) {
@@ -171,19 +367,49 @@ func run(ctx context.Context, kub backend.Backend) {
 	}
 	rpr.Start()
 
-	if viper.GetBool("prune-start") {
+	if viper.GetBool("prune-start") && viper.GetBool("adopt") {
+		klog.Info("ignoring prune-start, as existing resources will be adopted")
+	} else if viper.GetBool("prune-start") {
 		klog.Info("pruning all existing kubedock resources from namespace")
 		if err := kub.DeleteAll(); err != nil {
 			klog.Errorf("error pruning resources: %s", err)
 		}
 	}
 
+	if viper.GetBool("replicas") {
+		registerReplica(ctx, kub)
+	}
+
 	svr := server.New(kub)
 	if err := svr.Run(ctx); err != nil {
 		klog.Errorf("error instantiating server: %s", err)
 	}
 }
 
+// registerReplica will advertise this instance to the other kubedock
+// replicas in the namespace, and keeps renewing this until the given
+// context is done.
+func registerReplica(ctx context.Context, kub backend.Backend) {
+	klog.Infof("registering kubedock.id=%s as replica", config.InstanceID)
+	if err := kub.RegisterReplica(); err != nil {
+		klog.Errorf("error registering replica: %s", err)
+	}
+	go func() {
+		tmr := time.NewTicker(20 * time.Second)
+		defer tmr.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tmr.C:
+				if err := kub.RegisterReplica(); err != nil {
+					klog.Errorf("error renewing replica registration: %s", err)
+				}
+			}
+		}
+	}()
+}
+
 // lockTimeoutHandler will wait until the return channel recieved a message,
 // if this is not done within configured lock.timeout, it will exit the
 // process.
@@ -206,7 +432,7 @@ func lockTimeoutHandler() chan struct{} {
 }
 
 // exitHandler will clean up resources before actually stopping kubedock.
-func exitHandler(kub backend.Backend, cancel context.CancelFunc) {
+func exitHandler(kub backend.Backend, cli kubernetes.Interface, cancel context.CancelFunc) {
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc,
 		syscall.SIGINT,
@@ -215,6 +441,23 @@ func exitHandler(kub backend.Backend, cancel context.CancelFunc) {
 	go func() {
 		c := getExitCode(<-sigc)
 		cancel()
+		if db, err := model.New(); err == nil {
+			if err := db.Flush(); err != nil {
+				klog.Errorf("error persisting state: %s", err)
+			}
+		}
+		if viper.GetBool("adopt") {
+			klog.Info("exit signal recieved, keeping resources to be adopted")
+			os.Exit(c)
+		}
+		if viper.GetBool("ephemeral-namespace") {
+			ns := viper.GetString("kubernetes.namespace")
+			klog.Infof("exit signal recieved, removing namespace %s", ns)
+			if err := deleteEphemeralNamespace(cli, ns); err != nil {
+				klog.Errorf("error removing namespace: %s", err)
+			}
+			os.Exit(c)
+		}
 		klog.Info("exit signal recieved, removing pods, configmaps and services")
 		if err := kub.DeleteWithKubedockID(config.InstanceID); err != nil {
 			klog.Errorf("error pruning resources: %s", err)
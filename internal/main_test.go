@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -8,6 +9,14 @@ import (
 	"github.com/spf13/viper"
 )
 
+// setConfig will set given configuration key for the duration of the
+// test, and restores the previous value afterwards.
+func setConfig(t *testing.T, key string, val interface{}) {
+	old := viper.Get(key)
+	t.Cleanup(func() { viper.Set(key, old) })
+	viper.Set(key, val)
+}
+
 func TestGetKubedockURL(t *testing.T) {
 	tests := []struct {
 		listen string
@@ -22,8 +31,8 @@ func TestGetKubedockURL(t *testing.T) {
 
 	ip, _ := myip.Get()
 	for i, tst := range tests {
-		viper.Set("server.listen-addr", tst.listen)
-		viper.Set("server.tls-enable", tst.tls)
+		setConfig(t, "server.listen-addr", tst.listen)
+		setConfig(t, "server.tls-enable", tst.tls)
 		res, err := getKubedockURL()
 		if tst.suc && err != nil {
 			t.Errorf("failed test %d - unexpected error %s", i, err)
@@ -37,3 +46,116 @@ func TestGetKubedockURL(t *testing.T) {
 		}
 	}
 }
+
+func TestGetHostPorts(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []int
+		suc bool
+	}{
+		{"", []int{}, true},                     // 0
+		{"8080", []int{8080}, true},             // 1
+		{"8080, 5432", []int{8080, 5432}, true}, // 2
+		{"8080,tb303", nil, false},              // 3
+		{"65536", nil, false},                   // 4
+	}
+	for i, tst := range tests {
+		setConfig(t, "host-ports", tst.in)
+		res, err := getHostPorts()
+		if tst.suc && err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if !tst.suc && err == nil {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestCheckWorkload(t *testing.T) {
+	tests := []struct {
+		in  string
+		suc bool
+	}{
+		{"", true},     // 0
+		{"pod", true},  // 1
+		{"Job", true},  // 2
+		{"jbo", false}, // 3
+	}
+	for i, tst := range tests {
+		setConfig(t, "kubernetes.workload", tst.in)
+		err := checkWorkload()
+		if tst.suc && err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if !tst.suc && err == nil {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+	}
+}
+
+func TestGetNetworkScopedServices(t *testing.T) {
+	tests := []struct {
+		netsvcs bool
+		dissvcs bool
+		dnssrv  string
+		out     bool
+		suc     bool
+	}{
+		{false, false, "", false, true},          // 0
+		{true, false, "", false, false},          // 1
+		{true, false, "10.0.0.53", true, true},   // 2
+		{true, true, "", false, true},            // 3
+		{false, false, "10.0.0.53", false, true}, // 4
+	}
+	for i, tst := range tests {
+		setConfig(t, "network-scoped-services", tst.netsvcs)
+		setConfig(t, "disable-services", tst.dissvcs)
+		res, err := getNetworkScopedServices(tst.dnssrv)
+		if tst.suc && err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if !tst.suc && err == nil {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+		if res != tst.out {
+			t.Errorf("failed test %d - expected %t, but got %t", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetDNSConfig(t *testing.T) {
+	tests := []struct {
+		dns    bool
+		listen string
+		ip     string
+		out    string
+		suc    bool
+	}{
+		{false, "", "", "", true},                     // 0
+		{true, "", "", "", false},                     // 1
+		{true, "", "10.0.0.53", "10.0.0.53", true},    // 2
+		{true, ":53", "10.0.0.53", "10.0.0.53", true}, // 3
+		{true, ":5353", "10.0.0.53", "", false},       // 4
+		{true, "", "tb303", "", false},                // 5
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	for i, tst := range tests {
+		setConfig(t, "dns", tst.dns)
+		setConfig(t, "dns-inject", true)
+		setConfig(t, "dns-listen-addr", tst.listen)
+		setConfig(t, "dns-advertise-ip", tst.ip)
+		res, _, err := getDNSConfig()
+		if tst.suc && err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if !tst.suc && err == nil {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+		if res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+}
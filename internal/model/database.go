@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -14,7 +15,12 @@ import (
 
 // Database is the object contains the in-memory database.
 type Database struct {
-	db *memdb.MemDB
+	db      *memdb.MemDB
+	mu      sync.Mutex
+	wmu     sync.Mutex
+	store   Store
+	records map[string]map[string]json.RawMessage
+	dirty   chan struct{}
 }
 
 var instance *Database
@@ -434,25 +440,35 @@ func (in *Database) DeleteImage(img *types.Image) error {
 }
 
 // save is a generic save method to store or update a record in the
-// database.
+// database. The change is written to the store, if configured.
 func (in *Database) save(table string, rec interface{}) error {
+	dat, err := in.encode(rec)
+	if err != nil {
+		return err
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
 	txn := in.db.Txn(true)
 	if err := txn.Insert(table, rec); err != nil {
 		txn.Abort()
 		return err
 	}
 	txn.Commit()
+	in.track(table, rec, dat)
 	return nil
 }
 
 // delete is a generic delete method to remove a record from the
-// database.
+// database. The change is written to the store, if configured.
 func (in *Database) delete(table string, rec interface{}) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
 	txn := in.db.Txn(true)
 	if err := txn.Delete(table, rec); err != nil {
 		txn.Abort()
 		return err
 	}
 	txn.Commit()
+	in.track(table, rec, nil)
 	return nil
 }
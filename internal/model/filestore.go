@@ -0,0 +1,50 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// FileStore is a Store that persists the snapshot as json in a local file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore will return a FileStore that persists to given path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load will read the snapshot from the file, or return an empty snapshot
+// if the file does not exist yet.
+func (fs *FileStore) Load() (*Snapshot, error) {
+	snap := &Snapshot{}
+	dat, err := os.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return snap, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, json.Unmarshal(dat, snap)
+}
+
+// Save will write given json encoded snapshot to the file. The snapshot is
+// written to a temporary file first, which is renamed afterwards, so the
+// file is never left behind partially written.
+func (fs *FileStore) Save(dat []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(dat); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+const (
+	// secretKey is the key in the secret that contains the snapshot.
+	secretKey = "state.json"
+	// annotationHolder is the annotation of the secret that contains the
+	// id of the kubedock instance that wrote the snapshot.
+	annotationHolder = "kubedock.holder"
+)
+
+// SecretStore is a Store that persists the snapshot as json in a secret
+// in the namespace. A secret is used, as the snapshot contains the
+// environment of the containers.
+type SecretStore struct {
+	cli       kubernetes.Interface
+	namespace string
+	name      string
+	holder    string
+	exists    bool
+	version   string
+}
+
+// NewSecretStore will return a SecretStore that persists to the secret
+// with given name in given namespace.
+func NewSecretStore(cli kubernetes.Interface, namespace, name string) *SecretStore {
+	return &SecretStore{cli: cli, namespace: namespace, name: name, holder: config.InstanceID}
+}
+
+// Load will read the snapshot from the secret, or return an empty
+// snapshot if the secret does not exist yet. The resource version of the
+// secret is kept, so subsequent saves fail if the secret was modified by
+// another kubedock instance.
+func (ss *SecretStore) Load() (*Snapshot, error) {
+	snap := &Snapshot{}
+	sec, err := ss.cli.CoreV1().Secrets(ss.namespace).Get(context.Background(), ss.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return snap, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ss.exists = true
+	ss.version = sec.ResourceVersion
+	dat, ok := sec.Data[secretKey]
+	if !ok {
+		return snap, nil
+	}
+	return snap, json.Unmarshal(dat, snap)
+}
+
+// Save will write given json encoded snapshot to the secret, and creates
+// the secret if it doesn't exist yet. The secret is deliberately not
+// labeled with kubedock=true, so it's not removed by reaping or pruning.
+// If the secret was modified since it was last read or written, it's read
+// again, and the save is retried if it was written by this instance;
+// otherwise it fails.
+func (ss *SecretStore) Save(dat []byte) error {
+	err := ss.save(dat)
+	if !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	sec, err := ss.cli.CoreV1().Secrets(ss.namespace).Get(context.Background(), ss.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		ss.exists = false
+		ss.version = ""
+		return ss.save(dat)
+	}
+	if err != nil {
+		return err
+	}
+	if sec.Annotations[annotationHolder] != ss.holder {
+		return fmt.Errorf("state secret %s is modified by another kubedock instance", ss.name)
+	}
+	ss.exists = true
+	ss.version = sec.ResourceVersion
+	return ss.save(dat)
+}
+
+// save will create or update the secret with given json encoded snapshot,
+// using the last known resource version.
+func (ss *SecretStore) save(dat []byte) error {
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ss.name,
+			Namespace:       ss.namespace,
+			ResourceVersion: ss.version,
+			Annotations:     map[string]string{annotationHolder: ss.holder},
+		},
+		Data: map[string][]byte{secretKey: dat},
+	}
+	var err error
+	if ss.exists {
+		sec, err = ss.cli.CoreV1().Secrets(ss.namespace).Update(context.Background(), sec, metav1.UpdateOptions{})
+	} else {
+		sec, err = ss.cli.CoreV1().Secrets(ss.namespace).Create(context.Background(), sec, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	ss.exists = true
+	ss.version = sec.ResourceVersion
+	return nil
+}
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// storeDelay is the time that changes are collected before they are
+// written to the store at once.
+const storeDelay = 250 * time.Millisecond
+
+// Store is the interface of a durable store that persists the records
+// of the database, so they survive a restart of kubedock.
+type Store interface {
+	// Load will return the persisted records, or an empty snapshot if
+	// nothing was persisted yet.
+	Load() (*Snapshot, error)
+	// Save will persist given json encoded snapshot, replacing the
+	// previous snapshot.
+	Save([]byte) error
+}
+
+// Snapshot contains all records of the database at a specific moment.
+type Snapshot struct {
+	Containers []*types.Container
+	Execs      []*types.Exec
+	Networks   []*types.Network
+	Images     []*types.Image
+}
+
+// UseStore will load the records that are persisted in given store into
+// the database, and will write all subsequent changes to it.
+func (in *Database) UseStore(store Store) error {
+	snap, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if err := in.restore(snap); err != nil {
+		return err
+	}
+	recs, err := in.encodeAll()
+	if err != nil {
+		return err
+	}
+	in.mu.Lock()
+	in.store = store
+	in.records = recs
+	in.dirty = make(chan struct{}, 1)
+	in.mu.Unlock()
+	go in.writer()
+	return nil
+}
+
+// Flush will write the current records to the store, if a store is
+// configured.
+func (in *Database) Flush() error {
+	in.wmu.Lock()
+	defer in.wmu.Unlock()
+	in.mu.Lock()
+	store := in.store
+	snap := map[string][]json.RawMessage{}
+	for table, recs := range in.records {
+		key := snapshotKeys[table]
+		snap[key] = []json.RawMessage{}
+		for _, rec := range recs {
+			snap[key] = append(snap[key], rec)
+		}
+	}
+	in.mu.Unlock()
+	if store == nil {
+		return nil
+	}
+	dat, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return store.Save(dat)
+}
+
+// snapshotKeys maps the tables to the matching fields in the Snapshot.
+var snapshotKeys = map[string]string{
+	"container": "Containers",
+	"exec":      "Execs",
+	"network":   "Networks",
+	"image":     "Images",
+}
+
+// writer will write the records to the store when they changed. Changes
+// are collected for a short while, so a burst of changes results in a
+// single write. If writing fails, the next change will try again.
+func (in *Database) writer() {
+	for range in.dirty {
+		time.Sleep(storeDelay)
+		if err := in.Flush(); err != nil {
+			klog.Errorf("error persisting state: %s", err)
+		}
+	}
+}
+
+// encode will return a json encoded copy of given record, if a store is
+// configured. The copy is made when the record is saved, so the store
+// is never written while handlers are modifying the record.
+func (in *Database) encode(rec interface{}) (json.RawMessage, error) {
+	in.mu.Lock()
+	store := in.store
+	in.mu.Unlock()
+	if store == nil {
+		return nil, nil
+	}
+	return json.Marshal(rec)
+}
+
+// track will register the json encoded copy of given record (or remove
+// it if dat is nil) and signal the writer, if a store is configured. This
+// should be called while holding the lock.
+func (in *Database) track(table string, rec interface{}, dat json.RawMessage) {
+	if in.store == nil {
+		return
+	}
+	if in.records[table] == nil {
+		in.records[table] = map[string]json.RawMessage{}
+	}
+	id := recordID(rec)
+	if dat == nil {
+		delete(in.records[table], id)
+	} else {
+		in.records[table][id] = dat
+	}
+	select {
+	case in.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// recordID will return the id of given record.
+func recordID(rec interface{}) string {
+	switch rec := rec.(type) {
+	case *types.Container:
+		return rec.ID
+	case *types.Exec:
+		return rec.ID
+	case *types.Network:
+		return rec.ID
+	case *types.Image:
+		return rec.ID
+	}
+	panic(fmt.Sprintf("unsupported record type %T", rec))
+}
+
+// restore will insert all records of given snapshot into the database. As
+// the predefined networks get a new id on each start, these are replaced
+// by the persisted ones.
+func (in *Database) restore(snap *Snapshot) error {
+	txn := in.db.Txn(true)
+	defer txn.Abort()
+	for _, netw := range snap.Networks {
+		raw, err := txn.First("network", "name", netw.Name)
+		if err != nil {
+			return err
+		}
+		if raw != nil {
+			if err := txn.Delete("network", raw); err != nil {
+				return err
+			}
+		}
+		if err := txn.Insert("network", netw); err != nil {
+			return err
+		}
+	}
+	for _, con := range snap.Containers {
+		if err := txn.Insert("container", con); err != nil {
+			return err
+		}
+	}
+	for _, exc := range snap.Execs {
+		if err := txn.Insert("exec", exc); err != nil {
+			return err
+		}
+	}
+	for _, img := range snap.Images {
+		if err := txn.Insert("image", img); err != nil {
+			return err
+		}
+	}
+	txn.Commit()
+	return nil
+}
+
+// encodeAll will return json encoded copies of all records that are
+// currently in the database.
+func (in *Database) encodeAll() (map[string]map[string]json.RawMessage, error) {
+	res := map[string]map[string]json.RawMessage{}
+	txn := in.db.Txn(false)
+	defer txn.Abort()
+	for table := range snapshotKeys {
+		res[table] = map[string]json.RawMessage{}
+		it, err := txn.Get(table, "id")
+		if err != nil {
+			return nil, err
+		}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			dat, err := json.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			res[table][recordID(obj)] = dat
+		}
+	}
+	return res, nil
+}
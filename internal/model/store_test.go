@@ -0,0 +1,162 @@
+package model
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	db := &Database{}
+	mdb, err := db.createSchema()
+	if err != nil {
+		t.Fatalf("Unexpected error creating database: %s", err)
+	}
+	db.db = mdb
+	db.loadDefaults()
+	return db
+}
+
+func TestStore(t *testing.T) {
+	stores := []Store{
+		NewFileStore(filepath.Join(t.TempDir(), "state.json")),
+		NewSecretStore(fake.NewSimpleClientset(), "default", "kubedock-state"),
+	}
+	for i, store := range stores {
+		db := newTestDatabase(t)
+		if err := db.UseStore(store); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		bridge, _ := db.GetNetworkByName("bridge")
+		netw := &types.Network{Name: "tb303"}
+		if err := db.SaveNetwork(netw); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		con := &types.Container{Name: "f1spirit", Networks: map[string]interface{}{netw.ID: nil}}
+		if err := db.SaveContainer(con); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		tmp := &types.Container{Name: "deleted"}
+		if err := db.SaveContainer(tmp); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := db.DeleteContainer(tmp); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := db.SaveImage(&types.Image{Name: "alpine:3"}); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := db.SaveExec(&types.Exec{ContainerID: con.ID}); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		con.Name = "modified"
+		if err := db.Flush(); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+
+		restored := newTestDatabase(t)
+		if err := restored.UseStore(store); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if c, err := restored.GetContainer(con.ID); err != nil || c.Name != "f1spirit" {
+			t.Errorf("failed test %d - expected container to be restored as saved", i)
+		}
+		if _, err := restored.GetContainer(tmp.ID); err == nil {
+			t.Errorf("failed test %d - expected deleted container not to be restored", i)
+		}
+		if _, err := restored.GetNetwork(netw.ID); err != nil {
+			t.Errorf("failed test %d - expected network to be restored", i)
+		}
+		if nw, err := restored.GetNetworkByName("bridge"); err != nil || nw.ID != bridge.ID {
+			t.Errorf("failed test %d - expected predefined bridge network to be restored with id %s", i, bridge.ID)
+		}
+		netws, _ := restored.GetNetworks()
+		if len(netws) != 4 {
+			t.Errorf("failed test %d - expected 4 networks, but got %d", i, len(netws))
+		}
+		if imgs, _ := restored.GetImages(); len(imgs) != 1 {
+			t.Errorf("failed test %d - expected 1 image, but got %d", i, len(imgs))
+		}
+		if excs, _ := restored.GetExecs(); len(excs) != 1 {
+			t.Errorf("failed test %d - expected 1 exec, but got %d", i, len(excs))
+		}
+	}
+}
+
+func TestStoreDeadlock(t *testing.T) {
+	db := newTestDatabase(t)
+	store := NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	if err := db.UseStore(store); err != nil {
+		t.Errorf("Unexpected error using store: %s", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				con := &types.Container{}
+				if err := db.SaveContainer(con); err != nil {
+					t.Errorf("Unexpected error when creating a new container: %s", err)
+				}
+				if err := db.DeleteContainer(con); err != nil {
+					t.Errorf("Unexpected error when deleting container: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := db.Flush(); err != nil {
+		t.Errorf("Unexpected error flushing store: %s", err)
+	}
+	snap, err := store.Load()
+	if err != nil {
+		t.Errorf("Unexpected error loading store: %s", err)
+	}
+	if len(snap.Containers) != 0 {
+		t.Errorf("Expected no persisted containers, but got %d", len(snap.Containers))
+	}
+}
+
+func TestSecretStoreConflict(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+	store := NewSecretStore(cli, "default", "kubedock-state")
+	if _, err := store.Load(); err != nil {
+		t.Errorf("Unexpected error loading store: %s", err)
+	}
+	other := NewSecretStore(cli, "default", "kubedock-state")
+	other.holder = "other"
+	if _, err := other.Load(); err != nil {
+		t.Errorf("Unexpected error loading store: %s", err)
+	}
+	if err := other.Save([]byte("{}")); err != nil {
+		t.Errorf("Unexpected error saving store: %s", err)
+	}
+	if err := store.Save([]byte("{}")); err == nil {
+		t.Errorf("Expected error when secret was created by another instance")
+	}
+}
+
+func TestSecretStoreStaleVersion(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+	store := NewSecretStore(cli, "default", "kubedock-state")
+	if _, err := store.Load(); err != nil {
+		t.Errorf("Unexpected error loading store: %s", err)
+	}
+	// another store of the same instance (e.g. an adopted instance) writes
+	// the secret, which makes the version of the first store stale
+	same := NewSecretStore(cli, "default", "kubedock-state")
+	if err := same.Save([]byte("{}")); err != nil {
+		t.Errorf("Unexpected error saving store: %s", err)
+	}
+	if err := store.Save([]byte("{}")); err != nil {
+		t.Errorf("Unexpected error saving store with stale version: %s", err)
+	}
+	if err := store.Save([]byte("{}")); err != nil {
+		t.Errorf("Unexpected error saving store after refresh: %s", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"regexp"
 	"strconv"
@@ -23,31 +24,51 @@ type Container struct {
 	Name           string
 	Hostname       string
 	Image          string
+	Platform       string
 	Labels         map[string]string
 	Entrypoint     []string
 	Cmd            []string
 	Env            []string
 	Binds          []string
 	Mounts         []Mount
-	PreArchives    []PreArchive
+	PreArchives    []PreArchive `json:"-"`
 	HostIP         string
+	PodIP          string
 	ExposedPorts   map[string]interface{}
 	ImagePorts     map[string]interface{}
 	HostPorts      map[int]int
 	MappedPorts    map[int]int
+	UDPHostPorts   map[int]int
+	UDPMappedPorts map[int]int
+	// IngressHosts contains the external hostnames of the container ports
+	// that are exposed via an ingress, indexed by container port.
+	IngressHosts map[int]string
+	// BindIPs contains the host ips that were requested in the port
+	// bindings, indexed by host port (e.g. 8080/tcp), or by the negative
+	// container port if no host port was requested (e.g. -80/tcp).
+	BindIPs map[string]string
+	// ListenIPs contains the ips on which the port-forwards and reverse
+	// proxies are listening, indexed by host port (e.g. 8080/tcp).
+	ListenIPs      map[string]string
 	Networks       map[string]interface{}
 	NetworkAliases []string
-	StopChannels   []chan struct{}
-	AttachChannels []chan struct{}
-	Running        bool
-	Completed      bool
-	Failed         bool
-	Stopped        bool
-	Killed         bool
-	Tty            bool
-	OpenStdin      bool
-	Created        time.Time
-	Finished       time.Time
+	// ExtraHosts contains the additional hostnames of the container, in the
+	// form host:ip.
+	ExtraHosts []string
+	// EndpointAliases contains the network aliases that were added when
+	// connecting to a network, indexed by network id.
+	EndpointAliases map[string][]string
+	StopChannels    []chan struct{} `json:"-"`
+	AttachChannels  []chan struct{} `json:"-"`
+	Running         bool
+	Completed       bool
+	Failed          bool
+	Stopped         bool
+	Killed          bool
+	Tty             bool
+	OpenStdin       bool
+	Created         time.Time
+	Finished        time.Time
 }
 
 // PreArchive contains the path and contents of archives (tar) that need to be
@@ -87,6 +108,43 @@ const (
 	LabelNodeSelector = "com.joyrex2001.kubedock.node-selector"
 	// LabelActiveDeadlineSeconds is the label to be used to specify active deadline in seconds
 	LabelActiveDeadlineSeconds = "com.joyrex2001.kubedock.active-deadline-seconds"
+	// LabelTolerations is a comma-separated list of key[=value][:effect] tolerations
+	LabelTolerations = "com.joyrex2001.kubedock.tolerations"
+	// LabelNodeAffinity is a label selector expression used as required node affinity
+	LabelNodeAffinity = "com.joyrex2001.kubedock.node-affinity"
+	// LabelPodAntiAffinity is a label selector (optionally with @topologyKey) of pods
+	// that should not be co-located with the container
+	LabelPodAntiAffinity = "com.joyrex2001.kubedock.pod-anti-affinity"
+	// LabelPriorityClass is the label to be used to specify the priority class name
+	LabelPriorityClass = "com.joyrex2001.kubedock.priority-class"
+	// LabelRuntimeClass is the label to be used to specify the runtime class name
+	LabelRuntimeClass = "com.joyrex2001.kubedock.runtime-class"
+	// LabelTopologySpread is a comma-separated list of topologyKey[:maxSkew[:whenUnsatisfiable]]
+	// topology spread constraints
+	LabelTopologySpread = "com.joyrex2001.kubedock.topology-spread"
+	// LabelPodAnnotationPrefix is the prefix of labels that should be added as
+	// annotations (without the prefix) to the created pod, services and configmaps
+	LabelPodAnnotationPrefix = "com.joyrex2001.kubedock.pod-annotation/"
+	// LabelPodLabelPrefix is the prefix of labels that should be added as
+	// labels (without the prefix) to the created pod, services and configmaps
+	LabelPodLabelPrefix = "com.joyrex2001.kubedock.pod-label/"
+	// LabelPodPatch is the label to be used to specify a strategic merge or json
+	// patch for the created pod, either inline or as a reference to a configmap
+	// (configmap:name/key)
+	LabelPodPatch = "com.joyrex2001.kubedock.pod-patch"
+	// LabelWorkload is the label to be used to specify the workload type that
+	// is used to run the container (pod or job)
+	LabelWorkload = "com.joyrex2001.kubedock.workload"
+	// LabelExposeHTTP is a comma-separated list of container ports that serve
+	// http, and should be exposed via an ingress
+	LabelExposeHTTP = "com.joyrex2001.kubedock.expose-http"
+)
+
+const (
+	// WorkloadPod will run the container as a bare pod
+	WorkloadPod = "pod"
+	// WorkloadJob will run the container as a pod managed by a batch/v1 job
+	WorkloadJob = "job"
 )
 
 // GetEnvVar will return the environment variables of the container
@@ -175,10 +233,11 @@ func (co *Container) GetResourceRequirements(req corev1.ResourceRequirements) (c
 }
 
 // GetNodeSelector will return the node selector that should be applied
-// for this container.
+// for this container. If a platform is configured for the container, the
+// kubernetes.io/os and kubernetes.io/arch selectors are added as well.
 func (co *Container) GetNodeSelector(nodesel map[string]string) (map[string]string, error) {
 	selector := co.Labels[LabelNodeSelector]
-	if selector == "" {
+	if selector == "" && co.Platform == "" {
 		return nodesel, nil
 	}
 
@@ -186,12 +245,24 @@ func (co *Container) GetNodeSelector(nodesel map[string]string) (map[string]stri
 		nodesel = map[string]string{}
 	}
 
-	for _, s := range strings.Split(selector, ",") {
-		if k, v, err := splitNodeSelector(s); err == nil {
-			nodesel[k] = v
-		} else {
+	if selector != "" {
+		for _, s := range strings.Split(selector, ",") {
+			if k, v, err := splitNodeSelector(s); err == nil {
+				nodesel[k] = v
+			} else {
+				return nodesel, err
+			}
+		}
+	}
+
+	if co.Platform != "" {
+		pl, err := ParsePlatform(co.Platform)
+		if err != nil {
 			return nodesel, err
 		}
+		for k, v := range pl.NodeSelector() {
+			nodesel[k] = v
+		}
 	}
 
 	return nodesel, nil
@@ -235,6 +306,66 @@ func (co *Container) GetActiveDeadlineSeconds() (*int64, error) {
 	return nil, nil
 }
 
+// GetWorkload will return the workload type (WorkloadPod or WorkloadJob)
+// that should be used to run this container.
+func (co *Container) GetWorkload() (string, error) {
+	w := strings.ToLower(co.Labels[LabelWorkload])
+	switch w {
+	case "":
+		return WorkloadPod, nil
+	case WorkloadPod, WorkloadJob:
+		return w, nil
+	}
+	return WorkloadPod, fmt.Errorf("invalid workload: %s", co.Labels[LabelWorkload])
+}
+
+// GetHTTPPorts will return the container ports that serve http, and should
+// be exposed via an ingress.
+func (co *Container) GetHTTPPorts() (map[int]bool, error) {
+	res := map[int]bool{}
+	for _, p := range strings.Split(co.Labels[LabelExposeHTTP], ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid http port: %s", p)
+		}
+		res[port] = true
+	}
+	return res, nil
+}
+
+// IsJob will return true if the container should run as a job.
+func (co *Container) IsJob() bool {
+	w, _ := co.GetWorkload()
+	return w == WorkloadJob
+}
+
+// GetPodAnnotations will return the annotations that should be added to the
+// created k8s resources, as specified via the LabelPodAnnotationPrefix labels.
+func (co *Container) GetPodAnnotations() map[string]string {
+	return co.getPrefixedLabels(LabelPodAnnotationPrefix)
+}
+
+// GetPodLabels will return the labels that should be added to the created
+// k8s resources, as specified via the LabelPodLabelPrefix labels.
+func (co *Container) GetPodLabels() map[string]string {
+	return co.getPrefixedLabels(LabelPodLabelPrefix)
+}
+
+// getPrefixedLabels will return all labels that start with given prefix,
+// with the prefix removed from the key.
+func (co *Container) getPrefixedLabels(prefix string) map[string]string {
+	res := map[string]string{}
+	for k, v := range co.Labels {
+		if key, ok := strings.CutPrefix(k, prefix); ok && key != "" {
+			res[key] = v
+		}
+	}
+	return res
+}
+
 // GetPodName will return a human friendly name that can be used for the
 // container deployments.
 func (co *Container) GetPodName() string {
@@ -298,12 +429,20 @@ func (co *Container) MapPort(pod, local int) {
 	co.MappedPorts[pod] = local
 }
 
-// AddHostPort will add a predefined port mapping.
+// MapUDPPort will map a pod udp port to a local port.
+func (co *Container) MapUDPPort(pod, local int) {
+	if co.UDPMappedPorts == nil {
+		co.UDPMappedPorts = map[int]int{}
+	}
+	co.UDPMappedPorts[pod] = local
+}
+
+// AddHostPort will add a predefined port mapping. Udp ports are added to
+// the udp host ports, all other ports are considered tcp.
 func (co *Container) AddHostPort(src string, dst string) error {
-	var err error
-	var sp, dp int
+	var sp int
 
-	dp, err = co.getTCPPort(dst)
+	dp, proto, err := co.getPort(dst)
 	if err != nil {
 		return err
 	}
@@ -317,6 +456,14 @@ func (co *Container) AddHostPort(src string, dst string) error {
 		sp = -dp
 	}
 
+	if proto == "udp" {
+		if co.UDPHostPorts == nil {
+			co.UDPHostPorts = map[int]int{}
+		}
+		co.UDPHostPorts[sp] = dp
+		return nil
+	}
+
 	if co.HostPorts == nil {
 		co.HostPorts = map[int]int{}
 	}
@@ -325,16 +472,80 @@ func (co *Container) AddHostPort(src string, dst string) error {
 	return nil
 }
 
+// AddHostBinding will add a predefined port mapping, which should be
+// bound on given host ip. If no host ip is given, the default is used.
+func (co *Container) AddHostBinding(ip, src, dst string) error {
+	if ip != "" && net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid host ip %s", ip)
+	}
+	if err := co.AddHostPort(src, dst); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	dp, proto, err := co.getPort(dst)
+	if err != nil {
+		return err
+	}
+	sp := -dp
+	if src != "" && src != "0" {
+		sp, _ = strconv.Atoi(src)
+	}
+	if co.BindIPs == nil {
+		co.BindIPs = map[string]string{}
+	}
+	co.BindIPs[fmt.Sprintf("%d/%s", sp, proto)] = ip
+	return nil
+}
+
+// GetBindIP will return the host ip that was requested for the binding of
+// given host port and protocol, or for the binding of given container port
+// to a random host port, or an empty string if no specific ip was requested.
+func (co *Container) GetBindIP(src, dst int, proto string) string {
+	if ip, ok := co.BindIPs[fmt.Sprintf("%d/%s", src, proto)]; ok {
+		return ip
+	}
+	return co.BindIPs[fmt.Sprintf("%d/%s", -dst, proto)]
+}
+
+// SetListenIP will register the ip on which given host port and protocol
+// are made available.
+func (co *Container) SetListenIP(port int, proto, ip string) {
+	if co.ListenIPs == nil {
+		co.ListenIPs = map[string]string{}
+	}
+	co.ListenIPs[fmt.Sprintf("%d/%s", port, proto)] = ip
+}
+
+// GetListenIP will return the ip on which given host port and protocol are
+// made available, or an empty string if not known.
+func (co *Container) GetListenIP(port int, proto string) string {
+	return co.ListenIPs[fmt.Sprintf("%d/%s", port, proto)]
+}
+
 // GetContainerTCPPorts will return a list of all ports that are
 // exposed by this container.
 func (co *Container) GetContainerTCPPorts() []int {
-	return co.getTCPPorts(co.ExposedPorts)
+	return co.getPorts(co.ExposedPorts, "tcp")
 }
 
 // GetImageTCPPorts will return a list of all ports that are
 // exposed by the image.
 func (co *Container) GetImageTCPPorts() []int {
-	return co.getTCPPorts(co.ImagePorts)
+	return co.getPorts(co.ImagePorts, "tcp")
+}
+
+// GetContainerUDPPorts will return a list of all udp ports that are
+// exposed by this container.
+func (co *Container) GetContainerUDPPorts() []int {
+	return co.getPorts(co.ExposedPorts, "udp")
+}
+
+// GetImageUDPPorts will return a list of all udp ports that are
+// exposed by the image.
+func (co *Container) GetImageUDPPorts() []int {
+	return co.getPorts(co.ImagePorts, "udp")
 }
 
 // GetServicePorts will return a list of ports and their mapping as they
@@ -360,38 +571,67 @@ func (co *Container) GetServicePorts() map[int]int {
 	return ports
 }
 
-// getTCPPorts will return a list of all tcp ports in given map.
-func (co *Container) getTCPPorts(ports map[string]interface{}) []int {
+// GetServiceUDPPorts will return a list of udp ports and their mapping as
+// they should be applied on a k8s service.
+func (co *Container) GetServiceUDPPorts() map[int]int {
+	ports := map[int]int{}
+	for _, pp := range co.GetImageUDPPorts() {
+		ports[pp] = pp
+	}
+	for _, pp := range co.GetContainerUDPPorts() {
+		ports[pp] = pp
+	}
+	add := func(prts map[int]int) {
+		for src, dst := range prts {
+			if src < 0 {
+				src = dst
+			}
+			ports[src] = dst
+		}
+	}
+	add(co.UDPHostPorts)
+	add(co.UDPMappedPorts)
+	return ports
+}
+
+// getPorts will return a list of all ports with given protocol in given map.
+func (co *Container) getPorts(ports map[string]interface{}, proto string) []int {
 	res := []int{}
 	if ports == nil {
 		return res
 	}
 	for p := range ports {
-		pp, err := co.getTCPPort(p)
+		pp, pr, err := co.getPort(p)
 		if err != nil {
 			klog.Errorf("could not parse exposed port %s", p)
 			continue
 		}
-		res = append(res, pp)
+		if pr == proto {
+			res = append(res, pp)
+		}
 	}
 	return res
 }
 
-// getTCPPort will convert a "9000/tcp" string to the port. If "/tcp" is
-// missing, it will add it as a default.
-func (co *Container) getTCPPort(p string) (int, error) {
+// getPort will convert a "9000/tcp" string to the port and its protocol. If
+// the protocol is missing, tcp is used as a default.
+func (co *Container) getPort(p string) (int, string, error) {
 	f := strings.Split(p, "/")
 	if len(f) == 0 || len(f) > 2 {
-		return 0, fmt.Errorf("could not parse exposed port %s", p)
+		return 0, "", fmt.Errorf("could not parse exposed port %s", p)
 	}
 	pp, err := strconv.Atoi(f[0])
 	if err != nil {
-		return 0, fmt.Errorf("could not parse exposed port %s: %w", p, err)
+		return 0, "", fmt.Errorf("could not parse exposed port %s: %w", p, err)
 	}
-	if len(f) == 2 && f[1] != "tcp" {
-		return 0, fmt.Errorf("unsupported protocol %s for port: %d - only tcp is supported", f[1], pp)
+	proto := "tcp"
+	if len(f) == 2 {
+		proto = strings.ToLower(f[1])
 	}
-	return pp, nil
+	if proto != "tcp" && proto != "udp" {
+		return 0, "", fmt.Errorf("unsupported protocol %s for port: %d - only tcp and udp are supported", proto, pp)
+	}
+	return pp, proto, nil
 }
 
 // GetVolumes will return a map of volumes that should be mounted on the
@@ -531,15 +771,78 @@ func (co *Container) ConnectNetwork(id string) {
 	co.Networks[id] = nil
 }
 
-// DisconnectNetwork will detach a network from the container.
+// AddNetworkAliases will add given aliases, that are specific for the
+// network with given id, to the network aliases of the container. The
+// aliases are recorded for each network that requested them, unless the
+// alias was already given to the container regardless of the network.
+func (co *Container) AddNetworkAliases(id string, aliases []string) {
+	if co.EndpointAliases == nil {
+		co.EndpointAliases = map[string][]string{}
+	}
+	endpoint := co.endpointAliases()
+	present := map[string]bool{co.ShortID: true}
+	for _, alias := range co.NetworkAliases {
+		present[alias] = true
+	}
+	recorded := map[string]bool{}
+	for _, alias := range co.EndpointAliases[id] {
+		recorded[alias] = true
+	}
+	for _, alias := range aliases {
+		alias = strings.ToLower(alias)
+		if present[alias] && !endpoint[alias] {
+			continue
+		}
+		if !present[alias] {
+			co.NetworkAliases = append(co.NetworkAliases, alias)
+			present[alias] = true
+		}
+		if !recorded[alias] {
+			co.EndpointAliases[id] = append(co.EndpointAliases[id], alias)
+			recorded[alias] = true
+		}
+		endpoint[alias] = true
+	}
+}
+
+// DisconnectNetwork will detach a network from the container, and removes
+// the network aliases that were added when connecting to this network, and
+// are not requested by any of the other connected networks.
 func (co *Container) DisconnectNetwork(id string) error {
 	if _, ok := co.Networks[id]; !ok {
 		return fmt.Errorf("container is not connected to network %s", id)
 	}
 	delete(co.Networks, id)
+	remove := map[string]bool{}
+	for _, alias := range co.EndpointAliases[id] {
+		remove[alias] = true
+	}
+	delete(co.EndpointAliases, id)
+	for alias := range co.endpointAliases() {
+		delete(remove, alias)
+	}
+	aliases := []string{}
+	for _, alias := range co.NetworkAliases {
+		if !remove[alias] {
+			aliases = append(aliases, alias)
+		}
+	}
+	co.NetworkAliases = aliases
 	return nil
 }
 
+// endpointAliases will return the aliases that are requested by any of the
+// networks the container is connected to.
+func (co *Container) endpointAliases() map[string]bool {
+	res := map[string]bool{}
+	for _, aliases := range co.EndpointAliases {
+		for _, alias := range aliases {
+			res[alias] = true
+		}
+	}
+	return res
+}
+
 // Match will match given type with given key value pair.
 func (co *Container) Match(typ string, key string, val string) (bool, error) {
 	if typ == "name" {
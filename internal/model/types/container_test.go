@@ -310,6 +310,26 @@ func TestGetNodeSelector(t *testing.T) {
 			outNodeSel: map[string]string{"a": "b"},
 			err:        false,
 		},
+		{ // 7
+			in:         &Container{Platform: "linux/arm64", Labels: map[string]string{}},
+			inNodeSel:  nil,
+			outNodeSel: map[string]string{"kubernetes.io/os": "linux", "kubernetes.io/arch": "arm64"},
+			err:        false,
+		},
+		{ // 8
+			in: &Container{Platform: "linux/amd64", Labels: map[string]string{
+				"com.joyrex2001.kubedock.node-selector": "a=b,kubernetes.io/arch=arm64",
+			}},
+			inNodeSel:  map[string]string{"z": "y"},
+			outNodeSel: map[string]string{"a": "b", "z": "y", "kubernetes.io/os": "linux", "kubernetes.io/arch": "amd64"},
+			err:        false,
+		},
+		{ // 9
+			in:         &Container{Platform: "linux/", Labels: map[string]string{}},
+			inNodeSel:  map[string]string{},
+			outNodeSel: map[string]string{},
+			err:        true,
+		},
 	}
 	for i, tst := range tests {
 		res, err := tst.in.GetNodeSelector(tst.inNodeSel)
@@ -607,11 +627,39 @@ func TestGetTCPPorts(t *testing.T) {
 	}
 }
 
+func TestGetUDPPorts(t *testing.T) {
+	in := &Container{ExposedPorts: map[string]interface{}{
+		"303/tcp": 0,
+		"606/udp": 0,
+		"909/UDP": 0,
+		"808":     0,
+	}, ImagePorts: map[string]interface{}{
+		"101/udp": 0,
+	}, UDPHostPorts: map[int]int{
+		-202: 202,
+	}, UDPMappedPorts: map[int]int{
+		5353: 606,
+	}}
+	res := in.GetContainerUDPPorts()
+	sort.Ints(res)
+	if !reflect.DeepEqual(res, []int{606, 909}) {
+		t.Errorf("expected udp ports [606 909], but got %v", res)
+	}
+	svc := in.GetServiceUDPPorts()
+	if !reflect.DeepEqual(svc, map[int]int{101: 101, 202: 202, 606: 606, 909: 909, 5353: 606}) {
+		t.Errorf("unexpected udp service ports %v", svc)
+	}
+	if len(in.GetServicePorts()) != 2 {
+		t.Errorf("expected udp ports not to be included in tcp service ports")
+	}
+}
+
 func TestAddHostPort(t *testing.T) {
 	tests := []struct {
 		src string
 		dst string
 		out map[int]int
+		udp map[int]int
 		suc bool
 	}{
 		{
@@ -637,6 +685,17 @@ func TestAddHostPort(t *testing.T) {
 			dst: "606/tcp",
 			suc: false,
 		},
+		{
+			src: "303",
+			dst: "606/udp",
+			udp: map[int]int{303: 606},
+			suc: true,
+		},
+		{
+			src: "303",
+			dst: "606/sctp",
+			suc: false,
+		},
 	}
 	for i, tst := range tests {
 		in := &Container{}
@@ -650,6 +709,57 @@ func TestAddHostPort(t *testing.T) {
 		if !reflect.DeepEqual(in.HostPorts, tst.out) {
 			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, in.HostPorts)
 		}
+		if !reflect.DeepEqual(in.UDPHostPorts, tst.udp) {
+			t.Errorf("failed test %d - expected udp %v, but got %v", i, tst.udp, in.UDPHostPorts)
+		}
+	}
+}
+
+func TestAddHostBinding(t *testing.T) {
+	tests := []struct {
+		ip    string
+		src   string
+		dst   string
+		port  int
+		proto string
+		out   string
+		err   bool
+	}{
+		{ip: "127.0.0.1", src: "303", dst: "606/tcp", port: 303, proto: "tcp", out: "127.0.0.1"}, // 0
+		{ip: "127.0.0.1", src: "", dst: "606", port: 808, proto: "tcp", out: "127.0.0.1"},        // 1
+		{ip: "::1", src: "303", dst: "606/udp", port: 303, proto: "udp", out: "::1"},             // 2
+		{ip: "::1", src: "303", dst: "606/udp", port: 303, proto: "tcp", out: ""},                // 3
+		{ip: "", src: "303", dst: "606/tcp", port: 303, proto: "tcp", out: ""},                   // 4
+		{ip: "127.0.0.1", src: "303", dst: "606/tcp", port: 202, proto: "tcp", out: ""},          // 5
+		{ip: "localhost", src: "303", dst: "606/tcp", err: true},                                 // 6
+		{ip: "127.0.0.256", src: "303", dst: "606/tcp", err: true},                               // 7
+	}
+	for i, tst := range tests {
+		in := &Container{}
+		err := in.AddHostBinding(tst.ip, tst.src, tst.dst)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error: %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		if res := in.GetBindIP(tst.port, 606, tst.proto); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+
+	in := &Container{}
+	if err := in.AddHostBinding("127.0.0.1", "303", "606/tcp"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := in.AddHostBinding("192.168.1.1", "202", "606/tcp"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if res := in.GetBindIP(303, 606, "tcp"); res != "127.0.0.1" {
+		t.Errorf("expected 127.0.0.1 for binding of host port 303, but got %s", res)
+	}
+	if res := in.GetBindIP(202, 606, "tcp"); res != "192.168.1.1" {
+		t.Errorf("expected 192.168.1.1 for binding of host port 202, but got %s", res)
 	}
 }
 
@@ -846,6 +956,76 @@ func TestConnectNetwork(t *testing.T) {
 	}
 }
 
+func TestNetworkAliases(t *testing.T) {
+	in := &Container{ShortID: "tb303", NetworkAliases: []string{"f1spirit"}}
+	in.ConnectNetwork("1234")
+	in.AddNetworkAliases("1234", []string{"F1Spirit", "Tr808", "tb303"})
+	in.ConnectNetwork("5678")
+	in.AddNetworkAliases("5678", []string{"sh101"})
+	if !reflect.DeepEqual(in.NetworkAliases, []string{"f1spirit", "tr808", "sh101"}) {
+		t.Errorf("unexpected network aliases %v", in.NetworkAliases)
+	}
+	if err := in.DisconnectNetwork("1234"); err != nil {
+		t.Errorf("unexpected error on delete %s", err)
+	}
+	if !reflect.DeepEqual(in.NetworkAliases, []string{"f1spirit", "sh101"}) {
+		t.Errorf("unexpected network aliases after disconnect %v", in.NetworkAliases)
+	}
+	if _, ok := in.EndpointAliases["1234"]; ok {
+		t.Errorf("expected endpoint aliases of network 1234 to be removed")
+	}
+}
+
+func TestGetHTTPPorts(t *testing.T) {
+	tests := []struct {
+		in  string
+		out map[int]bool
+		err bool
+	}{
+		{"", map[int]bool{}, false},                             // 0
+		{"8080", map[int]bool{8080: true}, false},               // 1
+		{"80, 8080", map[int]bool{80: true, 8080: true}, false}, // 2
+		{"http", nil, true},                                     // 3
+		{"0", nil, true},                                        // 4
+	}
+	for i, tst := range tests {
+		tainr := &Container{Labels: map[string]string{LabelExposeHTTP: tst.in}}
+		res, err := tainr.GetHTTPPorts()
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %v", i, err)
+		}
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestSharedNetworkAliases(t *testing.T) {
+	in := &Container{ShortID: "tb303"}
+	in.ConnectNetwork("1234")
+	in.AddNetworkAliases("1234", []string{"db", "tr808"})
+	in.ConnectNetwork("5678")
+	in.AddNetworkAliases("5678", []string{"DB"})
+	if !reflect.DeepEqual(in.NetworkAliases, []string{"db", "tr808"}) {
+		t.Errorf("unexpected network aliases %v", in.NetworkAliases)
+	}
+	if !reflect.DeepEqual(in.EndpointAliases["5678"], []string{"db"}) {
+		t.Errorf("expected shared alias to be recorded for network 5678, but got %v", in.EndpointAliases["5678"])
+	}
+	if err := in.DisconnectNetwork("1234"); err != nil {
+		t.Errorf("unexpected error on delete %s", err)
+	}
+	if !reflect.DeepEqual(in.NetworkAliases, []string{"db"}) {
+		t.Errorf("expected shared alias to be kept after disconnect, but got %v", in.NetworkAliases)
+	}
+	if err := in.DisconnectNetwork("5678"); err != nil {
+		t.Errorf("unexpected error on delete %s", err)
+	}
+	if len(in.NetworkAliases) != 0 {
+		t.Errorf("expected no network aliases after disconnect, but got %v", in.NetworkAliases)
+	}
+}
+
 func TestMatch(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -992,3 +1172,61 @@ func TestGetActiveDeadlineSeconds(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPodLabelsAndAnnotations(t *testing.T) {
+	tests := []struct {
+		in     *Container
+		labels map[string]string
+		annots map[string]string
+	}{
+		{ // 0
+			in:     &Container{Labels: map[string]string{}},
+			labels: map[string]string{},
+			annots: map[string]string{},
+		},
+		{ // 1
+			in: &Container{Labels: map[string]string{
+				"computer": "msx",
+				"com.joyrex2001.kubedock.pod-label/cost-center":                  "retro",
+				"com.joyrex2001.kubedock.pod-label/":                             "empty",
+				"com.joyrex2001.kubedock.pod-annotation/sidecar.istio.io/inject": "false",
+			}},
+			labels: map[string]string{"cost-center": "retro"},
+			annots: map[string]string{"sidecar.istio.io/inject": "false"},
+		},
+	}
+	for i, tst := range tests {
+		if res := tst.in.GetPodLabels(); !reflect.DeepEqual(res, tst.labels) {
+			t.Errorf("failed test %d - expected labels %v, but got %v", i, tst.labels, res)
+		}
+		if res := tst.in.GetPodAnnotations(); !reflect.DeepEqual(res, tst.annots) {
+			t.Errorf("failed test %d - expected annotations %v, but got %v", i, tst.annots, res)
+		}
+	}
+}
+
+func TestGetWorkload(t *testing.T) {
+	tests := []struct {
+		in  *Container
+		out string
+		job bool
+		err bool
+	}{
+		{in: &Container{Labels: map[string]string{}}, out: "pod"},
+		{in: &Container{Labels: map[string]string{"com.joyrex2001.kubedock.workload": "pod"}}, out: "pod"},
+		{in: &Container{Labels: map[string]string{"com.joyrex2001.kubedock.workload": "Job"}}, out: "job", job: true},
+		{in: &Container{Labels: map[string]string{"com.joyrex2001.kubedock.workload": "deployment"}}, out: "pod", err: true},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetWorkload()
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+		if tst.in.IsJob() != tst.job {
+			t.Errorf("failed test %d - expected job %t, but got %t", i, tst.job, tst.in.IsJob())
+		}
+	}
+}
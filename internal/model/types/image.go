@@ -9,6 +9,7 @@ type Image struct {
 	ID           string
 	ShortID      string
 	Name         string
+	Platform     string
 	ExposedPorts map[string]struct{}
 	Created      time.Time
 }
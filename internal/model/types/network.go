@@ -7,11 +7,12 @@ import (
 
 // Network describes the details of a network.
 type Network struct {
-	ID      string
-	ShortID string
-	Name    string
-	Labels  map[string]string
-	Created time.Time
+	ID       string
+	ShortID  string
+	Name     string
+	Labels   map[string]string
+	Internal bool
+	Created  time.Time
 }
 
 // IsPredefined will return if the network is a pre-defined system network.
@@ -0,0 +1,77 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Platform describes the operating system and cpu architecture an image
+// or container is targetted at.
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+// ParsePlatform will parse a docker platform string (os[/arch[/variant]])
+// into a Platform object. Common architecture aliases are normalized to
+// the names that are used by kubernetes node labels.
+func ParsePlatform(platform string) (*Platform, error) {
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	if platform == "" {
+		return nil, fmt.Errorf("empty platform")
+	}
+	f := strings.Split(platform, "/")
+	if len(f) > 3 {
+		return nil, fmt.Errorf("invalid platform %s, expected os[/arch[/variant]]", platform)
+	}
+	for _, p := range f {
+		if p == "" {
+			return nil, fmt.Errorf("invalid platform %s, expected os[/arch[/variant]]", platform)
+		}
+	}
+	pl := &Platform{OS: f[0]}
+	if len(f) > 1 {
+		pl.Architecture = normalizeArchitecture(f[1])
+	}
+	if len(f) > 2 {
+		pl.Variant = f[2]
+	}
+	return pl, nil
+}
+
+// normalizeArchitecture will convert architecture aliases to the names as
+// used in the kubernetes.io/arch node label.
+func normalizeArchitecture(arch string) string {
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	}
+	return arch
+}
+
+// String will return the platform in the docker os/arch/variant notation.
+func (pl *Platform) String() string {
+	res := pl.OS
+	if pl.Architecture != "" {
+		res += "/" + pl.Architecture
+	}
+	if pl.Variant != "" {
+		res += "/" + pl.Variant
+	}
+	return res
+}
+
+// NodeSelector will return the kubernetes node selector labels that
+// match this platform.
+func (pl *Platform) NodeSelector() map[string]string {
+	nodesel := map[string]string{"kubernetes.io/os": pl.OS}
+	if pl.Architecture != "" {
+		nodesel["kubernetes.io/arch"] = pl.Architecture
+	}
+	return nodesel
+}
@@ -0,0 +1,42 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *Platform
+		str string
+		err bool
+	}{
+		{in: "linux", out: &Platform{OS: "linux"}, str: "linux"},
+		{in: "linux/amd64", out: &Platform{OS: "linux", Architecture: "amd64"}, str: "linux/amd64"},
+		{in: "Linux/ARM64/v8", out: &Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, str: "linux/arm64/v8"},
+		{in: "linux/x86_64", out: &Platform{OS: "linux", Architecture: "amd64"}, str: "linux/amd64"},
+		{in: "linux/aarch64", out: &Platform{OS: "linux", Architecture: "arm64"}, str: "linux/arm64"},
+		{in: "", err: true},
+		{in: "linux/", err: true},
+		{in: "linux/arm/v7/extra", err: true},
+	}
+	for i, tst := range tests {
+		res, err := ParsePlatform(tst.in)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if tst.err {
+			continue
+		}
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+		if res.String() != tst.str {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.str, res.String())
+		}
+	}
+}
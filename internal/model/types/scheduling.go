@@ -0,0 +1,229 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// GetTolerations will return the tolerations that should be applied for
+// this container. The LabelTolerations label contains a comma-separated
+// list of tolerations in the key[=value][:effect] format, which are added
+// to the given tolerations.
+func (co *Container) GetTolerations(tols []corev1.Toleration) ([]corev1.Toleration, error) {
+	tolerations := co.Labels[LabelTolerations]
+	if tolerations == "" {
+		return tols, nil
+	}
+
+	for _, t := range strings.Split(tolerations, ",") {
+		tol, err := parseToleration(strings.TrimSpace(t))
+		if err != nil {
+			return tols, err
+		}
+		tols = append(tols, tol)
+	}
+
+	return tols, nil
+}
+
+// parseToleration will parse a single toleration in the key[=value][:effect]
+// format. If a value is given, the Equal operator is used, otherwise the
+// toleration will use the Exists operator.
+func parseToleration(toleration string) (corev1.Toleration, error) {
+	tol := corev1.Toleration{}
+	kv, effect, _ := strings.Cut(toleration, ":")
+	key, value, hasValue := strings.Cut(kv, "=")
+	if key == "" {
+		return tol, fmt.Errorf("toleration in wrong format, expected key[=value][:effect]: '%s'", toleration)
+	}
+	tol.Key = key
+	tol.Operator = corev1.TolerationOpExists
+	if hasValue {
+		tol.Operator = corev1.TolerationOpEqual
+		tol.Value = value
+	}
+	switch corev1.TaintEffect(effect) {
+	case "":
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		tol.Effect = corev1.TaintEffect(effect)
+	default:
+		return tol, fmt.Errorf("invalid toleration effect %s: '%s'", effect, toleration)
+	}
+	return tol, nil
+}
+
+// GetAffinity will return the affinity that should be applied for this
+// container. The LabelNodeAffinity label contains a kubernetes label
+// selector expression (e.g. `disktype in (ssd,nvme),!spot`) which is added
+// as a required node affinity term. The LabelPodAntiAffinity label contains
+// a label selector, optionally suffixed with @topologyKey, describing the
+// pods this container should not be co-located with.
+func (co *Container) GetAffinity(affinity *corev1.Affinity) (*corev1.Affinity, error) {
+	nodeaff := co.Labels[LabelNodeAffinity]
+	podantiaff := co.Labels[LabelPodAntiAffinity]
+	if nodeaff == "" && podantiaff == "" {
+		return affinity, nil
+	}
+
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+
+	if nodeaff != "" {
+		term, err := parseNodeSelectorTerm(nodeaff)
+		if err != nil {
+			return affinity, err
+		}
+		if affinity.NodeAffinity == nil {
+			affinity.NodeAffinity = &corev1.NodeAffinity{}
+		}
+		if affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+		}
+		req := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if len(req.NodeSelectorTerms) == 0 {
+			req.NodeSelectorTerms = []corev1.NodeSelectorTerm{term}
+		} else {
+			// terms are OR-ed, so the expressions are added to every
+			// existing term to make sure they are always applied
+			for i := range req.NodeSelectorTerms {
+				req.NodeSelectorTerms[i].MatchExpressions = append(req.NodeSelectorTerms[i].MatchExpressions, term.MatchExpressions...)
+			}
+		}
+	}
+
+	if podantiaff != "" {
+		term, err := parsePodAffinityTerm(podantiaff)
+		if err != nil {
+			return affinity, err
+		}
+		if affinity.PodAntiAffinity == nil {
+			affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	}
+
+	return affinity, nil
+}
+
+// parseNodeSelectorTerm will convert a label selector expression into a
+// node selector term.
+func parseNodeSelectorTerm(expr string) (corev1.NodeSelectorTerm, error) {
+	term := corev1.NodeSelectorTerm{}
+	sel, err := labels.Parse(expr)
+	if err != nil {
+		return term, fmt.Errorf("invalid node-affinity '%s': %w", expr, err)
+	}
+	reqs, _ := sel.Requirements()
+	ops := map[selection.Operator]corev1.NodeSelectorOperator{
+		selection.Equals:       corev1.NodeSelectorOpIn,
+		selection.DoubleEquals: corev1.NodeSelectorOpIn,
+		selection.In:           corev1.NodeSelectorOpIn,
+		selection.NotEquals:    corev1.NodeSelectorOpNotIn,
+		selection.NotIn:        corev1.NodeSelectorOpNotIn,
+		selection.Exists:       corev1.NodeSelectorOpExists,
+		selection.DoesNotExist: corev1.NodeSelectorOpDoesNotExist,
+		selection.GreaterThan:  corev1.NodeSelectorOpGt,
+		selection.LessThan:     corev1.NodeSelectorOpLt,
+	}
+	for _, req := range reqs {
+		op, ok := ops[req.Operator()]
+		if !ok {
+			return term, fmt.Errorf("unsupported operator %s in node-affinity '%s'", req.Operator(), expr)
+		}
+		term.MatchExpressions = append(term.MatchExpressions, corev1.NodeSelectorRequirement{
+			Key:      req.Key(),
+			Operator: op,
+			Values:   req.Values().List(),
+		})
+	}
+	return term, nil
+}
+
+// parsePodAffinityTerm will convert a selector[@topologyKey] expression into
+// a pod affinity term. If no topology key is given, kubernetes.io/hostname is
+// used.
+func parsePodAffinityTerm(expr string) (corev1.PodAffinityTerm, error) {
+	term := corev1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"}
+	selector, topology, found := strings.Cut(expr, "@")
+	if found {
+		if topology == "" {
+			return term, fmt.Errorf("empty topology key in pod-anti-affinity '%s'", expr)
+		}
+		term.TopologyKey = topology
+	}
+	sel, err := metav1.ParseToLabelSelector(selector)
+	if err != nil {
+		return term, fmt.Errorf("invalid pod-anti-affinity '%s': %w", expr, err)
+	}
+	term.LabelSelector = sel
+	return term, nil
+}
+
+// GetPriorityClassName will return the priority class that should be used
+// for this container.
+func (co *Container) GetPriorityClassName(current string) string {
+	if pc, ok := co.Labels[LabelPriorityClass]; ok && pc != "" {
+		return pc
+	}
+	return current
+}
+
+// GetRuntimeClassName will return the runtime class (e.g. gvisor) that
+// should be used for this container.
+func (co *Container) GetRuntimeClassName(current *string) *string {
+	if rc, ok := co.Labels[LabelRuntimeClass]; ok && rc != "" {
+		return &rc
+	}
+	return current
+}
+
+// GetTopologySpreadConstraints will return the topology spread constraints
+// that should be applied for this container. The LabelTopologySpread label
+// contains a comma-separated list of topologyKey[:maxSkew[:whenUnsatisfiable]]
+// constraints, which will spread the pods matching the given match labels.
+func (co *Container) GetTopologySpreadConstraints(tscs []corev1.TopologySpreadConstraint, match map[string]string) ([]corev1.TopologySpreadConstraint, error) {
+	spread := co.Labels[LabelTopologySpread]
+	if spread == "" {
+		return tscs, nil
+	}
+
+	for _, s := range strings.Split(spread, ",") {
+		s = strings.TrimSpace(s)
+		f := strings.Split(s, ":")
+		if len(f) > 3 || f[0] == "" {
+			return tscs, fmt.Errorf("topology-spread in wrong format, expected topologyKey[:maxSkew[:whenUnsatisfiable]]: '%s'", s)
+		}
+		tsc := corev1.TopologySpreadConstraint{
+			TopologyKey:       f[0],
+			MaxSkew:           1,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: match},
+		}
+		if len(f) > 1 {
+			skew, err := strconv.ParseInt(f[1], 10, 32)
+			if err != nil || skew < 1 {
+				return tscs, fmt.Errorf("invalid max skew %s in topology-spread '%s'", f[1], s)
+			}
+			tsc.MaxSkew = int32(skew)
+		}
+		if len(f) > 2 {
+			switch corev1.UnsatisfiableConstraintAction(f[2]) {
+			case corev1.DoNotSchedule, corev1.ScheduleAnyway:
+				tsc.WhenUnsatisfiable = corev1.UnsatisfiableConstraintAction(f[2])
+			default:
+				return tscs, fmt.Errorf("invalid whenUnsatisfiable %s in topology-spread '%s'", f[2], s)
+			}
+		}
+		tscs = append(tscs, tsc)
+	}
+
+	return tscs, nil
+}
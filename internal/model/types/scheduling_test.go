@@ -0,0 +1,293 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetTolerations(t *testing.T) {
+	tests := []struct {
+		in   *Container
+		tols []corev1.Toleration
+		out  []corev1.Toleration
+		err  bool
+	}{
+		{ // 0
+			in:  &Container{Labels: map[string]string{}},
+			out: nil,
+		},
+		{ // 1
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.tolerations": "spot=true:NoSchedule",
+			}},
+			out: []corev1.Toleration{
+				{Key: "spot", Operator: corev1.TolerationOpEqual, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+			},
+		},
+		{ // 2
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.tolerations": "gpu, dedicated=ci",
+			}},
+			tols: []corev1.Toleration{{Key: "z", Operator: corev1.TolerationOpExists}},
+			out: []corev1.Toleration{
+				{Key: "z", Operator: corev1.TolerationOpExists},
+				{Key: "gpu", Operator: corev1.TolerationOpExists},
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "ci"},
+			},
+		},
+		{ // 3
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.tolerations": "gpu:NoWhere",
+			}},
+			err: true,
+		},
+		{ // 4
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.tolerations": "=true",
+			}},
+			err: true,
+		},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetTolerations(tst.tols)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		if !tst.err && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetAffinity(t *testing.T) {
+	tests := []struct {
+		in  *Container
+		aff *corev1.Affinity
+		out *corev1.Affinity
+		err bool
+	}{
+		{ // 0
+			in:  &Container{Labels: map[string]string{}},
+			out: nil,
+		},
+		{ // 1
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.node-affinity": "disktype in (ssd,nvme),!spot",
+			}},
+			out: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: "disktype", Operator: corev1.NodeSelectorOpIn, Values: []string{"nvme", "ssd"}},
+						{Key: "spot", Operator: corev1.NodeSelectorOpDoesNotExist, Values: []string{}},
+					}}},
+				},
+			}},
+		},
+		{ // 2
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.pod-anti-affinity": "app=es",
+			}},
+			out: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "es"}, MatchExpressions: []metav1.LabelSelectorRequirement{}},
+					TopologyKey:   "kubernetes.io/hostname",
+				}},
+			}},
+		},
+		{ // 3
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.pod-anti-affinity": "app=es@topology.kubernetes.io/zone",
+			}},
+			out: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "es"}, MatchExpressions: []metav1.LabelSelectorRequirement{}},
+					TopologyKey:   "topology.kubernetes.io/zone",
+				}},
+			}},
+		},
+		{ // 4
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.node-affinity": "zone=a",
+			}},
+			aff: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "x", Operator: corev1.NodeSelectorOpExists}}},
+						{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "y", Operator: corev1.NodeSelectorOpExists}}},
+					},
+				},
+			}},
+			out: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "x", Operator: corev1.NodeSelectorOpExists},
+							{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+						}},
+						{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "y", Operator: corev1.NodeSelectorOpExists},
+							{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+						}},
+					},
+				},
+			}},
+		},
+		{ // 5
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.node-affinity": "disktype in (ssd",
+			}},
+			err: true,
+		},
+		{ // 6
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.pod-anti-affinity": "app=es@",
+			}},
+			err: true,
+		},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetAffinity(tst.aff)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		if !tst.err && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetPriorityClassName(t *testing.T) {
+	tests := []struct {
+		in  *Container
+		cur string
+		out string
+	}{
+		{ // 0
+			in:  &Container{Labels: map[string]string{}},
+			out: "",
+		},
+		{ // 1
+			in:  &Container{Labels: map[string]string{}},
+			cur: "low",
+			out: "low",
+		},
+		{ // 2
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.priority-class": "high",
+			}},
+			cur: "low",
+			out: "high",
+		},
+	}
+	for i, tst := range tests {
+		pc := tst.in.GetPriorityClassName(tst.cur)
+		if pc != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, pc)
+		}
+	}
+}
+
+func TestGetRuntimeClassName(t *testing.T) {
+	gvisor := "gvisor"
+	tests := []struct {
+		in  *Container
+		cur *string
+		out *string
+	}{
+		{ // 0
+			in:  &Container{Labels: map[string]string{}},
+			out: nil,
+		},
+		{ // 1
+			in:  &Container{Labels: map[string]string{}},
+			cur: &gvisor,
+			out: &gvisor,
+		},
+		{ // 2
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.runtime-class": "gvisor",
+			}},
+			out: &gvisor,
+		},
+	}
+	for i, tst := range tests {
+		rc := tst.in.GetRuntimeClassName(tst.cur)
+		if !reflect.DeepEqual(rc, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, rc)
+		}
+	}
+}
+
+func TestGetTopologySpreadConstraints(t *testing.T) {
+	match := map[string]string{"kubedock.id": "1234"}
+	tests := []struct {
+		in  *Container
+		out []corev1.TopologySpreadConstraint
+		err bool
+	}{
+		{ // 0
+			in:  &Container{Labels: map[string]string{}},
+			out: nil,
+		},
+		{ // 1
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.topology-spread": "kubernetes.io/hostname",
+			}},
+			out: []corev1.TopologySpreadConstraint{{
+				TopologyKey:       "kubernetes.io/hostname",
+				MaxSkew:           1,
+				WhenUnsatisfiable: corev1.ScheduleAnyway,
+				LabelSelector:     &metav1.LabelSelector{MatchLabels: match},
+			}},
+		},
+		{ // 2
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.topology-spread": "zone:2:DoNotSchedule,kubernetes.io/hostname:3",
+			}},
+			out: []corev1.TopologySpreadConstraint{{
+				TopologyKey:       "zone",
+				MaxSkew:           2,
+				WhenUnsatisfiable: corev1.DoNotSchedule,
+				LabelSelector:     &metav1.LabelSelector{MatchLabels: match},
+			}, {
+				TopologyKey:       "kubernetes.io/hostname",
+				MaxSkew:           3,
+				WhenUnsatisfiable: corev1.ScheduleAnyway,
+				LabelSelector:     &metav1.LabelSelector{MatchLabels: match},
+			}},
+		},
+		{ // 3
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.topology-spread": "zone:0",
+			}},
+			err: true,
+		},
+		{ // 4
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.topology-spread": "zone:1:Maybe",
+			}},
+			err: true,
+		},
+		{ // 5
+			in: &Container{Labels: map[string]string{
+				"com.joyrex2001.kubedock.topology-spread": "zone:1:DoNotSchedule:extra",
+			}},
+			err: true,
+		},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetTopologySpreadConstraints(nil, match)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		if !tst.err && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+// createEphemeralNamespace will create a new namespace for this kubedock
+// instance, and copies the given image pull secrets, and all service
+// accounts, roles, rolebindings and resource quotas from given template
+// namespace into it. If the namespace already exists, e.g. when restarted
+// with a fixed instance id, the existing namespace is reused and the
+// objects that are missing are copied again. It returns the name of the
+// namespace.
+func createEphemeralNamespace(cli kubernetes.Interface, template string, secrets []string) (string, error) {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kubedock-" + config.InstanceID,
+			Labels: map[string]string{
+				"kubedock":    "true",
+				"kubedock.id": config.InstanceID,
+			},
+		},
+	}
+	reused := false
+	_, err := cli.CoreV1().Namespaces().Create(context.Background(), ns, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		cur, err := cli.CoreV1().Namespaces().Get(context.Background(), ns.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if cur.DeletionTimestamp != nil || cur.Status.Phase == corev1.NamespaceTerminating {
+			return "", fmt.Errorf("namespace %s is being deleted", ns.Name)
+		}
+		klog.Infof("reusing existing namespace %s", ns.Name)
+		reused = true
+	} else if err != nil {
+		return "", err
+	}
+	if template == "" {
+		return ns.Name, nil
+	}
+	if err := copyNamespace(cli, template, ns.Name, secrets); err != nil {
+		if !reused {
+			_ = deleteEphemeralNamespace(cli, ns.Name)
+		}
+		return "", err
+	}
+	return ns.Name, nil
+}
+
+// deleteEphemeralNamespace will delete given namespace, including all
+// resources that were created in it.
+func deleteEphemeralNamespace(cli kubernetes.Interface, namespace string) error {
+	background := metav1.DeletePropagationBackground
+	return cli.CoreV1().Namespaces().Delete(context.Background(), namespace, metav1.DeleteOptions{
+		PropagationPolicy: &background,
+	})
+}
+
+// copyNamespace will copy given secrets, and all service accounts, roles,
+// rolebindings and resource quotas from namespace src to namespace dst.
+// Objects that already exist in dst are kept as-is. Note that kubernetes
+// only allows creating the roles and rolebindings if kubedock holds the
+// permissions in these roles itself, or has the escalate and bind verbs.
+func copyNamespace(cli kubernetes.Interface, src, dst string, secrets []string) error {
+	ctx := context.Background()
+	for _, name := range secrets {
+		secret, err := cli.CoreV1().Secrets(src).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		secret.ObjectMeta = copyObjectMeta(secret.ObjectMeta, dst)
+		if _, err := cli.CoreV1().Secrets(dst).Create(ctx, secret, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	sas, err := cli.CoreV1().ServiceAccounts(src).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, sa := range sas.Items {
+		sa.ObjectMeta = copyObjectMeta(sa.ObjectMeta, dst)
+		sa.Secrets = nil
+		if _, err := cli.CoreV1().ServiceAccounts(dst).Create(ctx, &sa, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	roles, err := cli.RbacV1().Roles(src).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, role := range roles.Items {
+		role.ObjectMeta = copyObjectMeta(role.ObjectMeta, dst)
+		if _, err := cli.RbacV1().Roles(dst).Create(ctx, &role, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	rbs, err := cli.RbacV1().RoleBindings(src).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, rb := range rbs.Items {
+		rb.ObjectMeta = copyObjectMeta(rb.ObjectMeta, dst)
+		rb.Subjects = copySubjects(rb.Subjects, src, dst)
+		if _, err := cli.RbacV1().RoleBindings(dst).Create(ctx, &rb, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	quotas, err := cli.CoreV1().ResourceQuotas(src).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, quota := range quotas.Items {
+		quota.ObjectMeta = copyObjectMeta(quota.ObjectMeta, dst)
+		quota.Status = corev1.ResourceQuotaStatus{}
+		if _, err := cli.CoreV1().ResourceQuotas(dst).Create(ctx, &quota, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	klog.V(2).Infof("copied %d secrets, %d service accounts, %d roles, %d rolebindings and %d resource quotas from %s", len(secrets), len(sas.Items), len(roles.Items), len(rbs.Items), len(quotas.Items), src)
+	return nil
+}
+
+// copyObjectMeta will return the metadata of given object, which can be
+// used to create a copy of it in given namespace.
+func copyObjectMeta(meta metav1.ObjectMeta, namespace string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+// copySubjects will return given rolebinding subjects, extended with the
+// copies in namespace dst of the service accounts in namespace src. The
+// original subjects are kept, so e.g. kubedock's own service account will
+// have the same permissions in namespace dst as it has in namespace src.
+func copySubjects(subjects []rbacv1.Subject, src, dst string) []rbacv1.Subject {
+	res := append([]rbacv1.Subject{}, subjects...)
+	for _, sub := range subjects {
+		if sub.Kind == rbacv1.ServiceAccountKind && sub.Namespace == src {
+			sub.Namespace = dst
+			res = append(res, sub)
+		}
+	}
+	return res
+}
+
+// getImagePullSecrets will return the configured image pull secrets.
+func getImagePullSecrets() []string {
+	res := []string{}
+	for _, name := range strings.Split(viper.GetString("kubernetes.image-pull-secrets"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
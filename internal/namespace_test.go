@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+func TestCreateEphemeralNamespace(t *testing.T) {
+	cli := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "regcred", Namespace: "tmpl", ResourceVersion: "42"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "tmpl"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: "tmpl"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: "tmpl"}},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: "tmpl"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "runner", Namespace: "tmpl"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "runner"},
+		},
+		&corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "tmpl"}},
+	)
+
+	ns, err := createEphemeralNamespace(cli, "tmpl", []string{"regcred"})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if ns != "kubedock-"+config.InstanceID {
+		t.Errorf("expected namespace kubedock-%s, but got %s", config.InstanceID, ns)
+	}
+	ctx := context.Background()
+	if nsp, err := cli.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{}); err != nil || nsp.Labels["kubedock.id"] != config.InstanceID {
+		t.Errorf("expected namespace labeled with instance id")
+	}
+	if _, err := cli.CoreV1().Secrets(ns).Get(ctx, "regcred", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected image pull secret to be copied")
+	}
+	if _, err := cli.CoreV1().Secrets(ns).Get(ctx, "other", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected other secrets not to be copied")
+	}
+	if _, err := cli.CoreV1().ServiceAccounts(ns).Get(ctx, "runner", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected service account to be copied")
+	}
+	if _, err := cli.RbacV1().Roles(ns).Get(ctx, "runner", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected role to be copied")
+	}
+	rb, err := cli.RbacV1().RoleBindings(ns).Get(ctx, "runner", metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("expected rolebinding to be copied")
+	} else if len(rb.Subjects) != 2 || rb.Subjects[0].Namespace != "tmpl" || rb.Subjects[1].Namespace != ns {
+		t.Errorf("expected rolebinding subjects in both namespaces, but got %v", rb.Subjects)
+	}
+	if _, err := cli.CoreV1().ResourceQuotas(ns).Get(ctx, "quota", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected resource quota to be copied")
+	}
+
+	if err := cli.RbacV1().RoleBindings(ns).Delete(ctx, "runner", metav1.DeleteOptions{}); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if _, err := createEphemeralNamespace(cli, "tmpl", []string{"regcred"}); err != nil {
+		t.Errorf("expected existing namespace to be reused, but got %s", err)
+	}
+	if _, err := cli.RbacV1().RoleBindings(ns).Get(ctx, "runner", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected missing rolebinding to be copied into reused namespace")
+	}
+
+	nsp, _ := cli.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+	nsp.Status.Phase = corev1.NamespaceTerminating
+	if _, err := cli.CoreV1().Namespaces().Update(ctx, nsp, metav1.UpdateOptions{}); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if _, err := createEphemeralNamespace(cli, "tmpl", []string{"regcred"}); err == nil {
+		t.Errorf("expected error when reusing a terminating namespace")
+	}
+
+	if err := deleteEphemeralNamespace(cli, ns); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if _, err := cli.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected namespace to be deleted")
+	}
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+// isNamespacePool will return true if a pool of namespaces is configured
+// to acquire a lock on.
+func isNamespacePool() bool {
+	return viper.GetString("lock.namespaces") != "" || viper.GetString("lock.namespace-selector") != ""
+}
+
+// getNamespacePool will return the namespaces that are candidate to be
+// locked; the configured list of namespaces, and the namespaces matching
+// the configured label selector. If no pool is configured, the configured
+// namespace is returned.
+func getNamespacePool(cli kubernetes.Interface) ([]string, error) {
+	if !isNamespacePool() {
+		return []string{viper.GetString("kubernetes.namespace")}, nil
+	}
+	res := []string{}
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(viper.GetString("lock.namespaces"), ",") {
+		ns = strings.TrimSpace(ns)
+		if ns != "" && !seen[ns] {
+			res = append(res, ns)
+			seen[ns] = true
+		}
+	}
+	if sel := viper.GetString("lock.namespace-selector"); sel != "" {
+		nss, err := cli.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{
+			LabelSelector: sel,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss.Items {
+			if !seen[ns.Name] {
+				res = append(res, ns.Name)
+				seen[ns.Name] = true
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no namespaces available to lock")
+	}
+	return res, nil
+}
+
+// acquireNamespace will try to acquire the lock on all given namespaces,
+// and will return the first namespace that it acquired, together with the
+// context that is valid as long as the lock is held. The locks on the other
+// namespaces are released right away.
+func acquireNamespace(ctx context.Context, cli kubernetes.Interface, namespaces []string) (string, context.Context) {
+	type lease struct {
+		namespace string
+		ctx       context.Context
+	}
+	acquired := make(chan lease, len(namespaces))
+	cancels := map[string]context.CancelFunc{}
+	for _, ns := range namespaces {
+		lctx, cancel := context.WithCancel(ctx)
+		cancels[ns] = cancel
+		go leaderelection.RunOrDie(lctx, leaderelection.LeaderElectionConfig{
+			Lock:            getNamespaceLock(cli, ns),
+			ReleaseOnCancel: true,
+			LeaseDuration:   60 * time.Second,
+			RenewDeadline:   15 * time.Second,
+			RetryPeriod:     5 * time.Second,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					acquired <- lease{namespace: ns, ctx: ctx}
+				},
+				OnStoppedLeading: func() {
+					klog.V(3).Infof("lost lock on namespace %s", ns)
+				},
+				OnNewLeader: func(identity string) {
+					klog.V(3).Infof("new leader elected for namespace %s: %s", ns, identity)
+				},
+			},
+		})
+	}
+	res := <-acquired
+	for ns, cancel := range cancels {
+		if ns != res.namespace {
+			cancel()
+		}
+	}
+	return res.namespace, res.ctx
+}
+
+// getNamespaceLock will return the lease lock that is used to lock given
+// namespace.
+func getNamespaceLock(cli kubernetes.Interface, namespace string) *resourcelock.LeaseLock {
+	return &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      "kubedock-lock",
+			Namespace: namespace,
+		},
+		Client: cli.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: config.InstanceID,
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetNamespacePool(t *testing.T) {
+	cli := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ci-1", Labels: map[string]string{"pool": "ci"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ci-2", Labels: map[string]string{"pool": "ci"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+	)
+	tests := []struct {
+		namespaces string
+		selector   string
+		out        []string
+		err        bool
+	}{
+		{out: []string{"default"}},                                                          // 0
+		{namespaces: "ns1, ns2,ns1", out: []string{"ns1", "ns2"}},                           // 1
+		{selector: "pool=ci", out: []string{"ci-1", "ci-2"}},                                // 2
+		{namespaces: "ci-2,ns1", selector: "pool=ci", out: []string{"ci-2", "ns1", "ci-1"}}, // 3
+		{selector: "pool=none", err: true},                                                  // 4
+	}
+	for i, tst := range tests {
+		setConfig(t, "kubernetes.namespace", "default")
+		setConfig(t, "lock.namespaces", tst.namespaces)
+		setConfig(t, "lock.namespace-selector", tst.selector)
+		res, err := getNamespacePool(cli)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if !tst.err && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestAcquireNamespace(t *testing.T) {
+	holder := "other"
+	duration := int32(60)
+	now := metav1.NewMicroTime(time.Now())
+	cli := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubedock-lock", Namespace: "ci-1"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ns, lctx := acquireNamespace(ctx, cli, []string{"ci-1", "ci-2"})
+	if ns != "ci-2" {
+		t.Errorf("expected to acquire namespace ci-2, but got %s", ns)
+	}
+	if lctx.Err() != nil {
+		t.Errorf("expected lock context to be active")
+	}
+}
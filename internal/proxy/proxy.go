@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// ErrUnknownHost is returned by a Dialer if the requested host is unknown.
+var ErrUnknownHost = errors.New("unknown host")
+
+// Dialer will open a connection to given port of given host.
+type Dialer func(host string, port int) (net.Conn, error)
+
+// Config is the structure to instantiate a Server object.
+type Config struct {
+	// Addr is the address the proxy listens on.
+	Addr string
+	// Dialer is the function that connects to the requested hosts.
+	Dialer Dialer
+}
+
+// Server is a proxy that accepts both SOCKS5 and HTTP CONNECT requests on
+// the same address, and connects them via the configured dialer.
+type Server struct {
+	cfg Config
+}
+
+// New will return a new Server instance.
+func New(cfg Config) *Server {
+	return &Server{cfg: cfg}
+}
+
+// ListenAndServe will start listening for proxy requests. The requests are
+// served in the background, until the stop channel is closed.
+func (s *Server) ListenAndServe(stop <-chan struct{}) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	klog.Infof("socks5 and http connect proxy listening on %s", s.cfg.Addr)
+	go func() {
+		<-stop
+		ln.Close()
+	}()
+	go s.serve(ln)
+	return nil
+}
+
+// serve will handle the connections accepted on given listener.
+func (s *Server) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle will serve given connection as a SOCKS5 request if it starts with
+// the SOCKS5 version, and as an HTTP CONNECT request otherwise.
+func (s *Server) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	br := bufio.NewReader(conn)
+	ver, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	var remote net.Conn
+	if ver[0] == socksVersion {
+		remote, err = s.handleSocks(br, conn)
+	} else {
+		remote, err = s.handleConnect(br, conn)
+	}
+	if err != nil {
+		klog.V(3).Infof("proxy request failed: %s", err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	relay(&bufferedConn{Conn: conn, r: br}, remote)
+}
+
+// dial will connect to given host and port with the dialer.
+func (s *Server) dial(host string, port int) (net.Conn, error) {
+	klog.V(3).Infof("proxying connection to %s", net.JoinHostPort(host, strconv.Itoa(port)))
+	return s.cfg.Dialer(host, port)
+}
+
+const (
+	socksVersion         = 5
+	socksNoAuth          = 0
+	socksNoAcceptable    = 0xff
+	socksConnect         = 1
+	socksIPv4            = 1
+	socksDomain          = 3
+	socksIPv6            = 4
+	socksSucceeded       = 0
+	socksGeneralFailure  = 1
+	socksHostUnreachable = 4
+	socksCmdUnsupported  = 7
+	socksAddrUnsupported = 8
+)
+
+// handleSocks will handle the SOCKS5 handshake and connect request on
+// given connection, and returns the connection to the requested host.
+// Only the CONNECT command without authentication is supported.
+func (s *Server) handleSocks(br *bufio.Reader, conn net.Conn) (net.Conn, error) {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return nil, err
+	}
+	noauth := false
+	for _, m := range methods {
+		if m == socksNoAuth {
+			noauth = true
+		}
+	}
+	if !noauth {
+		conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return nil, fmt.Errorf("socks5 client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return nil, err
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil {
+		return nil, err
+	}
+	if req[1] != socksConnect {
+		socksReply(conn, socksCmdUnsupported)
+		return nil, fmt.Errorf("unsupported socks5 command %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case socksIPv4, socksIPv6:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == socksIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		l, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, l)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddrUnsupported)
+		return nil, fmt.Errorf("unsupported socks5 address type %d", req[3])
+	}
+	pb := make([]byte, 2)
+	if _, err := io.ReadFull(br, pb); err != nil {
+		return nil, err
+	}
+	port := int(binary.BigEndian.Uint16(pb))
+
+	remote, err := s.dial(host, port)
+	if errors.Is(err, ErrUnknownHost) {
+		socksReply(conn, socksHostUnreachable)
+		return nil, err
+	}
+	if err != nil {
+		socksReply(conn, socksGeneralFailure)
+		return nil, err
+	}
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// socksReply will write a SOCKS5 reply with given status to given
+// connection. The bound address is not reported.
+func socksReply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socksVersion, status, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// handleConnect will handle the HTTP CONNECT request on given connection,
+// and returns the connection to the requested host.
+func (s *Server) handleConnect(br *bufio.Reader, conn net.Conn) (net.Conn, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method != http.MethodConnect {
+		httpReply(conn, http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("unsupported http method %s", req.Method)
+	}
+	host, p, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		httpReply(conn, http.StatusBadRequest)
+		return nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		httpReply(conn, http.StatusBadRequest)
+		return nil, err
+	}
+
+	remote, err := s.dial(host, port)
+	if errors.Is(err, ErrUnknownHost) {
+		httpReply(conn, http.StatusNotFound)
+		return nil, err
+	}
+	if err != nil {
+		httpReply(conn, http.StatusBadGateway)
+		return nil, err
+	}
+	if err := httpReply(conn, http.StatusOK); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// httpReply will write an HTTP response with given status to given
+// connection.
+func httpReply(conn net.Conn, status int) error {
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n\r\n", status, http.StatusText(status))
+	return err
+}
+
+// bufferedConn is a net.Conn that reads via the given buffered reader, so
+// data that was already buffered during the handshake is not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read will read from the buffered reader.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// relay will copy the data between both given connections, and closes
+// both connections when done.
+func relay(conn1, conn2 net.Conn) {
+	go io.Copy(conn1, conn2)
+	io.Copy(conn2, conn1)
+	conn1.Close()
+	conn2.Close()
+}
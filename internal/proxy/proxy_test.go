@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+func helloServer(t *testing.T) (int, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("Hello!\n"))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, func() { ln.Close() }
+}
+
+func startProxy(t *testing.T, port int) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	stop := make(chan struct{})
+	srv := New(Config{
+		Addr: addr,
+		Dialer: func(host string, p int) (net.Conn, error) {
+			if host != "tb303" {
+				return nil, ErrUnknownHost
+			}
+			return net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		},
+	})
+	if err := srv.ListenAndServe(stop); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	return addr, func() { close(stop) }
+}
+
+func TestSocks(t *testing.T) {
+	port, closeServer := helloServer(t)
+	defer closeServer()
+	addr, stop := startProxy(t, port)
+	defer stop()
+
+	dialer, err := xproxy.SOCKS5("tcp", addr, nil, xproxy.Direct)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	tests := []struct {
+		host string
+		out  string
+		err  bool
+	}{
+		{host: "tb303:5432", out: "Hello!\n"}, // 0
+		{host: "tr808:5432", err: true},       // 1
+	}
+	for i, tst := range tests {
+		conn, err := dialer.Dial("tcp", tst.host)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		res, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if res != tst.out {
+			t.Errorf("failed test %d - expected %q, but got %q", i, tst.out, res)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	port, closeServer := helloServer(t)
+	defer closeServer()
+	addr, stop := startProxy(t, port)
+	defer stop()
+
+	tests := []struct {
+		req    string
+		status string
+		out    string
+	}{
+		{req: "CONNECT tb303:5432 HTTP/1.1\r\nHost: tb303:5432\r\n\r\n", status: "HTTP/1.1 200 OK", out: "Hello!\n"},    // 0
+		{req: "CONNECT tr808:5432 HTTP/1.1\r\nHost: tr808:5432\r\n\r\n", status: "HTTP/1.1 404 Not Found"},              // 1
+		{req: "GET http://tb303:5432/ HTTP/1.1\r\nHost: tb303:5432\r\n\r\n", status: "HTTP/1.1 405 Method Not Allowed"}, // 2
+	}
+	for i, tst := range tests {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte(tst.req))
+		br := bufio.NewReader(conn)
+		status, _ := br.ReadString('\n')
+		if strings.TrimSpace(status) != tst.status {
+			t.Errorf("failed test %d - expected status %s, but got %s", i, tst.status, status)
+		}
+		if tst.out != "" {
+			br.ReadString('\n')
+			if res, _ := br.ReadString('\n'); res != tst.out {
+				t.Errorf("failed test %d - expected %q, but got %q", i, tst.out, res)
+			}
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,136 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+// lists are the list endpoints that are merged with the lists of the other
+// replicas, with the field that identifies an item. Items of other
+// replicas that are already in the list are ignored (e.g. the predefined
+// networks).
+var lists = map[string]string{
+	"/containers/json":        "Id",
+	"/libpod/containers/json": "Id",
+	"/networks":               "Name",
+}
+
+// bufferWriter is a gin.ResponseWriter that buffers the response, so it
+// can be merged before it's written.
+type bufferWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader will record the status of the response.
+func (w *bufferWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+// WriteHeaderNow is a no-op, the header is written after merging.
+func (w *bufferWriter) WriteHeaderNow() {}
+
+// Status will return the recorded status of the response.
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+// Written will return true if a response has been written.
+func (w *bufferWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// Write will buffer given data.
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// WriteString will buffer given string.
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// aggregate will handle the list request locally, and merges the result
+// with the lists of all other replicas. Items are identified by given key.
+func (f *Forwarder) aggregate(c *gin.Context, key string) {
+	orig := c.Writer
+	buf := &bufferWriter{ResponseWriter: orig, status: http.StatusOK}
+	c.Writer = buf
+	c.Next()
+	c.Writer = orig
+
+	items := []map[string]interface{}{}
+	if buf.status != http.StatusOK || json.Unmarshal(buf.body.Bytes(), &items) != nil {
+		orig.WriteHeader(buf.status)
+		orig.Write(buf.body.Bytes())
+		return
+	}
+
+	replicas, err := f.cr.Backend.GetReplicas()
+	if err != nil {
+		klog.Warningf("error listing replicas: %s", err)
+	}
+	done := map[interface{}]bool{}
+	for _, item := range items {
+		done[item[key]] = true
+	}
+	for _, remote := range f.list(c, replicas) {
+		for _, item := range remote {
+			if !done[item[key]] {
+				done[item[key]] = true
+				items = append(items, item)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// list will request the list of given request from given replicas
+// concurrently, and returns the lists ordered by replica id. Replicas
+// that fail are ignored.
+func (f *Forwarder) list(c *gin.Context, replicas map[string]string) [][]map[string]interface{} {
+	ids := []string{}
+	for id := range replicas {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	res := make([][]map[string]interface{}, len(ids))
+	wg := sync.WaitGroup{}
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, owner string) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodGet, owner+c.Request.URL.RequestURI(), nil)
+			if err != nil {
+				return
+			}
+			req.Header.Set(HeaderForwarded, config.InstanceID)
+			rsp, err := f.client.Do(req)
+			if err != nil {
+				klog.Warningf("error listing %s of %s: %s", c.Request.URL.Path, owner, err)
+				return
+			}
+			defer rsp.Body.Close()
+			body, err := io.ReadAll(rsp.Body)
+			if err != nil || rsp.StatusCode != http.StatusOK {
+				klog.Warningf("error listing %s of %s: status %d", c.Request.URL.Path, owner, rsp.StatusCode)
+				return
+			}
+			if err := json.Unmarshal(body, &res[i]); err != nil {
+				klog.Warningf("error listing %s of %s: %s", c.Request.URL.Path, owner, err)
+			}
+		}(i, replicas[id])
+	}
+	wg.Wait()
+	return res
+}
@@ -0,0 +1,344 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/server/routes/common"
+	"github.com/joyrex2001/kubedock/internal/util/stringid"
+)
+
+// HeaderForwarded is the http header that is added to requests that are
+// forwarded to another replica, to prevent them from being forwarded again.
+const HeaderForwarded = "X-Kubedock-Forwarded"
+
+const (
+	// ownerTTL is the duration the owner of a resource is cached.
+	ownerTTL = time.Minute
+	// unknownTTL is the duration a resource that is not owned by any
+	// other replica is cached.
+	unknownTTL = 5 * time.Second
+)
+
+// resourcePath matches the container, exec and network endpoints that
+// refer to a specific container, exec or network id.
+var resourcePath = regexp.MustCompile(`^(/libpod)?/(containers|exec|networks)/([^/]+)`)
+
+// collections are the path elements that match resourcePath, but don't
+// refer to a specific resource.
+var collections = map[string]bool{
+	"create": true,
+	"json":   true,
+	"prune":  true,
+	"stats":  true,
+}
+
+// broadcasts are the endpoints that are replayed on all other replicas, so
+// the images that are pulled are known by every replica.
+var broadcasts = map[string]bool{
+	"/images/create":      true,
+	"/images/prune":       true,
+	"/libpod/images/pull": true,
+	"/networks/prune":     true,
+}
+
+// createPath matches the endpoint that creates a docker container.
+var createPath = regexp.MustCompile(`^/containers/create$`)
+
+// owner is a cached owner of a resource; an empty url means the resource
+// is not owned by any other replica.
+type owner struct {
+	url     string
+	expires time.Time
+}
+
+// Forwarder will forward requests for containers, execs and networks that
+// are owned by another kubedock replica to that replica.
+type Forwarder struct {
+	cr        *common.ContextRouter
+	client    *http.Client
+	broadcast *http.Client
+	owners    sync.Map
+}
+
+// New will return a new Forwarder instance.
+func New(cr *common.ContextRouter) *Forwarder {
+	return &Forwarder{
+		cr:        cr,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		broadcast: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Middleware is a gin-gonic middleware that will forward requests for
+// containers, execs and networks that are unknown to this replica, to the
+// replica that owns them. Containers that are created in a network of
+// another replica are created by that replica. Lists of containers and
+// networks are merged with the lists of the other replicas, and images
+// are pulled by all replicas.
+func (f *Forwarder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(HeaderForwarded) != "" {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		if c.Request.Method == http.MethodPost && broadcasts[path] {
+			f.replay(c)
+			return
+		}
+		if c.Request.Method == http.MethodGet && lists[path] != "" {
+			f.aggregate(c, lists[path])
+			return
+		}
+		kind, id := f.getResource(c)
+		if kind == "" || f.isLocal(kind, id) {
+			c.Next()
+			return
+		}
+		owner, err := f.getOwner(kind, id)
+		if err != nil {
+			klog.Warningf("error finding owner of %s %s: %s", kind, id, err)
+		}
+		if owner == "" {
+			c.Next()
+			return
+		}
+		if err := f.forward(c, owner, kind+"/"+id); err != nil {
+			klog.Errorf("error forwarding request to %s: %s", owner, err)
+			c.AbortWithStatus(http.StatusBadGateway)
+			return
+		}
+		c.Abort()
+	}
+}
+
+// getResource will return the kind and id of the resource that determines
+// which replica should handle the request, or an empty kind if the request
+// should be handled locally. Requests that create a container refer to the
+// first network of the container that is unknown to this replica.
+func (f *Forwarder) getResource(c *gin.Context) (string, string) {
+	if c.Request.Method == http.MethodPost && createPath.MatchString(c.Request.URL.Path) {
+		for _, id := range f.getCreateNetworks(c) {
+			if !f.isLocal("networks", id) {
+				return "networks", id
+			}
+		}
+		return "", ""
+	}
+	match := resourcePath.FindStringSubmatch(c.Request.URL.Path)
+	if match == nil || collections[match[3]] {
+		return "", ""
+	}
+	return match[2], match[3]
+}
+
+// getCreateNetworks will return the networks that are referred to in the
+// body of a container create request. The body is restored, so it can be
+// read again by the handler or the replica it's forwarded to.
+func (f *Forwarder) getCreateNetworks(c *gin.Context) []string {
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	in := struct {
+		HostConfig struct {
+			NetworkMode string `json:"NetworkMode"`
+		} `json:"HostConfig"`
+		NetworkingConfig struct {
+			EndpointsConfig map[string]struct {
+				NetworkID string `json:"NetworkID"`
+			} `json:"EndpointsConfig"`
+		} `json:"NetworkingConfig"`
+	}{}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil
+	}
+	res := []string{}
+	if net := in.HostConfig.NetworkMode; net != "" && net != "default" {
+		res = append(res, net)
+	}
+	for name, endp := range in.NetworkingConfig.EndpointsConfig {
+		if endp.NetworkID != "" {
+			name = endp.NetworkID
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+// isLocal will return true if given container, exec or network exists in
+// the database of this replica.
+func (f *Forwarder) isLocal(kind, id string) bool {
+	var err error
+	switch kind {
+	case "exec":
+		_, err = f.cr.DB.GetExec(id)
+	case "networks":
+		_, err = f.cr.DB.GetNetworkByNameOrID(id)
+	default:
+		_, err = f.cr.DB.GetContainerByNameOrID(id)
+	}
+	return err == nil
+}
+
+// getOwner will return the url of the replica that owns given container,
+// exec or network. The owner of a started container is recorded on its
+// pod, in other cases the other replicas are asked if they know the
+// resource. Owners are cached for a while, resources that are not known by
+// any replica for a shorter while.
+func (f *Forwarder) getOwner(kind, id string) (string, error) {
+	key := kind + "/" + id
+	if val, ok := f.owners.Load(key); ok {
+		if own := val.(owner); time.Now().Before(own.expires) {
+			return own.url, nil
+		}
+		f.owners.Delete(key)
+	}
+	if kind == "containers" && (stringid.IsShortID(id) || stringid.ValidateID(id) == nil) {
+		url, err := f.cr.Backend.GetOwnerURL(stringid.TruncateID(id))
+		if err != nil {
+			return "", err
+		}
+		if url != "" {
+			f.owners.Store(key, owner{url: url, expires: time.Now().Add(ownerTTL)})
+			return url, nil
+		}
+	}
+	replicas, err := f.cr.Backend.GetReplicas()
+	if err != nil {
+		return "", err
+	}
+	url := f.probe(replicas, kind, id)
+	ttl := ownerTTL
+	if url == "" {
+		ttl = unknownTTL
+	}
+	f.owners.Store(key, owner{url: url, expires: time.Now().Add(ttl)})
+	return url, nil
+}
+
+// probe will ask the given replicas concurrently if they know the given
+// container, exec or network, and returns the url of the first replica
+// that does, or an empty string if none of them know it.
+func (f *Forwarder) probe(replicas map[string]string, kind, id string) string {
+	if len(replicas) == 0 {
+		return ""
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	found := make(chan string, len(replicas))
+	for _, url := range replicas {
+		go func(url string) {
+			if f.knows(ctx, url, kind, id) {
+				found <- url
+				return
+			}
+			found <- ""
+		}(url)
+	}
+	for range replicas {
+		if url := <-found; url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// knows will return true if the replica with given url knows the given
+// container, exec or network.
+func (f *Forwarder) knows(ctx context.Context, owner, kind, id string) bool {
+	path := fmt.Sprintf("%s/%s/%s/json", owner, kind, url.PathEscape(id))
+	if kind == "networks" {
+		path = fmt.Sprintf("%s/%s/%s", owner, kind, url.PathEscape(id))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set(HeaderForwarded, config.InstanceID)
+	res, err := f.client.Do(req)
+	if err != nil {
+		klog.V(3).Infof("error contacting replica %s: %s", owner, err)
+		return false
+	}
+	defer res.Body.Close()
+	return res.StatusCode == http.StatusOK
+}
+
+// forward will proxy the request to the replica with given url. If the
+// replica doesn't know the resource (anymore), the cached owner of given
+// key is removed.
+func (f *Forwarder) forward(c *gin.Context, owner, key string) error {
+	target, err := url.Parse(owner)
+	if err != nil {
+		return err
+	}
+	klog.V(3).Infof("forwarding %s %s to %s", c.Request.Method, c.Request.URL.Path, owner)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.FlushInterval = -1
+	proxy.ModifyResponse = func(res *http.Response) error {
+		if res.StatusCode == http.StatusNotFound {
+			f.owners.Delete(key)
+		}
+		return nil
+	}
+	c.Request.Header.Set(HeaderForwarded, config.InstanceID)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	return nil
+}
+
+// replay will handle the request locally, and replay it on all other
+// replicas concurrently. The request completes when all replicas are done.
+func (f *Forwarder) replay(c *gin.Context) {
+	replicas, err := f.cr.Backend.GetReplicas()
+	if err != nil {
+		klog.Warningf("error listing replicas: %s", err)
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	wg := sync.WaitGroup{}
+	for _, owner := range replicas {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			req, err := http.NewRequest(c.Request.Method, owner+c.Request.URL.RequestURI(), bytes.NewReader(body))
+			if err != nil {
+				klog.Warningf("error replaying request on %s: %s", owner, err)
+				return
+			}
+			req.Header = c.Request.Header.Clone()
+			req.Header.Set(HeaderForwarded, config.InstanceID)
+			res, err := f.broadcast.Do(req)
+			if err != nil {
+				klog.Warningf("error replaying request on %s: %s", owner, err)
+				return
+			}
+			defer res.Body.Close()
+			io.Copy(io.Discard, res.Body)
+			if res.StatusCode >= http.StatusBadRequest {
+				klog.Warningf("error replaying %s on %s: status %d", c.Request.URL.Path, owner, res.StatusCode)
+			}
+		}(owner)
+	}
+	c.Next()
+	wg.Wait()
+}
@@ -0,0 +1,182 @@
+package forward
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/server/routes/common"
+)
+
+func TestMiddleware(t *testing.T) {
+	pulled := int32(0)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderForwarded) == "" {
+			t.Errorf("expected forwarded header on request %s", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/containers/remote/json", "/containers/remote/logs", "/networks/remote", "/networks/remote/connect":
+			w.Write([]byte("peer"))
+		case "/containers/create":
+			body, _ := io.ReadAll(r.Body)
+			w.Write(append([]byte("peer "), body...))
+		case "/containers/json":
+			w.Write([]byte(`[{"Id":"remote"},{"Id":"local"}]`))
+		case "/images/create":
+			atomic.AddInt32(&pulled, 1)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer peer.Close()
+
+	duration := int32(60)
+	now := metav1.NewMicroTime(time.Now())
+	kub, _ := backend.New(backend.Config{Namespace: "default", Client: fake.NewSimpleClientset(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "kubedock-replica-tb303",
+				Namespace:   "default",
+				Labels:      map[string]string{"kubedock.id": "tb303", "kubedock.replica": "true"},
+				Annotations: map[string]string{"kubedock.url": peer.URL},
+			},
+			Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &duration, RenewTime: &now},
+		},
+	)})
+	cr, err := common.NewContextRouter(kub, common.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if err := cr.DB.SaveContainer(&types.Container{Name: "local"}); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(New(cr).Middleware())
+	router.GET("/containers/:id/logs", func(c *gin.Context) {
+		c.String(http.StatusOK, "local")
+	})
+	router.GET("/containers/json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, []gin.H{{"Id": "local"}})
+	})
+	router.POST("/containers/create", func(c *gin.Context) {
+		c.String(http.StatusOK, "local")
+	})
+	router.POST("/networks/:id/connect", func(c *gin.Context) {
+		c.String(http.StatusOK, "local")
+	})
+	router.POST("/images/create", func(c *gin.Context) {
+		c.String(http.StatusOK, "local")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		in     string
+		body   string
+	}{
+		{method: "GET", path: "/containers/remote/logs", body: "peer"},                                                                                    // 0
+		{method: "GET", path: "/containers/local/logs", body: "local"},                                                                                    // 1
+		{method: "GET", path: "/containers/unknown/logs", body: "local"},                                                                                  // 2
+		{method: "GET", path: "/containers/json", body: `[{"Id":"local"},{"Id":"remote"}]`},                                                               // 3
+		{method: "POST", path: "/networks/remote/connect", body: "peer"},                                                                                  // 4
+		{method: "POST", path: "/networks/bridge/connect", body: "local"},                                                                                 // 5
+		{method: "POST", path: "/containers/create", in: `{"HostConfig":{"NetworkMode":"remote"}}`, body: `peer {"HostConfig":{"NetworkMode":"remote"}}`}, // 6
+		{method: "POST", path: "/containers/create", in: `{"HostConfig":{"NetworkMode":"bridge"}}`, body: "local"},                                        // 7
+		{method: "POST", path: "/images/create?fromImage=alpine", body: "local"},                                                                          // 8
+	}
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	for i, tst := range tests {
+		req, _ := http.NewRequest(tst.method, srv.URL+tst.path, strings.NewReader(tst.in))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != tst.body {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.body, body)
+		}
+	}
+	if atomic.LoadInt32(&pulled) != 1 {
+		t.Errorf("expected image pull to be replayed on the other replica")
+	}
+}
+
+func TestGetOwner(t *testing.T) {
+	probes := int32(0)
+	known := int32(1)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probes, 1)
+		if atomic.LoadInt32(&known) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer peer.Close()
+
+	duration := int32(60)
+	now := metav1.NewMicroTime(time.Now())
+	kub, _ := backend.New(backend.Config{Namespace: "default", Client: fake.NewSimpleClientset(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "kubedock-replica-tb303",
+				Namespace:   "default",
+				Labels:      map[string]string{"kubedock.id": "tb303", "kubedock.replica": "true"},
+				Annotations: map[string]string{"kubedock.url": peer.URL},
+			},
+			Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &duration, RenewTime: &now},
+		},
+	)})
+	cr, err := common.NewContextRouter(kub, common.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	f := New(cr)
+
+	if owner, _ := f.getOwner("containers", "remote"); owner != peer.URL {
+		t.Errorf("expected owner %s, but got %s", peer.URL, owner)
+	}
+	if owner, _ := f.getOwner("containers", "remote"); owner != peer.URL || atomic.LoadInt32(&probes) != 1 {
+		t.Errorf("expected cached owner %s, but got %s", peer.URL, owner)
+	}
+
+	// a stale owner is removed when it doesn't know the resource anymore
+	atomic.StoreInt32(&known, 0)
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.GET("/containers/:id/json", func(c *gin.Context) {
+		if err := f.forward(c, peer.URL, "containers/remote"); err != nil {
+			t.Errorf("unexpected error %s", err)
+		}
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	if res, err := http.Get(srv.URL + "/containers/remote/json"); err == nil {
+		res.Body.Close()
+	}
+	if owner, _ := f.getOwner("containers", "remote"); owner != "" {
+		t.Errorf("expected stale owner to be removed, but got %s", owner)
+	}
+
+	// unknown resources are cached as well
+	atomic.StoreInt32(&probes, 0)
+	f.getOwner("containers", "unknown")
+	f.getOwner("containers", "unknown")
+	if atomic.LoadInt32(&probes) != 1 {
+		t.Errorf("expected unknown resource to be cached, but got %d probes", atomic.LoadInt32(&probes))
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"net"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -9,9 +10,14 @@ import (
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/dns"
+	"github.com/joyrex2001/kubedock/internal/proxy"
+	"github.com/joyrex2001/kubedock/internal/server/forward"
 	"github.com/joyrex2001/kubedock/internal/server/httputil"
 	"github.com/joyrex2001/kubedock/internal/server/routes"
 	"github.com/joyrex2001/kubedock/internal/server/routes/common"
+	"github.com/joyrex2001/kubedock/internal/util/myip"
 )
 
 // Server is the API server.
@@ -31,7 +37,7 @@ func (s *Server) Run(ctx context.Context) error {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := s.getGinEngine()
+	router := s.getGinEngine(ctx)
 	router.SetTrustedProxies(nil)
 
 	socket := viper.GetString("server.socket")
@@ -78,7 +84,7 @@ func (s *Server) Run(ctx context.Context) error {
 
 // getGinEngine will return a gin.Engine router and configure the
 // appropriate middleware.
-func (s *Server) getGinEngine() *gin.Engine {
+func (s *Server) getGinEngine(ctx context.Context) *gin.Engine {
 	router := gin.New()
 	router.Use(httputil.VersionAliasMiddleware(router))
 	router.Use(gin.Logger())
@@ -105,6 +111,16 @@ func (s *Server) getGinEngine() *gin.Engine {
 		revprox = false
 	}
 
+	expose := viper.GetString("expose")
+	if expose != "" {
+		klog.Infof("exposing container ports via %s", expose)
+	}
+	if expose != "" && (pfwrd || revprox) {
+		klog.Infof("ignored port-forward and reverse-proxy as expose is enabled")
+		pfwrd = false
+		revprox = false
+	}
+
 	prea := viper.GetBool("pre-archive")
 	if prea {
 		klog.Infof("copying archives without starting containers enabled")
@@ -133,6 +149,39 @@ func (s *Server) getGinEngine() *gin.Engine {
 		klog.Infof("default node selector: %s", nodesel)
 	}
 
+	tols := viper.GetString("kubernetes.tolerations")
+	if tols != "" {
+		klog.Infof("default tolerations: %s", tols)
+	}
+
+	nodeaff := viper.GetString("kubernetes.node-affinity")
+	if nodeaff != "" {
+		klog.Infof("default node affinity: %s", nodeaff)
+	}
+
+	podantiaff := viper.GetString("kubernetes.pod-anti-affinity")
+	if podantiaff != "" {
+		klog.Infof("default pod anti-affinity: %s", podantiaff)
+	}
+
+	prioclass := viper.GetString("kubernetes.priority-class")
+	if prioclass != "" {
+		klog.Infof("default priority class: %s", prioclass)
+	}
+
+	runclass := viper.GetString("kubernetes.runtime-class")
+	if runclass != "" {
+		klog.Infof("default runtime class: %s", runclass)
+	}
+
+	tspread := viper.GetString("kubernetes.topology-spread")
+	if tspread != "" {
+		klog.Infof("default topology spread: %s", tspread)
+	}
+
+	workload := viper.GetString("kubernetes.workload")
+	klog.Infof("default workload: %s", workload)
+
 	pulpol := viper.GetString("kubernetes.pull-policy")
 	klog.Infof("default image pull policy: %s", pulpol)
 
@@ -146,12 +195,25 @@ func (s *Server) getGinEngine() *gin.Engine {
 
 	icm := viper.GetBool("ignore-container-memory")
 
+	inf := !viper.GetBool("disable-informer")
+	if !inf {
+		klog.Infof("pod informer disabled, polling container status")
+	}
+
+	adopt := viper.GetBool("adopt")
+
+	netpols := viper.GetBool("network-policies")
+
+	dnssrv := viper.GetBool("dns")
+
 	pollRate := viper.GetFloat64("server.poll-rate")
 	pollBurst := viper.GetInt("server.poll-burst")
 
-	klog.Infof("using namespace: %s", viper.GetString("kubernetes.namespace"))
+	ns := viper.GetString("kubernetes.namespace")
+	klog.Infof("using namespace: %s", ns)
 
 	cr, err := common.NewContextRouter(s.kub, common.Config{
+		Namespace:               ns,
 		Inspector:               insp,
 		RequestCPU:              reqcpu,
 		RequestMemory:           reqmem,
@@ -159,13 +221,25 @@ func (s *Server) getGinEngine() *gin.Engine {
 		ServiceAccount:          sa,
 		RunasUser:               runasuid,
 		NodeSelector:            nodesel,
+		Tolerations:             tols,
+		NodeAffinity:            nodeaff,
+		PodAntiAffinity:         podantiaff,
+		PriorityClass:           prioclass,
+		RuntimeClass:            runclass,
+		TopologySpread:          tspread,
+		Workload:                workload,
 		PullPolicy:              pulpol,
 		PortForward:             pfwrd,
 		ReverseProxy:            revprox,
+		Expose:                  expose,
 		PreArchive:              prea,
 		NamePrefix:              podprfx,
 		ActiveDeadlineSeconds:   ads,
 		IgnoreContainerMemory:   icm,
+		Informer:                inf,
+		Adopt:                   adopt,
+		NetworkPolicies:         netpols,
+		DNS:                     dnssrv,
 		PollRate:                pollRate,
 		PollBurst:               pollBurst,
 	})
@@ -173,8 +247,84 @@ func (s *Server) getGinEngine() *gin.Engine {
 		klog.Errorf("error setting up context: %s", err)
 	}
 
+	if inf {
+		if err := s.kub.WatchContainers(ctx.Done(), common.ContainerStatusHandler(cr)); err != nil {
+			klog.Errorf("error starting pod informer: %s", err)
+			cr.Config.Informer = false
+		}
+	}
+
+	if err := s.kub.StartHostTunnel(pfwrd, ctx.Done()); err != nil {
+		klog.Errorf("error starting host tunnel: %s", err)
+	}
+
+	if dnssrv {
+		if err := startDNS(ctx, cr); err != nil {
+			klog.Errorf("error starting dns server: %s", err)
+			cr.Config.DNS = false
+		}
+	}
+
+	if viper.GetString("proxy-listen-addr") != "" {
+		if err := startProxy(ctx, cr); err != nil {
+			klog.Errorf("error starting proxy: %s", err)
+		}
+	}
+
+	if viper.GetBool("replicas") {
+		klog.Infof("forwarding requests for containers of other replicas")
+		router.Use(forward.New(cr).Middleware())
+	}
+
+	if adopt {
+		n, err := common.AdoptContainers(cr)
+		if err != nil {
+			klog.Errorf("error adopting containers: %s", err)
+		}
+		klog.Infof("adopted %d containers of kubedock.id=%s", n, config.InstanceID)
+	}
+
 	routes.RegisterDockerRoutes(router, cr)
 	routes.RegisterLibpodRoutes(router, cr)
 
 	return router
 }
+
+// startDNS will start the embedded dns server that resolves the names and
+// network aliases of the containers. If forwarding is enabled, other queries
+// are forwarded to the nameserver that is configured for kubedock itself.
+// By default the dns server only listens on the kubedock ip, rather than on
+// all interfaces.
+func startDNS(ctx context.Context, cr *common.ContextRouter) error {
+	cfg := dns.Config{
+		Addr:     viper.GetString("dns-listen-addr"),
+		Resolver: common.DNSResolver(cr),
+	}
+	if cfg.Addr == "" {
+		ip, err := myip.Get()
+		if err != nil {
+			return err
+		}
+		cfg.Addr = net.JoinHostPort(ip, "53")
+	}
+	fwd := viper.GetBool("dns-forward") || viper.GetBool("dns-inject")
+	rc, err := dns.ReadResolvConf("/etc/resolv.conf")
+	if err != nil {
+		klog.Warningf("error reading resolv.conf, not forwarding dns queries: %s", err)
+	} else {
+		if fwd {
+			cfg.Upstream = rc.Nameserver
+		}
+		cfg.Domains = rc.Search
+	}
+	return dns.New(cfg).ListenAndServe(ctx.Done())
+}
+
+// startProxy will start the socks5 and http connect proxy that connects to
+// the running containers by their name, hostname or network aliases.
+func startProxy(ctx context.Context, cr *common.ContextRouter) error {
+	return proxy.New(proxy.Config{
+		Addr:   viper.GetString("proxy-listen-addr"),
+		Dialer: common.ProxyDialer(cr),
+	}).ListenAndServe(ctx.Done())
+}
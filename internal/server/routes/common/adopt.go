@@ -0,0 +1,69 @@
+package common
+
+import (
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// PersistContainer will store the metadata of given container on its pod,
+// so it can be adopted by a restarted kubedock. This is only done if adopt
+// mode is enabled, and the container is running.
+func PersistContainer(cr *ContextRouter, tainr *types.Container) {
+	if !cr.Config.Adopt || !tainr.Running {
+		return
+	}
+	netws, err := cr.DB.GetNetworksByIDs(tainr.Networks)
+	if err != nil {
+		klog.Warningf("error retrieving networks of container %s: %s", tainr.ShortID, err)
+		return
+	}
+	if err := cr.Backend.PersistContainer(tainr, netws); err != nil {
+		klog.Warningf("error persisting container %s: %s", tainr.ShortID, err)
+	}
+}
+
+// AdoptContainers will restore the containers, and the networks they are
+// connected to, that were persisted on the pods of a previous kubedock
+// instance with the same instance id. It returns the number of adopted
+// containers.
+func AdoptContainers(cr *ContextRouter) (int, error) {
+	tainrs, netws, err := cr.Backend.AdoptContainers()
+	if err != nil {
+		return 0, err
+	}
+
+	// networks are matched by name, as the ids of the predefined networks
+	// differ for each kubedock instance
+	ids := map[string]string{}
+	for _, netw := range netws {
+		if cur, err := cr.DB.GetNetworkByName(netw.Name); err == nil {
+			ids[netw.ID] = cur.ID
+			continue
+		}
+		if err := cr.DB.SaveNetwork(netw); err != nil {
+			return 0, err
+		}
+		ids[netw.ID] = netw.ID
+	}
+
+	for _, tainr := range tainrs {
+		nws := tainr.Networks
+		tainr.Networks = map[string]interface{}{}
+		for id := range nws {
+			if cur, ok := ids[id]; ok {
+				tainr.ConnectNetwork(cur)
+			}
+		}
+		if tainr.Running {
+			if err := exposeContainer(cr, tainr); err != nil {
+				klog.Warningf("error exposing container %s: %s", tainr.ShortID, err)
+			}
+		}
+		if err := cr.DB.SaveContainer(tainr); err != nil {
+			return 0, err
+		}
+		klog.V(2).Infof("adopted container %s (%s)", tainr.ShortID, tainr.Name)
+	}
+	return len(tainrs), nil
+}
@@ -17,10 +17,15 @@ const (
 
 // Config is the structure to instantiate a Router object
 type Config struct {
+	// Namespace is the namespace in which the containers are orchestrated
+	Namespace string
 	// Inspector specifies if the image inspect feature is enabled
 	Inspector bool
 	// PortForward specifies if the the services should be port-forwarded
 	PortForward bool
+	// Expose contains the optional mode in which the container ports are
+	// exposed via k8s services or ingresses (nodeport, loadbalancer, ingress)
+	Expose string
 	// ReverseProxy enables a reverse-proxy to the services via 0.0.0.0 on the kubedock host
 	ReverseProxy bool
 	// RequestCPU contains an optional default k8s cpu request
@@ -43,8 +48,34 @@ type Config struct {
 	NamePrefix string
 	// NodeSelector contains a comma-separated list of key=value pairs that is used to schedule pods to specific nodes
 	NodeSelector string
+	// Tolerations contains a comma-separated list of key[=value][:effect] tolerations
+	Tolerations string
+	// NodeAffinity contains a label selector expression used as required node affinity
+	NodeAffinity string
+	// PodAntiAffinity contains a label selector (optionally with @topologyKey) used as pod anti-affinity
+	PodAntiAffinity string
+	// PriorityClass contains the priority class name to be used for running containers
+	PriorityClass string
+	// RuntimeClass contains the runtime class name to be used for running containers
+	RuntimeClass string
+	// TopologySpread contains a comma-separated list of topologyKey[:maxSkew[:whenUnsatisfiable]] constraints
+	TopologySpread string
+	// Workload contains the default workload (pod or job) used to run containers
+	Workload string
 	// IgnoreContainerMemory is used to ignore Docker memory settings and use requests/limits from Kubedock config
 	IgnoreContainerMemory bool
+	// Informer specifies if container status is served from the backend pod
+	// informer, in which case status requests are not rate-limited.
+	Informer bool
+	// Adopt specifies if containers are persisted on their pods, so they can
+	// be adopted by a restarted kubedock with the same instance id.
+	Adopt bool
+	// NetworkPolicies specifies if docker networks are isolated with network
+	// policies.
+	NetworkPolicies bool
+	// DNS specifies if the embedded dns server is enabled, which requires
+	// the pod ips of the containers to be known.
+	DNS bool
 	// PollRate defines maximum polling requests per second towards the backend.
 	// Defaults to DefaultPollRate if zero.
 	PollRate float64
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"net"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/dns"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// DNSResolver will return a dns resolver that resolves the names, hostnames
+// and network aliases of the running containers to their pod ips. Names are
+// only resolved if the container shares a network with the requesting
+// container; clients that are not a container (e.g. the test runner) can
+// resolve all containers. If the host tunnel is started, the host gateway
+// name is resolved to the ip of the host tunnel.
+func DNSResolver(cr *ContextRouter) dns.Resolver {
+	return func(client net.IP, name string) []net.IP {
+		if gw := cr.Backend.GetHostGateway(); gw != "" && strings.EqualFold(name, backend.HostGatewayName) {
+			return []net.IP{net.ParseIP(gw)}
+		}
+		tainrs, err := cr.DB.GetContainers()
+		if err != nil {
+			klog.Errorf("error retrieving containers: %s", err)
+			return nil
+		}
+		var networks map[string]interface{}
+		for _, tainr := range tainrs {
+			if tainr.Running && tainr.PodIP == client.String() {
+				networks = tainr.Networks
+				break
+			}
+		}
+		var res []net.IP
+		for _, tainr := range tainrs {
+			if !tainr.Running || tainr.PodIP == "" {
+				continue
+			}
+			if ip := net.ParseIP(tainr.PodIP); ip != nil && hasDNSName(tainr, networks, name) {
+				res = append(res, ip)
+			}
+		}
+		return res
+	}
+}
+
+// hasDNSName will return true if given container can be resolved with given
+// name from a container that is connected to given networks. If networks is
+// nil, the client is not a container and all networks are considered.
+func hasDNSName(tainr *types.Container, networks map[string]interface{}, name string) bool {
+	shared := networks == nil
+	for id := range tainr.Networks {
+		if _, ok := networks[id]; ok {
+			shared = true
+		}
+	}
+	if !shared {
+		return false
+	}
+	for _, n := range []string{tainr.Name, tainr.Hostname, tainr.ShortID, tainr.GetPodName()} {
+		if n != "" && strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	for _, alias := range tainr.NetworkAliases {
+		if !strings.EqualFold(alias, name) {
+			continue
+		}
+		// aliases that were added when connecting to specific networks, are
+		// only resolvable from within these networks
+		scoped := false
+		for id, aliases := range tainr.EndpointAliases {
+			for _, a := range aliases {
+				if a != alias || networks == nil {
+					continue
+				}
+				if _, ok := networks[id]; ok {
+					return true
+				}
+				scoped = true
+			}
+		}
+		return !scoped
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestHasDNSName(t *testing.T) {
+	tainr := &types.Container{
+		Name:           "tb303",
+		Networks:       map[string]interface{}{"net1": nil, "net2": nil, "net3": nil},
+		NetworkAliases: []string{"db", "cache"},
+		EndpointAliases: map[string][]string{
+			"net1": {"db"},
+			"net2": {"db"},
+		},
+	}
+	tests := []struct {
+		networks map[string]interface{}
+		name     string
+		out      bool
+	}{
+		{map[string]interface{}{"net1": nil}, "tb303", true},  // 0
+		{map[string]interface{}{"net4": nil}, "tb303", false}, // 1
+		{map[string]interface{}{"net1": nil}, "db", true},     // 2
+		{map[string]interface{}{"net2": nil}, "db", true},     // 3
+		{map[string]interface{}{"net3": nil}, "db", false},    // 4
+		{map[string]interface{}{"net3": nil}, "cache", true},  // 5
+		{nil, "db", true}, // 6
+		{map[string]interface{}{"net1": nil}, "tr808", false}, // 7
+	}
+	for i, tst := range tests {
+		// repeat to cover the random iteration order of the networks
+		for n := 0; n < 20; n++ {
+			if res := hasDNSName(tainr, tst.networks, tst.name); res != tst.out {
+				t.Errorf("failed test %d - expected %t, but got %t", i, tst.out, res)
+				break
+			}
+		}
+	}
+}
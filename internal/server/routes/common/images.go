@@ -42,7 +42,7 @@ func ImageJSON(cr *ContextRouter, c *gin.Context) {
 	if err != nil {
 		img = &types.Image{Name: id}
 		if cr.Config.Inspector {
-			pts, err := cr.Backend.GetImageExposedPorts(id)
+			pts, err := cr.Backend.GetImageExposedPorts(id, "")
 			if err != nil {
 				httputil.Error(c, http.StatusInternalServerError, err)
 				return
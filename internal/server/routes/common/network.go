@@ -0,0 +1,35 @@
+package common
+
+import (
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// CreateNetworkPolicies will make sure the network policies of all networks
+// given container is connected to exist, before the container is started.
+func CreateNetworkPolicies(cr *ContextRouter, tainr *types.Container) error {
+	netws, err := cr.DB.GetNetworksByIDs(tainr.Networks)
+	if err != nil {
+		return err
+	}
+	for _, netw := range netws {
+		if err := cr.Backend.CreateNetworkPolicy(netw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateContainerNetworks will reconcile the network membership, and the
+// alias services of given container in kubernetes, after it has been
+// connected to, or disconnected from a network. This is only required if
+// the container is running; otherwise it is done when it's started.
+func UpdateContainerNetworks(cr *ContextRouter, tainr *types.Container) {
+	if !tainr.Running {
+		return
+	}
+	if err := cr.Backend.UpdateContainerNetworks(tainr); err != nil {
+		klog.Warningf("error updating networks of container %s: %s", tainr.ShortID, err)
+	}
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/proxy"
+)
+
+// ProxyDialer will return a dialer that connects to the running containers
+// by their name, hostname or network aliases. When port-forwarding is
+// enabled, the connection is made via the port-forward api, otherwise the
+// pod ip of the container is connected to directly.
+func ProxyDialer(cr *ContextRouter) proxy.Dialer {
+	return func(host string, port int) (net.Conn, error) {
+		tainr, err := getProxyContainer(cr, host)
+		if err != nil {
+			return nil, err
+		}
+		if cr.Config.PortForward {
+			return cr.Backend.DialContainer(tainr, port)
+		}
+		ip, err := cr.Backend.GetPodIP(tainr)
+		if err != nil {
+			return nil, err
+		}
+		return net.DialTimeout("tcp", net.JoinHostPort(ip, fmt.Sprintf("%d", port)), 10*time.Second)
+	}
+}
+
+// getProxyContainer will return the running container that can be reached
+// with given host name. If no container matches, ErrUnknownHost is
+// returned.
+func getProxyContainer(cr *ContextRouter, host string) (*types.Container, error) {
+	tainrs, err := cr.DB.GetContainers()
+	if err != nil {
+		klog.Errorf("error retrieving containers: %s", err)
+		return nil, err
+	}
+	for _, tainr := range tainrs {
+		if tainr.Running && hasDNSName(tainr, nil, host) {
+			return tainr, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", proxy.ErrUnknownHost, host)
+}
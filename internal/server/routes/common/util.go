@@ -1,36 +1,46 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 )
 
 // StartContainer will start given container and saves the appropriate state
 // in the database.
 func StartContainer(cr *ContextRouter, tainr *types.Container) error {
+	if err := CreateNetworkPolicies(cr, tainr); err != nil {
+		return err
+	}
+
 	state, err := cr.Backend.StartContainer(tainr)
 	if err != nil {
+		var derr *backend.DeployError
+		if errors.As(err, &derr) {
+			cr.Events.PublishWithAttributes(tainr.ID, events.Container, events.Error, map[string]string{
+				"reason":  derr.Reason,
+				"message": derr.Message,
+			})
+		}
 		return err
 	}
 
-	tainr.HostIP = "0.0.0.0"
-	if cr.Config.PortForward {
-		cr.Backend.CreatePortForwards(tainr)
-	} else {
-		if len(tainr.GetServicePorts()) > 0 {
-			ip, err := cr.Backend.GetPodIP(tainr)
-			if err != nil {
-				return err
-			}
-			tainr.HostIP = ip
-			if cr.Config.ReverseProxy {
-				cr.Backend.CreateReverseProxies(tainr)
-			}
+	if err := exposeContainer(cr, tainr); err != nil {
+		return err
+	}
+
+	if cr.Config.DNS {
+		ip, err := cr.Backend.GetPodIP(tainr)
+		if err != nil {
+			return err
 		}
+		tainr.PodIP = ip
 	}
 
 	tainr.Stopped = false
@@ -39,7 +49,36 @@ func StartContainer(cr *ContextRouter, tainr *types.Container) error {
 	tainr.Completed = (state == backend.DeployCompleted)
 	tainr.Running = (state == backend.DeployRunning)
 
-	return cr.DB.SaveContainer(tainr)
+	if err := cr.DB.SaveContainer(tainr); err != nil {
+		return err
+	}
+	PersistContainer(cr, tainr)
+	return nil
+}
+
+// exposeContainer will make the services of given started container
+// available, either via k8s services or ingresses, via port-forwards, or
+// the pod ip (optionally via a reverse-proxy).
+func exposeContainer(cr *ContextRouter, tainr *types.Container) error {
+	tainr.HostIP = "0.0.0.0"
+	if cr.Config.Expose != "" {
+		return cr.Backend.ExposeContainer(tainr)
+	}
+	if cr.Config.PortForward {
+		cr.Backend.CreatePortForwards(tainr)
+		return nil
+	}
+	if len(tainr.GetServicePorts()) > 0 || len(tainr.GetServiceUDPPorts()) > 0 {
+		ip, err := cr.Backend.GetPodIP(tainr)
+		if err != nil {
+			return err
+		}
+		tainr.HostIP = ip
+		if cr.Config.ReverseProxy {
+			cr.Backend.CreateReverseProxies(tainr)
+		}
+	}
+	return nil
 }
 
 // UpdateContainerStatus will check if the started container is finished and will
@@ -48,7 +87,9 @@ func UpdateContainerStatus(cr *ContextRouter, tainr *types.Container) {
 	if tainr.Completed {
 		return
 	}
-	if !cr.Limiter.Allow() {
+	// with the informer, the status is served from the cache; if the pod is
+	// not (yet) cached, the api is used, which is rate-limited as well
+	if !(cr.Config.Informer && cr.Backend.IsPodCached(tainr)) && !cr.Limiter.Allow() {
 		klog.V(2).Infof("rate-limited status request for container: %s", tainr.ID)
 		return
 	}
@@ -63,3 +104,76 @@ func UpdateContainerStatus(cr *ContextRouter, tainr *types.Container) {
 		tainr.Running = false
 	}
 }
+
+// ContainerStatusHandler will return a handler that updates the container
+// database record when the state of a running container changes, as
+// reported by the backend pod informer. When the container finished or
+// failed, a die event is published.
+func ContainerStatusHandler(cr *ContextRouter) backend.StatusHandler {
+	return func(id string, state backend.DeployState, err error) {
+		tainr, derr := cr.DB.GetContainer(id)
+		if derr != nil {
+			return
+		}
+		// state transitions until running are handled by StartContainer
+		if !tainr.Running || tainr.Stopped || tainr.Killed {
+			return
+		}
+		// the record is shared with concurrent readers, hence a copy is
+		// updated and saved instead
+		cp := *tainr
+		tainr = &cp
+		switch state {
+		case backend.DeployCompleted:
+			tainr.Finished = time.Now()
+			tainr.Completed = true
+		case backend.DeployFailed:
+			klog.Warningf("container status error: %s", err)
+			tainr.Finished = time.Now()
+			tainr.Failed = true
+		default:
+			return
+		}
+		tainr.Running = false
+		if err := cr.DB.SaveContainer(tainr); err != nil {
+			klog.Errorf("error saving container %s: %s", tainr.ShortID, err)
+		}
+		cr.Events.Publish(tainr.ID, events.Container, events.Die)
+	}
+}
+
+// WaitContainer will block until the container that is returned by given
+// getter is finished, stopped or removed, and returns true. It returns false
+// if given context is done before. If the pod informer is enabled, it waits
+// for the die event of the container, instead of polling its status every
+// second; the record is only rechecked periodically as a safety net.
+func WaitContainer(ctx context.Context, cr *ContextRouter, get func() (*types.Container, error)) bool {
+	var evts <-chan events.Message
+	poll := time.Second
+	if cr.Config.Informer {
+		el, sid := cr.Events.Subscribe()
+		defer cr.Events.Unsubscribe(sid)
+		evts = el
+		poll = 30 * time.Second
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		tainr, err := get()
+		if err == nil && !cr.Config.Informer {
+			UpdateContainerStatus(cr, tainr)
+		}
+		if err != nil || tainr.Stopped || tainr.Killed || tainr.Completed || !tainr.Finished.IsZero() {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case msg := <-evts:
+			if msg.Type == events.Container && msg.Action == events.Die && msg.ID == tainr.ID {
+				return true
+			}
+		case <-ticker.C:
+		}
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"k8s.io/klog"
 
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/config"
 	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/server/filter"
@@ -51,6 +52,7 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		ImagePorts:   map[string]interface{}{},
 		Labels:       in.Labels,
 		Binds:        in.HostConfig.Binds,
+		ExtraHosts:   in.HostConfig.ExtraHosts,
 		Mounts:       mounts,
 		PreArchives:  []types.PreArchive{},
 		Tty:          in.TTY,
@@ -63,12 +65,25 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		for pp := range img.ExposedPorts {
 			tainr.ImagePorts[pp] = pp
 		}
+		tainr.Platform = img.Platform
+	}
+
+	if platform := c.Query("platform"); platform != "" {
+		if _, err := types.ParsePlatform(platform); err != nil {
+			httputil.Error(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := checkPlatform(cr, in.Image, platform); err != nil {
+			httputil.Error(c, http.StatusNotFound, err)
+			return
+		}
+		tainr.Platform = platform
 	}
 
 	for dst, ports := range in.HostConfig.PortBindings {
 		for _, src := range ports {
-			if err := tainr.AddHostPort(src.HostPort, dst); err != nil {
-				httputil.Error(c, http.StatusInternalServerError, err)
+			if err := tainr.AddHostBinding(src.HostIP, src.HostPort, dst); err != nil {
+				httputil.Error(c, http.StatusBadRequest, err)
 				return
 			}
 		}
@@ -85,16 +100,24 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		tainr.ConnectNetwork(netw.ID)
 	}
 
-	for _, endp := range in.NetworkConfig.EndpointsConfig {
-		addNetworkAliases(tainr, endp)
-		if endp.NetworkID != "" {
-			netw, err := cr.DB.GetNetworkByNameOrID(endp.NetworkID)
-			if err != nil {
-				httputil.Error(c, http.StatusInternalServerError, err)
-				return
-			}
-			tainr.ConnectNetwork(netw.ID)
+	// the endpoints are keyed by network name; the aliases of an endpoint of
+	// a known network are only resolvable within that network
+	for name, endp := range in.NetworkConfig.EndpointsConfig {
+		id := endp.NetworkID
+		if id == "" {
+			id = name
+		}
+		netw, err := cr.DB.GetNetworkByNameOrID(id)
+		if err != nil && endp.NetworkID != "" {
+			httputil.Error(c, http.StatusInternalServerError, err)
+			return
+		}
+		if err != nil {
+			addNetworkAliases(tainr, endp)
+			continue
 		}
+		tainr.ConnectNetwork(netw.ID)
+		tainr.AddNetworkAliases(netw.ID, endp.Aliases)
 	}
 
 	if len(tainr.Networks) == 0 {
@@ -159,6 +182,27 @@ func getContainerCreateRequest(c *gin.Context, cr *common.ContextRouter) (*Conta
 	if _, ok := in.Labels[types.LabelNodeSelector]; !ok && cr.Config.NodeSelector != "" {
 		in.Labels[types.LabelNodeSelector] = cr.Config.NodeSelector
 	}
+	if _, ok := in.Labels[types.LabelTolerations]; !ok && cr.Config.Tolerations != "" {
+		in.Labels[types.LabelTolerations] = cr.Config.Tolerations
+	}
+	if _, ok := in.Labels[types.LabelNodeAffinity]; !ok && cr.Config.NodeAffinity != "" {
+		in.Labels[types.LabelNodeAffinity] = cr.Config.NodeAffinity
+	}
+	if _, ok := in.Labels[types.LabelPodAntiAffinity]; !ok && cr.Config.PodAntiAffinity != "" {
+		in.Labels[types.LabelPodAntiAffinity] = cr.Config.PodAntiAffinity
+	}
+	if _, ok := in.Labels[types.LabelPriorityClass]; !ok && cr.Config.PriorityClass != "" {
+		in.Labels[types.LabelPriorityClass] = cr.Config.PriorityClass
+	}
+	if _, ok := in.Labels[types.LabelRuntimeClass]; !ok && cr.Config.RuntimeClass != "" {
+		in.Labels[types.LabelRuntimeClass] = cr.Config.RuntimeClass
+	}
+	if _, ok := in.Labels[types.LabelTopologySpread]; !ok && cr.Config.TopologySpread != "" {
+		in.Labels[types.LabelTopologySpread] = cr.Config.TopologySpread
+	}
+	if _, ok := in.Labels[types.LabelWorkload]; !ok && cr.Config.Workload != "" {
+		in.Labels[types.LabelWorkload] = cr.Config.Workload
+	}
 	if _, ok := in.Labels[types.LabelActiveDeadlineSeconds]; !ok && cr.Config.ActiveDeadlineSeconds >= 0 {
 		in.Labels[types.LabelActiveDeadlineSeconds] = fmt.Sprintf("%d", cr.Config.ActiveDeadlineSeconds)
 	}
@@ -172,26 +216,26 @@ func getContainerCreateRequest(c *gin.Context, cr *common.ContextRouter) (*Conta
 	return in, nil
 }
 
+// checkPlatform will check if the image has a variant for given (valid)
+// platform, if the image inspector is enabled.
+func checkPlatform(cr *common.ContextRouter, image, platform string) error {
+	if !cr.Config.Inspector {
+		return nil
+	}
+	_, err := cr.Backend.GetImageExposedPorts(image, platform)
+	return err
+}
+
 // ContainerWait - Block until a container stops, then returns the exit code.
 // https://docs.docker.com/engine/api/v1.41/#operation/ContainerWait
 // POST "/containers/:id/wait"
 func ContainerWait(cr *common.ContextRouter, c *gin.Context) {
 	id := c.Param("id")
-	ticker := time.NewTicker(time.Second)
-	for {
-		select {
-		case <-c.Request.Context().Done():
-			return
-		case <-ticker.C:
-			tainr, err := cr.DB.GetContainer(id)
-			if err == nil {
-				common.UpdateContainerStatus(cr, tainr)
-			}
-			if err != nil || tainr.Stopped || tainr.Killed || tainr.Completed {
-				c.JSON(http.StatusOK, gin.H{"StatusCode": 0})
-				return
-			}
-		}
+	get := func() (*types.Container, error) {
+		return cr.DB.GetContainer(id)
+	}
+	if common.WaitContainer(c.Request.Context(), cr, get) {
+		c.JSON(http.StatusOK, gin.H{"StatusCode": 0})
 	}
 }
 
@@ -346,25 +390,26 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 // getNetworkSettingsPorts will return the available ports of the container
 // as a gin.H json structure to be used in container details.
 func getNetworkSettingsPorts(cr *common.ContextRouter, tainr *types.Container) gin.H {
-	ports := getAvailablePorts(cr, tainr)
 	res := gin.H{}
 	if tainr.HostIP == "" {
 		return res
 	}
-	for dst, prts := range ports {
-		pp := []map[string]string{}
-		done := map[int]int{}
-		for _, src := range prts {
-			if _, ok := done[src]; ok {
-				continue
+	for _, proto := range []string{"tcp", "udp"} {
+		for dst, prts := range getAvailablePorts(cr, tainr, proto) {
+			pp := []map[string]string{}
+			done := map[int]int{}
+			for _, src := range prts {
+				if _, ok := done[src]; ok {
+					continue
+				}
+				pp = append(pp, map[string]string{
+					"HostIp":   getHostIP(tainr, src, dst, proto),
+					"HostPort": fmt.Sprintf("%d", src),
+				})
+				done[src] = 1
 			}
-			pp = append(pp, map[string]string{
-				"HostIp":   tainr.HostIP,
-				"HostPort": fmt.Sprintf("%d", src),
-			})
-			done[src] = 1
+			res[fmt.Sprintf("%d/%s", dst, proto)] = pp
 		}
-		res[fmt.Sprintf("%d/tcp", dst)] = pp
 	}
 	return res
 }
@@ -376,8 +421,10 @@ func getConfigExposedPorts(cr *common.ContextRouter, tainr *types.Container) gin
 	if tainr.HostIP == "" {
 		return res
 	}
-	for dst := range getAvailablePorts(cr, tainr) {
-		res[fmt.Sprintf("%d/tcp", dst)] = gin.H{}
+	for _, proto := range []string{"tcp", "udp"} {
+		for dst := range getAvailablePorts(cr, tainr, proto) {
+			res[fmt.Sprintf("%d/%s", dst, proto)] = gin.H{}
+		}
 	}
 	return res
 }
@@ -385,35 +432,50 @@ func getConfigExposedPorts(cr *common.ContextRouter, tainr *types.Container) gin
 // getContainerPorts will return the available ports of the container as
 // a gin.H json structure to be used in container list.
 func getContainerPorts(cr *common.ContextRouter, tainr *types.Container) []map[string]interface{} {
-	ports := getAvailablePorts(cr, tainr)
 	res := []map[string]interface{}{}
 	if tainr.HostIP == "" {
 		return res
 	}
-	for dst, prts := range ports {
-		done := map[int]int{}
-		for _, src := range prts {
-			if _, ok := done[src]; ok {
-				continue
-			}
-			pp := map[string]interface{}{
-				"IP":          tainr.HostIP,
-				"PrivatePort": dst,
-				"Type":        "tcp",
-			}
-			if src > 0 {
-				pp["PublicPort"] = src
+	for _, proto := range []string{"tcp", "udp"} {
+		for dst, prts := range getAvailablePorts(cr, tainr, proto) {
+			done := map[int]int{}
+			for _, src := range prts {
+				if _, ok := done[src]; ok {
+					continue
+				}
+				pp := map[string]interface{}{
+					"IP":          getHostIP(tainr, src, dst, proto),
+					"PrivatePort": dst,
+					"Type":        proto,
+				}
+				if src > 0 {
+					pp["PublicPort"] = src
+				}
+				res = append(res, pp)
+				done[src] = 1
 			}
-			res = append(res, pp)
-			done[src] = 1
 		}
 	}
 	return res
 }
 
-// getAvailablePorts will return all ports that are currently available on
-// the running container.
-func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int][]int {
+// getHostIP will return the host on which given container port is
+// available via given host port; this is the host of the ingress if the
+// port is exposed via an ingress, the ip the port-forward or reverse-proxy
+// is listening on, or the host ip of the container otherwise.
+func getHostIP(tainr *types.Container, src, dst int, proto string) string {
+	if host, ok := tainr.IngressHosts[dst]; ok && proto == "tcp" {
+		return host
+	}
+	if ip := tainr.GetListenIP(src, proto); ip != "" {
+		return ip
+	}
+	return tainr.HostIP
+}
+
+// getAvailablePorts will return all ports with given protocol (tcp or udp)
+// that are currently available on the running container.
+func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container, proto string) map[int][]int {
 	ports := map[int][]int{}
 	add := func(prts map[int]int) {
 		for src, dst := range prts {
@@ -426,6 +488,35 @@ func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int
 			ports[dst] = append(ports[dst], src)
 		}
 	}
+	if cr.Config.Expose == backend.ExposeIngress {
+		if proto == "tcp" {
+			for dst := range tainr.IngressHosts {
+				ports[dst] = []int{80}
+			}
+		}
+		return ports
+	}
+	if cr.Config.Expose != "" {
+		if proto == "udp" {
+			add(tainr.UDPMappedPorts)
+		} else {
+			add(tainr.MappedPorts)
+		}
+		return ports
+	}
+	if proto == "udp" {
+		if cr.Config.PortForward && !cr.Config.ReverseProxy && !config.InCluster() {
+			// udp is not relayed, as the pod ip is not reachable
+			return ports
+		}
+		if cr.Config.PortForward || cr.Config.ReverseProxy {
+			add(tainr.UDPHostPorts)
+			add(tainr.UDPMappedPorts)
+		} else {
+			add(tainr.GetServiceUDPPorts())
+		}
+		return ports
+	}
 	if cr.Config.PortForward || cr.Config.ReverseProxy {
 		add(tainr.HostPorts)
 		add(tainr.MappedPorts)
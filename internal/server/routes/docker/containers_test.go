@@ -19,6 +19,7 @@ func TestGetNetworkSettingsPorts(t *testing.T) {
 		endp   EndpointConfig
 		out    gin.H
 		portfw bool
+		extern bool
 	}{
 		{
 			tainr: &types.Container{
@@ -83,8 +84,54 @@ func TestGetNetworkSettingsPorts(t *testing.T) {
 			}},
 			portfw: false,
 		},
+		{
+			tainr: &types.Container{
+				HostIP:       "0.0.0.0",
+				MappedPorts:  map[int]int{303: 101},
+				UDPHostPorts: map[int]int{202: 101},
+				ListenIPs:    map[string]string{"303/tcp": "127.0.0.1", "202/udp": "192.168.1.1"},
+			},
+			out: gin.H{
+				"101/tcp": []map[string]string{{"HostIp": "127.0.0.1", "HostPort": "303"}},
+				"101/udp": []map[string]string{{"HostIp": "192.168.1.1", "HostPort": "202"}},
+			},
+			portfw: true,
+		},
+		{
+			tainr: &types.Container{
+				HostIP:       "0.0.0.0",
+				MappedPorts:  map[int]int{303: 101},
+				UDPHostPorts: map[int]int{202: 101},
+				ListenIPs:    map[string]string{"303/tcp": "127.0.0.1", "202/udp": "192.168.1.1"},
+			},
+			out: gin.H{
+				"101/tcp": []map[string]string{{"HostIp": "127.0.0.1", "HostPort": "303"}},
+			},
+			portfw: true,
+			extern: true,
+		},
+		{
+			tainr: &types.Container{
+				HostIP:      "0.0.0.0",
+				MappedPorts: map[int]int{303: 101},
+				HostPorts:   map[int]int{202: 101},
+				ListenIPs:   map[string]string{"303/tcp": "127.0.0.1", "202/tcp": "192.168.1.1"},
+			},
+			out: gin.H{
+				"101/tcp": []map[string]string{
+					{"HostIp": "192.168.1.1", "HostPort": "202"},
+					{"HostIp": "127.0.0.1", "HostPort": "303"},
+				},
+			},
+			portfw: true,
+		},
 	}
 	for i, tst := range tests {
+		if tst.extern {
+			t.Setenv("KUBERNETES_SERVICE_HOST", "")
+		} else {
+			t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+		}
 		cr := &common.ContextRouter{Config: common.Config{PortForward: tst.portfw}}
 		res := getNetworkSettingsPorts(cr, tst.tainr)
 		if !reflect.DeepEqual(res, tst.out) {
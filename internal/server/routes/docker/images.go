@@ -20,9 +20,16 @@ func ImageCreate(cr *common.ContextRouter, c *gin.Context) {
 	if tag != "" {
 		from = from + ":" + tag
 	}
-	img := &types.Image{Name: from}
+	platform := c.Query("platform")
+	if platform != "" {
+		if _, err := types.ParsePlatform(platform); err != nil {
+			httputil.Error(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	img := &types.Image{Name: from, Platform: platform}
 	if cr.Config.Inspector {
-		pts, err := cr.Backend.GetImageExposedPorts(from)
+		pts, err := cr.Backend.GetImageExposedPorts(from, platform)
 		if err != nil {
 			httputil.Error(c, http.StatusInternalServerError, err)
 			return
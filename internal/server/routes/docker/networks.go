@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"k8s.io/klog"
 
+	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/server/filter"
 	"github.com/joyrex2001/kubedock/internal/server/httputil"
@@ -39,6 +40,7 @@ func NetworksList(cr *common.ContextRouter, c *gin.Context) {
 				"Attachable": true,
 				"Containers": tainrs,
 				"Labels":     netw.Labels,
+				"Internal":   netw.Internal,
 			})
 		}
 	}
@@ -64,6 +66,7 @@ func NetworksInfo(cr *common.ContextRouter, c *gin.Context) {
 		"Attachable": true,
 		"Containers": tainrs,
 		"Labels":     netw.Labels,
+		"Internal":   netw.Internal,
 	})
 }
 
@@ -77,13 +80,19 @@ func NetworksCreate(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 	netw := &types.Network{
-		Name:   in.Name,
-		Labels: in.Labels,
+		Name:     in.Name,
+		Labels:   in.Labels,
+		Internal: in.Internal,
 	}
 	if err := cr.DB.SaveNetwork(netw); err != nil {
 		httputil.Error(c, http.StatusInternalServerError, err)
 		return
 	}
+	if err := cr.Backend.CreateNetworkPolicy(netw); err != nil {
+		_ = cr.DB.DeleteNetwork(netw)
+		httputil.Error(c, http.StatusInternalServerError, err)
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{
 		"Id": netw.ID,
 	})
@@ -110,6 +119,9 @@ func NetworksDelete(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 
+	if err := cr.Backend.DeleteNetworkPolicy(netw); err != nil {
+		klog.Warningf("error deleting network policy of network %s: %s", netw.Name, err)
+	}
 	if err := cr.DB.DeleteNetwork(netw); err != nil {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
@@ -138,17 +150,21 @@ func NetworksConnect(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 
+	if err := cr.Backend.CreateNetworkPolicy(netw); err != nil {
+		httputil.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
 	tainr.ConnectNetwork(netw.ID)
-	n := len(tainr.NetworkAliases)
-	addNetworkAliases(tainr, in.EndpointConfig)
+	tainr.AddNetworkAliases(netw.ID, in.EndpointConfig.Aliases)
 
-	if tainr.Running && n != len(tainr.NetworkAliases) {
-		klog.Warningf("adding networkaliases to a running container, will not create new services...")
-	}
 	if err := cr.DB.SaveContainer(tainr); err != nil {
 		httputil.Error(c, http.StatusInternalServerError, err)
 		return
 	}
+	common.UpdateContainerNetworks(cr, tainr)
+	common.PersistContainer(cr, tainr)
+	publishNetworkEvent(cr, netw, tainr, events.Connect)
 	c.JSON(http.StatusCreated, gin.H{
 		"ID": netw.ID,
 	})
@@ -186,6 +202,9 @@ func NetworksDisconnect(cr *common.ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusInternalServerError, err)
 		return
 	}
+	common.UpdateContainerNetworks(cr, tainr)
+	common.PersistContainer(cr, tainr)
+	publishNetworkEvent(cr, netw, tainr, events.Disconnect)
 	c.Writer.WriteHeader(http.StatusNoContent)
 }
 
@@ -204,6 +223,9 @@ func NetworksPrune(cr *common.ContextRouter, c *gin.Context) {
 		if netw.IsPredefined() || len(getContainersInNetwork(cr, netw)) != 0 {
 			continue
 		}
+		if err := cr.Backend.DeleteNetworkPolicy(netw); err != nil {
+			klog.Warningf("error deleting network policy of network %s: %s", netw.Name, err)
+		}
 		if err := cr.DB.DeleteNetwork(netw); err != nil {
 			httputil.Error(c, http.StatusNotFound, err)
 			return
@@ -216,6 +238,16 @@ func NetworksPrune(cr *common.ContextRouter, c *gin.Context) {
 	})
 }
 
+// publishNetworkEvent will publish a network event with given action for
+// given network and container.
+func publishNetworkEvent(cr *common.ContextRouter, netw *types.Network, tainr *types.Container, action string) {
+	cr.Events.PublishWithAttributes(netw.ID, events.Network, action, map[string]string{
+		"container": tainr.ID,
+		"name":      netw.Name,
+		"type":      "bridge",
+	})
+}
+
 // getContainersInNetwork will return an array of containers in an array
 // of gin.H structs, containing the details of the container.
 func getContainersInNetwork(cr *common.ContextRouter, netw *types.Network) map[string]gin.H {
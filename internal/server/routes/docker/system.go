@@ -20,6 +20,7 @@ func Info(cr *common.ContextRouter, c *gin.Context) {
 	for k, v := range config.DefaultLabels {
 		labels = append(labels, k+"="+v)
 	}
+	labels = append(labels, "com.joyrex2001.kubedock.namespace="+cr.Config.Namespace)
 	c.JSON(http.StatusOK, gin.H{
 		"ID":              config.ID,
 		"Name":            config.Name,
@@ -86,7 +87,8 @@ func Events(cr *common.ContextRouter, c *gin.Context) {
 					"Status": msg.Action,
 					"Action": msg.Action,
 					"Actor": gin.H{
-						"ID": msg.ID,
+						"ID":         msg.ID,
+						"Attributes": msg.Attributes,
 					},
 					"scope":    "local",
 					"time":     msg.Time,
@@ -21,8 +21,9 @@ type ContainerCreateRequest struct {
 // NetworkCreateRequest represents the json structure that
 // is used for the /networks/create post endpoint.
 type NetworkCreateRequest struct {
-	Name   string            `json:"Name"`
-	Labels map[string]string `json:"Labels"`
+	Name     string            `json:"Name"`
+	Labels   map[string]string `json:"Labels"`
+	Internal bool              `json:"Internal"`
 }
 
 // NetworkConnectRequest represents the json structure that
@@ -43,13 +44,15 @@ type HostConfig struct {
 	Binds        []string `json:"Binds"`
 	Mounts       []Mount  `json:"Mounts"`
 	PortBindings map[string][]PortBinding
-	Memory       int    `json:"Memory"`
-	NanoCpus     int    `json:"NanoCpus"`
-	NetworkMode  string `json:"NetworkMode"`
+	Memory       int      `json:"Memory"`
+	NanoCpus     int      `json:"NanoCpus"`
+	NetworkMode  string   `json:"NetworkMode"`
+	ExtraHosts   []string `json:"ExtraHosts"`
 }
 
 // PortBinding represents a binding between to a port
 type PortBinding struct {
+	HostIP   string `json:"HostIp"`
 	HostPort string `json:"HostPort"`
 }
 
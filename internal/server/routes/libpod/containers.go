@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"k8s.io/klog"
 
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/config"
 	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/server/filter"
@@ -60,6 +61,27 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 	if _, ok := in.Labels[types.LabelNodeSelector]; !ok && cr.Config.NodeSelector != "" {
 		in.Labels[types.LabelNodeSelector] = cr.Config.NodeSelector
 	}
+	if _, ok := in.Labels[types.LabelTolerations]; !ok && cr.Config.Tolerations != "" {
+		in.Labels[types.LabelTolerations] = cr.Config.Tolerations
+	}
+	if _, ok := in.Labels[types.LabelNodeAffinity]; !ok && cr.Config.NodeAffinity != "" {
+		in.Labels[types.LabelNodeAffinity] = cr.Config.NodeAffinity
+	}
+	if _, ok := in.Labels[types.LabelPodAntiAffinity]; !ok && cr.Config.PodAntiAffinity != "" {
+		in.Labels[types.LabelPodAntiAffinity] = cr.Config.PodAntiAffinity
+	}
+	if _, ok := in.Labels[types.LabelPriorityClass]; !ok && cr.Config.PriorityClass != "" {
+		in.Labels[types.LabelPriorityClass] = cr.Config.PriorityClass
+	}
+	if _, ok := in.Labels[types.LabelRuntimeClass]; !ok && cr.Config.RuntimeClass != "" {
+		in.Labels[types.LabelRuntimeClass] = cr.Config.RuntimeClass
+	}
+	if _, ok := in.Labels[types.LabelTopologySpread]; !ok && cr.Config.TopologySpread != "" {
+		in.Labels[types.LabelTopologySpread] = cr.Config.TopologySpread
+	}
+	if _, ok := in.Labels[types.LabelWorkload]; !ok && cr.Config.Workload != "" {
+		in.Labels[types.LabelWorkload] = cr.Config.Workload
+	}
 	if _, ok := in.Labels[types.LabelActiveDeadlineSeconds]; !ok && cr.Config.ActiveDeadlineSeconds >= 0 {
 		in.Labels[types.LabelActiveDeadlineSeconds] = fmt.Sprintf("%d", cr.Config.ActiveDeadlineSeconds)
 	}
@@ -77,6 +99,7 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		Cmd:          in.Command,
 		Env:          env,
 		Binds:        []string{},
+		ExtraHosts:   in.HostAdd,
 		ExposedPorts: map[string]interface{}{},
 		ImagePorts:   map[string]interface{}{},
 		Labels:       in.Labels,
@@ -90,16 +113,23 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		for pp := range img.ExposedPorts {
 			tainr.ImagePorts[pp] = pp
 		}
+		tainr.Platform = img.Platform
 	}
 
 	for _, mapping := range in.PortMappings {
-		src := fmt.Sprintf("%d", mapping.HostPort)
-		dst := fmt.Sprintf("%d", mapping.ContainerPort)
-		if err := tainr.AddHostPort(src, dst); err != nil {
-			httputil.Error(c, http.StatusInternalServerError, err)
-			return
+		protos := mapping.Protocol
+		if protos == "" {
+			protos = "tcp"
+		}
+		for _, proto := range strings.Split(protos, ",") {
+			src := fmt.Sprintf("%d", mapping.HostPort)
+			dst := fmt.Sprintf("%d/%s", mapping.ContainerPort, strings.TrimSpace(proto))
+			if err := tainr.AddHostBinding(mapping.HostIP, src, dst); err != nil {
+				httputil.Error(c, http.StatusBadRequest, err)
+				return
+			}
+			tainr.ExposedPorts[dst] = src
 		}
-		tainr.ExposedPorts[dst] = src
 	}
 
 	addNetworkAliases(tainr, in.Network)
@@ -133,21 +163,11 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 // POST "/libpod/containers/:id/wait"
 func ContainerWait(cr *common.ContextRouter, c *gin.Context) {
 	id := c.Param("id")
-	ticker := time.NewTicker(time.Second)
-	for {
-		select {
-		case <-c.Request.Context().Done():
-			return
-		case <-ticker.C:
-			tainr, err := cr.DB.GetContainerByNameOrID(id)
-			if err == nil {
-				common.UpdateContainerStatus(cr, tainr)
-			}
-			if err != nil || tainr.Stopped || tainr.Killed || tainr.Completed {
-				c.Data(http.StatusOK, "application/json", []byte("0"))
-				return
-			}
-		}
+	get := func() (*types.Container, error) {
+		return cr.DB.GetContainerByNameOrID(id)
+	}
+	if common.WaitContainer(c.Request.Context(), cr, get) {
+		c.Data(http.StatusOK, "application/json", []byte("0"))
 	}
 }
 
@@ -318,25 +338,26 @@ func getContainerNames(tainr *types.Container) []string {
 // getNetworkSettingsPorts will return the available ports of the container
 // as a gin.H json structure to be used in container details.
 func getNetworkSettingsPorts(cr *common.ContextRouter, tainr *types.Container) gin.H {
-	ports := getAvailablePorts(cr, tainr)
 	res := gin.H{}
 	if tainr.HostIP == "" {
 		return res
 	}
-	for dst, prts := range ports {
-		pp := []map[string]string{}
-		done := map[int]int{}
-		for _, src := range prts {
-			if _, ok := done[src]; ok {
-				continue
+	for _, proto := range []string{"tcp", "udp"} {
+		for dst, prts := range getAvailablePorts(cr, tainr, proto) {
+			pp := []map[string]string{}
+			done := map[int]int{}
+			for _, src := range prts {
+				if _, ok := done[src]; ok {
+					continue
+				}
+				pp = append(pp, map[string]string{
+					"HostIp":   getHostIP(tainr, src, dst, proto),
+					"HostPort": fmt.Sprintf("%d", src),
+				})
+				done[src] = 1
 			}
-			pp = append(pp, map[string]string{
-				"HostIp":   tainr.HostIP,
-				"HostPort": fmt.Sprintf("%d", src),
-			})
-			done[src] = 1
+			res[fmt.Sprintf("%d/%s", dst, proto)] = pp
 		}
-		res[fmt.Sprintf("%d/tcp", dst)] = pp
 	}
 	return res
 }
@@ -344,32 +365,47 @@ func getNetworkSettingsPorts(cr *common.ContextRouter, tainr *types.Container) g
 // getContainerInfoPorts will return the available ports of the container
 // as a gin.H compatible json structure to be used in container list.
 func getContainerInfoPorts(cr *common.ContextRouter, tainr *types.Container) []map[string]interface{} {
-	ports := getAvailablePorts(cr, tainr)
 	res := []map[string]interface{}{}
 	if tainr.HostIP == "" {
 		return res
 	}
-	for dst, prts := range ports {
-		done := map[int]int{}
-		for _, src := range prts {
-			if _, ok := done[src]; ok {
-				continue
+	for _, proto := range []string{"tcp", "udp"} {
+		for dst, prts := range getAvailablePorts(cr, tainr, proto) {
+			done := map[int]int{}
+			for _, src := range prts {
+				if _, ok := done[src]; ok {
+					continue
+				}
+				res = append(res, map[string]interface{}{
+					"host_ip":        getHostIP(tainr, src, dst, proto),
+					"host_port":      src,
+					"container_port": dst,
+					"protocol":       strings.ToUpper(proto),
+				})
+				done[src] = 1
 			}
-			res = append(res, map[string]interface{}{
-				"host_ip":        tainr.HostIP,
-				"host_port":      src,
-				"container_port": dst,
-				"protocol":       "TCP",
-			})
-			done[src] = 1
 		}
 	}
 	return res
 }
 
-// getAvailablePorts will return all ports that are currently available on
-// the running container.
-func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int][]int {
+// getHostIP will return the host on which given container port is
+// available via given host port; this is the host of the ingress if the
+// port is exposed via an ingress, the ip the port-forward or reverse-proxy
+// is listening on, or the host ip of the container otherwise.
+func getHostIP(tainr *types.Container, src, dst int, proto string) string {
+	if host, ok := tainr.IngressHosts[dst]; ok && proto == "tcp" {
+		return host
+	}
+	if ip := tainr.GetListenIP(src, proto); ip != "" {
+		return ip
+	}
+	return tainr.HostIP
+}
+
+// getAvailablePorts will return all ports with given protocol (tcp or udp)
+// that are currently available on the running container.
+func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container, proto string) map[int][]int {
 	ports := map[int][]int{}
 	add := func(prts map[int]int) {
 		for src, dst := range prts {
@@ -382,6 +418,35 @@ func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int
 			ports[dst] = append(ports[dst], src)
 		}
 	}
+	if cr.Config.Expose == backend.ExposeIngress {
+		if proto == "tcp" {
+			for dst := range tainr.IngressHosts {
+				ports[dst] = []int{80}
+			}
+		}
+		return ports
+	}
+	if cr.Config.Expose != "" {
+		if proto == "udp" {
+			add(tainr.UDPMappedPorts)
+		} else {
+			add(tainr.MappedPorts)
+		}
+		return ports
+	}
+	if proto == "udp" {
+		if cr.Config.PortForward && !cr.Config.ReverseProxy && !config.InCluster() {
+			// udp is not relayed, as the pod ip is not reachable
+			return ports
+		}
+		if cr.Config.PortForward || cr.Config.ReverseProxy {
+			add(tainr.UDPHostPorts)
+			add(tainr.UDPMappedPorts)
+		} else {
+			add(tainr.GetServiceUDPPorts())
+		}
+		return ports
+	}
 	if cr.Config.PortForward || cr.Config.ReverseProxy {
 		add(tainr.HostPorts)
 		add(tainr.MappedPorts)
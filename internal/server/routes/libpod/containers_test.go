@@ -0,0 +1,56 @@
+package libpod
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/server/routes/common"
+)
+
+func TestContainerCreatePlatform(t *testing.T) {
+	tests := []struct {
+		image    string
+		platform string
+		out      string
+	}{
+		{image: "arm", platform: "linux/arm64", out: "linux/arm64"}, // 0
+		{image: "any", platform: "", out: ""},                       // 1
+		{image: "unknown", out: ""},                                 // 2
+	}
+	kub, _ := backend.New(backend.Config{Namespace: "default", Client: fake.NewSimpleClientset()})
+	cr, err := common.NewContextRouter(kub, common.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for i, tst := range tests {
+		if tst.image != "unknown" {
+			if err := cr.DB.SaveImage(&types.Image{Name: tst.image, Platform: tst.platform}); err != nil {
+				t.Fatalf("failed test %d - unexpected error %s", i, err)
+			}
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/libpod/containers/create", strings.NewReader(`{"image":"`+tst.image+`"}`))
+		ContainerCreate(cr, c)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("failed test %d - unexpected status %d: %s", i, w.Code, w.Body.String())
+		}
+		tainrs, err := cr.DB.GetContainers()
+		if err != nil || len(tainrs) == 0 {
+			t.Fatalf("failed test %d - expected container to be created", i)
+		}
+		for _, tainr := range tainrs {
+			if tainr.Image == tst.image && tainr.Platform != tst.out {
+				t.Errorf("failed test %d - expected platform %s, but got %s", i, tst.out, tainr.Platform)
+			}
+		}
+	}
+}
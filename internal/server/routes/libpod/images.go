@@ -16,9 +16,10 @@ import (
 // POST "/libpod/images/pull"
 func ImagePull(cr *common.ContextRouter, c *gin.Context) {
 	from := c.Query("reference")
-	img := &types.Image{Name: from}
+	platform := getPlatform(c.Query("OS"), c.Query("Arch"), c.Query("Variant"))
+	img := &types.Image{Name: from, Platform: platform}
 	if cr.Config.Inspector {
-		pts, err := cr.Backend.GetImageExposedPorts(from)
+		pts, err := cr.Backend.GetImageExposedPorts(from, platform)
 		if err != nil {
 			httputil.Error(c, http.StatusInternalServerError, err)
 			return
@@ -37,3 +38,17 @@ func ImagePull(cr *common.ContextRouter, c *gin.Context) {
 		"Id": img.ID,
 	})
 }
+
+// getPlatform will return a docker platform string (os/arch/variant) for
+// given os, architecture and variant. If no architecture is provided, it will
+// return an empty string.
+func getPlatform(os, arch, variant string) string {
+	if arch == "" {
+		return ""
+	}
+	if os == "" {
+		os = "linux"
+	}
+	pl := types.Platform{OS: os, Architecture: arch, Variant: variant}
+	return pl.String()
+}
@@ -15,6 +15,7 @@ type ContainerCreateRequest struct {
 	Mounts       []Mount                     `json:"mounts"`
 	Terminal     bool                        `json:"terminal"`
 	Stdin        bool                        `json:"Stdin"`
+	HostAdd      []string                    `json:"hostadd"`
 }
 
 // PortMapping describes how to map a port into the container.
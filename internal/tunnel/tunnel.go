@@ -0,0 +1,374 @@
+// Package tunnel implements a reverse tunnel that relays connections that
+// are accepted by the agent, which runs inside the cluster, to ports on the
+// host kubedock runs on. The client (kubedock) keeps a pool of idle
+// connections open towards the control port of the agent. Each connection
+// starts with the token of the kubedock instance (2 bytes length, big
+// endian, followed by the token), and is only added to the pool if the
+// token matches the token of the agent. When the agent accepts a connection
+// on one of the tunneled ports, it takes an idle connection from the pool,
+// and writes the port (2 bytes, big endian). The client connects to the
+// port on the host and acknowledges with a single byte, after which both
+// connections are relayed.
+package tunnel
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// ackTimeOut is the number of seconds the agent waits for the client to
+	// acknowledge a relayed connection.
+	ackTimeOut = 5
+	// poolTimeOut is the number of seconds the agent waits for an idle
+	// connection of the client, before an incoming connection is dropped.
+	poolTimeOut = 10
+	// idleTimeOut is the number of seconds after which the client recycles
+	// an idle connection, to get rid of connections that silently died.
+	idleTimeOut = 300
+	// ackOK is sent by the client when the connection to the local port is
+	// established.
+	ackOK = 1
+	// ackRefused is sent by the client when the local port can't be reached.
+	ackRefused = 0
+)
+
+// relay will copy the data between both given connections, and closes
+// both connections when done.
+func relay(conn1, conn2 net.Conn) {
+	go io.Copy(conn1, conn2)
+	io.Copy(conn2, conn1)
+	conn1.Close()
+	conn2.Close()
+}
+
+// writePort will write given port to given connection.
+func writePort(conn net.Conn, port int) error {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, uint16(port))
+	_, err := conn.Write(buf)
+	return err
+}
+
+// readPort will read a port from given connection.
+func readPort(conn net.Conn) (int, error) {
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(buf)), nil
+}
+
+// writeToken will write given token to given connection.
+func writeToken(conn net.Conn, token string) error {
+	if len(token) > 65535 {
+		return fmt.Errorf("token too large")
+	}
+	buf := make([]byte, 2, len(token)+2)
+	binary.BigEndian.PutUint16(buf, uint16(len(token)))
+	_, err := conn.Write(append(buf, token...))
+	return err
+}
+
+// readToken will read a token from given connection.
+func readToken(conn net.Conn) (string, error) {
+	l, err := readPort(conn)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// Agent is the part of the tunnel that runs inside the cluster, and accepts
+// the connections that are relayed to the kubedock host.
+type Agent struct {
+	control string
+	ports   []int
+	token   string
+	pool    chan net.Conn
+}
+
+// NewAgent will return a new Agent that accepts the connections of the
+// client with given token on given control address, and relays the
+// connections accepted on given ports.
+func NewAgent(control string, ports []int, token string) *Agent {
+	return &Agent{
+		control: control,
+		ports:   ports,
+		token:   token,
+		pool:    make(chan net.Conn, 64),
+	}
+}
+
+// ListenAndServe will start listening on the control address and the
+// tunneled ports, which are listened on at the host of the control address.
+// The connections are served in the background, until the stop channel is
+// closed.
+func (a *Agent) ListenAndServe(stop <-chan struct{}) error {
+	if a.token == "" {
+		return fmt.Errorf("tunnel agent requires a token")
+	}
+	host, _, err := net.SplitHostPort(a.control)
+	if err != nil {
+		return err
+	}
+	lns := []net.Listener{}
+	closeAll := func() {
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}
+	ctrl, err := net.Listen("tcp", a.control)
+	if err != nil {
+		return err
+	}
+	lns = append(lns, ctrl)
+	for _, port := range a.ports {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, fmt.Sprintf("%d", port)))
+		if err != nil {
+			closeAll()
+			return err
+		}
+		lns = append(lns, ln)
+		go a.serve(ln, port)
+	}
+	klog.Infof("tunnel agent listening on %s for ports %v", a.control, a.ports)
+	go a.serveControl(ctrl)
+	go func() {
+		<-stop
+		closeAll()
+	}()
+	return nil
+}
+
+// serveControl will add the connections of the client to the pool of idle
+// connections, once they are authenticated.
+func (a *Agent) serveControl(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go a.authenticate(conn)
+	}
+}
+
+// authenticate will add given control connection to the pool of idle
+// connections if it presents the token of the agent, and closes it
+// otherwise.
+func (a *Agent) authenticate(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(ackTimeOut * time.Second))
+	token, err := readToken(conn)
+	if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		klog.Warningf("rejecting unauthenticated tunnel connection from %s", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	select {
+	case a.pool <- conn:
+	default:
+		klog.Warningf("tunnel connection pool exhausted, dropping connection")
+		conn.Close()
+	}
+}
+
+// serve will relay the connections accepted on given listener to the
+// given port on the kubedock host.
+func (a *Agent) serve(ln net.Listener, port int) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go a.handle(conn, port)
+	}
+}
+
+// handle will relay given connection to given port via an idle connection
+// of the client. Idle connections that don't acknowledge are discarded, and
+// the next idle connection is tried instead.
+func (a *Agent) handle(conn net.Conn, port int) {
+	timeout := time.After(poolTimeOut * time.Second)
+	for {
+		var ctrl net.Conn
+		select {
+		case ctrl = <-a.pool:
+		case <-timeout:
+			klog.Warningf("no tunnel connection available for port %d", port)
+			conn.Close()
+			return
+		}
+		ack, err := a.request(ctrl, port)
+		if err != nil {
+			klog.V(3).Infof("discarding tunnel connection: %s", err)
+			ctrl.Close()
+			continue
+		}
+		if ack != ackOK {
+			klog.V(3).Infof("port %d refused on kubedock host", port)
+			ctrl.Close()
+			conn.Close()
+			return
+		}
+		klog.V(3).Infof("relaying connection for port %d", port)
+		relay(conn, ctrl)
+		return
+	}
+}
+
+// request will request the client to connect to given port via given idle
+// connection, and returns the acknowledgement of the client.
+func (a *Agent) request(ctrl net.Conn, port int) (byte, error) {
+	ctrl.SetDeadline(time.Now().Add(ackTimeOut * time.Second))
+	if err := writePort(ctrl, port); err != nil {
+		return 0, err
+	}
+	ack := make([]byte, 1)
+	if _, err := io.ReadFull(ctrl, ack); err != nil {
+		return 0, err
+	}
+	ctrl.SetDeadline(time.Time{})
+	return ack[0], nil
+}
+
+// Client is the part of the tunnel that runs on the kubedock host, and
+// connects the relayed connections to the local ports.
+type Client struct {
+	cfg ClientConfig
+}
+
+// ClientConfig is the structure to instantiate a Client object.
+type ClientConfig struct {
+	// Dial is the function that opens a connection to the control port of
+	// the agent.
+	Dial func() (net.Conn, error)
+	// Token is the token that authenticates the connections at the agent.
+	Token string
+	// Host is the host the relayed connections are connected to.
+	Host string
+	// Ports are the ports that are allowed to be connected to.
+	Ports []int
+	// PoolSize is the number of idle connections kept open to the agent.
+	PoolSize int
+}
+
+// NewClient will return a new Client instance.
+func NewClient(cfg ClientConfig) *Client {
+	if cfg.Host == "" {
+		cfg.Host = "127.0.0.1"
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 4
+	}
+	return &Client{cfg: cfg}
+}
+
+// Run will keep the pool of idle connections open in the background, until
+// the stop channel is closed.
+func (c *Client) Run(stop <-chan struct{}) {
+	for i := 0; i < c.cfg.PoolSize; i++ {
+		go c.worker(stop)
+	}
+}
+
+// worker will open an idle connection to the agent, and handles the
+// request that comes in on it. When the connection is done, a new idle
+// connection is opened. If the agent can't be reached, or closes the idle
+// connection right away, it will retry with an exponential backoff.
+func (c *Client) worker(stop <-chan struct{}) {
+	delay := time.Second
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		start := time.Now()
+		conn, err := c.cfg.Dial()
+		if err == nil {
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stop:
+					conn.Close()
+				case <-done:
+				}
+			}()
+			err = c.handle(conn)
+			close(done)
+		}
+		if err == nil || time.Since(start) > time.Second {
+			delay = time.Second
+			continue
+		}
+		klog.V(3).Infof("error connecting to tunnel agent: %s, retrying in %s", err, delay)
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > 30*time.Second {
+			delay = 30 * time.Second
+		}
+	}
+}
+
+// handle will authenticate given idle connection, wait for a request on it,
+// and relays it to the requested local port. It returns an error if the
+// idle connection was closed before a request was received.
+func (c *Client) handle(conn net.Conn) error {
+	if err := writeToken(conn, c.cfg.Token); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(idleTimeOut * time.Second))
+	port, err := readPort(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+	if !c.allowed(port) {
+		klog.Warningf("tunnel request for port %d is not allowed", port)
+		conn.Write([]byte{ackRefused})
+		conn.Close()
+		return nil
+	}
+	addr := net.JoinHostPort(c.cfg.Host, fmt.Sprintf("%d", port))
+	local, err := net.DialTimeout("tcp", addr, ackTimeOut*time.Second)
+	if err != nil {
+		klog.Warningf("error connecting tunnel to %s: %s", addr, err)
+		conn.Write([]byte{ackRefused})
+		conn.Close()
+		return nil
+	}
+	if _, err := conn.Write([]byte{ackOK}); err != nil {
+		local.Close()
+		conn.Close()
+		return nil
+	}
+	klog.V(3).Infof("relaying tunnel connection to %s", addr)
+	go relay(conn, local)
+	return nil
+}
+
+// allowed will check if given port is allowed to be connected to.
+func (c *Client) allowed(port int) bool {
+	for _, p := range c.cfg.Ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T, host string) int {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func helloServer(t *testing.T) (int, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("Hello!\n"))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, func() { ln.Close() }
+}
+
+func callServer(addr string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestTunnel(t *testing.T) {
+	port, closeServer := helloServer(t)
+	defer closeServer()
+	closed := freePort(t, "127.0.0.1")
+	denied := freePort(t, "127.0.0.2")
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	control := fmt.Sprintf("127.0.0.2:%d", freePort(t, "127.0.0.2"))
+	agent := NewAgent(control, []int{port, closed, denied}, "tb303")
+	if err := agent.ListenAndServe(stop); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	client := NewClient(ClientConfig{
+		Dial:     func() (net.Conn, error) { return net.Dial("tcp", control) },
+		Token:    "tb303",
+		Ports:    []int{port, closed},
+		PoolSize: 2,
+	})
+	client.Run(stop)
+
+	tests := []struct {
+		port int
+		out  string
+		err  bool
+	}{
+		{port: port, out: "Hello!\n"}, // 0
+		{port: port, out: "Hello!\n"}, // 1
+		{port: port, out: "Hello!\n"}, // 2
+		{port: closed, err: true},     // 3
+		{port: denied, err: true},     // 4
+	}
+	for i, tst := range tests {
+		res, err := callServer(fmt.Sprintf("127.0.0.2:%d", tst.port))
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %v", i, err)
+		}
+		if res != tst.out {
+			t.Errorf("failed test %d - expected %q, but got %q", i, tst.out, res)
+		}
+	}
+}
+
+func TestTunnelToken(t *testing.T) {
+	port, closeServer := helloServer(t)
+	defer closeServer()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	control := fmt.Sprintf("127.0.0.2:%d", freePort(t, "127.0.0.2"))
+	if err := NewAgent(control, []int{port}, "").ListenAndServe(stop); err == nil {
+		t.Errorf("expected error when starting agent without token")
+	}
+	agent := NewAgent(control, []int{port}, "tb303")
+	if err := agent.ListenAndServe(stop); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	client := NewClient(ClientConfig{
+		Dial:     func() (net.Conn, error) { return net.Dial("tcp", control) },
+		Token:    "tr808",
+		Ports:    []int{port},
+		PoolSize: 1,
+	})
+	client.Run(stop)
+
+	time.Sleep(100 * time.Millisecond)
+	if len(agent.pool) != 0 {
+		t.Errorf("expected connections with an invalid token not to be pooled")
+	}
+}
@@ -12,9 +12,17 @@ import (
 
 // InspectConfig will return an Image object with the configuration
 // of the specified image. (docker://docker.io/joyrex2001/kubedock:latest)
-func InspectConfig(name string) (*v1.Image, error) {
+// If an architecture (and cpu variant) is given, the matching variant will be
+// selected from the manifest list, and an error is returned if no such
+// variant exists.
+func InspectConfig(name, os, arch, variant string) (*v1.Image, error) {
+	if os == "" {
+		os = "linux"
+	}
 	sys := &types.SystemContext{
-		OSChoice: "linux",
+		OSChoice:           os,
+		ArchitectureChoice: arch,
+		VariantChoice:      variant,
 	}
 
 	ctx := context.Background()
@@ -33,6 +41,13 @@ func InspectConfig(name string) (*v1.Image, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error reading OCI-formatted configuration data: %w", err)
 	}
+	if arch != "" && (config.OS != os || config.Architecture != arch) {
+		return nil, fmt.Errorf("image %s has no variant for platform %s/%s", name, os, arch)
+	}
+	// arm64 images don't always specify their (default) v8 variant
+	if variant != "" && config.Variant != variant && !(arch == "arm64" && variant == "v8" && config.Variant == "") {
+		return nil, fmt.Errorf("image %s has no variant for platform %s/%s/%s", name, os, arch, variant)
+	}
 	return config, err
 }
 
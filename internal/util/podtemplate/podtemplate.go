@@ -1,11 +1,16 @@
 package podtemplate
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
 )
 
 // PodFromFile will read a given file with pod definition and returns a corev1.Pod
@@ -37,3 +42,83 @@ func ContainerFromPod(pod *corev1.Pod) corev1.Container {
 	}
 	return container
 }
+
+// Patch will apply given patch to a copy of given pod and returns the
+// patched pod. The patch can be provided as json or yaml, and is either
+// a json patch (RFC 6902) if it's a list of operations, or a strategic
+// merge patch otherwise. The patched pod should still contain a container
+// with given name, and should keep the original pod name, namespace and
+// kubedock labels.
+func Patch(pod *corev1.Pod, patch []byte, container string) (*corev1.Pod, error) {
+	jpatch, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod patch: %w", err)
+	}
+
+	orig, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	if bytes.HasPrefix(bytes.TrimSpace(jpatch), []byte("[")) {
+		ops, err := jsonpatch.DecodePatch(jpatch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json pod patch: %w", err)
+		}
+		patched, err = ops.Apply(orig)
+		if err != nil {
+			return nil, fmt.Errorf("failed applying json pod patch: %w", err)
+		}
+	} else {
+		patched, err = strategicpatch.StrategicMergePatch(orig, jpatch, corev1.Pod{})
+		if err != nil {
+			return nil, fmt.Errorf("failed applying strategic merge pod patch: %w", err)
+		}
+	}
+
+	res := &corev1.Pod{}
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(res); err != nil {
+		return nil, fmt.Errorf("pod patch results in an invalid pod: %w", err)
+	}
+
+	if err := validatePatchedPod(pod, res, container); err != nil {
+		return nil, fmt.Errorf("pod patch results in an invalid pod: %w", err)
+	}
+
+	return res, nil
+}
+
+// protectedLabels are the labels that are used by kubedock to find and
+// clean up its pods, and which can't be changed by a patch.
+var protectedLabels = []string{"kubedock", "kubedock.id", "kubedock.containerid"}
+
+// validatePatchedPod will do some basic sanity checks on the patched pod
+// to make sure it can still be managed as the original pod.
+func validatePatchedPod(orig, pod *corev1.Pod, container string) error {
+	if pod.Name != orig.Name || pod.Namespace != orig.Namespace {
+		return fmt.Errorf("name and namespace can not be changed")
+	}
+	for _, l := range protectedLabels {
+		ov, ook := orig.Labels[l]
+		nv, nok := pod.Labels[l]
+		if ov != nv || ook != nok {
+			return fmt.Errorf("label %s can not be changed", l)
+		}
+	}
+	found := false
+	for _, c := range pod.Spec.Containers {
+		if c.Name == "" {
+			return fmt.Errorf("all containers require a name")
+		}
+		if c.Name == container {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("container %s is missing", container)
+	}
+	return nil
+}
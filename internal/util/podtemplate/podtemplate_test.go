@@ -2,6 +2,9 @@ package podtemplate
 
 import (
 	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestPodFromFile(t *testing.T) {
@@ -59,3 +62,89 @@ func TestPodFromFile(t *testing.T) {
 		t.Error("expected an error when file is invalid yaml")
 	}
 }
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		patch   string
+		hostnet bool
+		vols    int
+		err     bool
+	}{
+		{ // 0
+			patch:   `{"spec":{"hostNetwork":true}}`,
+			hostnet: true,
+		},
+		{ // 1
+			patch: "spec:\n  volumes:\n  - name: data\n    emptyDir: {}\n",
+			vols:  1,
+		},
+		{ // 2
+			patch:   `[{"op":"add","path":"/spec/hostNetwork","value":true}]`,
+			hostnet: true,
+		},
+		{ // 3
+			patch: `{"spec":{"hostNetwork":"yes"}}`,
+			err:   true,
+		},
+		{ // 4
+			patch: `{"spec":{"hostNetwrk":true}}`,
+			err:   true,
+		},
+		{ // 5
+			patch: `[{"op":"remove","path":"/spec/containers/0"}]`,
+			err:   true,
+		},
+		{ // 6
+			patch: `{"metadata":{"name":"other"}}`,
+			err:   true,
+		},
+		{ // 7
+			patch: `[{"op":"remove","path":"/spec/notfound"}]`,
+			err:   true,
+		},
+		{ // 8
+			patch: `{"spec": [`,
+			err:   true,
+		},
+		{ // 9
+			patch: `{"metadata":{"labels":{"kubedock.id":"other"}}}`,
+			err:   true,
+		},
+		{ // 10
+			patch: `[{"op":"remove","path":"/metadata/labels/kubedock.containerid"}]`,
+			err:   true,
+		},
+		{ // 11
+			patch:   `{"metadata":{"labels":{"app":"tb303"}},"spec":{"hostNetwork":true}}`,
+			hostnet: true,
+		},
+	}
+
+	for i, tst := range tests {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "tb303", Namespace: "default", Labels: map[string]string{
+				"kubedock": "true", "kubedock.id": "rc752", "kubedock.containerid": "tb303",
+			}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "main", Image: "busybox"}},
+			},
+		}
+		res, err := Patch(pod, []byte(tst.patch), "main")
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+			continue
+		}
+		if tst.err {
+			continue
+		}
+		if res.Spec.HostNetwork != tst.hostnet {
+			t.Errorf("failed test %d - expected hostNetwork %t, but got %t", i, tst.hostnet, res.Spec.HostNetwork)
+		}
+		if len(res.Spec.Volumes) != tst.vols {
+			t.Errorf("failed test %d - expected %d volumes, but got %d", i, tst.vols, len(res.Spec.Volumes))
+		}
+		if pod.Spec.HostNetwork || len(pod.Spec.Volumes) != 0 {
+			t.Errorf("failed test %d - original pod was modified", i)
+		}
+	}
+}
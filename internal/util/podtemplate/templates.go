@@ -0,0 +1,168 @@
+package podtemplate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// AnnotationMatchImage is the annotation in a pod template that contains
+	// a comma-separated list of image globs for which the template is used.
+	AnnotationMatchImage = "kubedock.podtemplate/match-image"
+	// AnnotationMatchLabels is the annotation in a pod template that contains
+	// a label selector that should match the container labels for which the
+	// template is used.
+	AnnotationMatchLabels = "kubedock.podtemplate/match-labels"
+)
+
+// Template is a pod template, including the optional rules that determine
+// for which containers the template should be used.
+type Template struct {
+	// Name is the name of the file the template was read from
+	Name string
+	// Pod is the pod that should be used as the base for creating pods
+	Pod *corev1.Pod
+	// Container is the container that should be used as the base for
+	// creating containers
+	Container corev1.Container
+	images    []*regexp.Regexp
+	selector  labels.Selector
+}
+
+// TemplatesFromPath will read all pod templates from given comma-separated
+// list of files and/or directories. Directories are read in alphabetical
+// order, and only files with a .yaml, .yml or .json extension are read.
+func TemplatesFromPath(paths string) ([]*Template, error) {
+	res := []*Template{}
+	for _, p := range strings.Split(paths, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		files, err := templateFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			tmpl, err := TemplateFromFile(file)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, tmpl)
+		}
+	}
+	return res, nil
+}
+
+// templateFiles will return the template files for given path. If the path
+// is a directory, it will return all yaml and json files in the directory.
+func templateFiles(path string) ([]string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// TemplateFromFile will read given pod template file, and parse the match
+// rules that are present as annotations in the template. These annotations
+// are removed from the template pod.
+func TemplateFromFile(file string) (*Template, error) {
+	pod, err := PodFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &Template{Name: filepath.Base(file), Pod: pod}
+
+	if globs := pod.Annotations[AnnotationMatchImage]; globs != "" {
+		for _, g := range strings.Split(globs, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				tmpl.images = append(tmpl.images, globToRegexp(g))
+			}
+		}
+	}
+	if sel := pod.Annotations[AnnotationMatchLabels]; sel != "" {
+		tmpl.selector, err = labels.Parse(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in podtemplate %s: %w", AnnotationMatchLabels, file, err)
+		}
+	}
+	delete(pod.Annotations, AnnotationMatchImage)
+	delete(pod.Annotations, AnnotationMatchLabels)
+
+	tmpl.Container = ContainerFromPod(pod)
+	return tmpl, nil
+}
+
+// globToRegexp will convert given glob into a regular expression, where *
+// matches any sequence of characters (including /) and ? matches a single
+// character.
+func globToRegexp(glob string) *regexp.Regexp {
+	exp := regexp.QuoteMeta(glob)
+	exp = strings.ReplaceAll(exp, `\*`, `.*`)
+	exp = strings.ReplaceAll(exp, `\?`, `.`)
+	return regexp.MustCompile("^" + exp + "$")
+}
+
+// HasRules will return true if the template has match rules, and false if
+// it's a template that should be used by default.
+func (t *Template) HasRules() bool {
+	return len(t.images) > 0 || t.selector != nil
+}
+
+// Matches will return true if given image and labels match all rules of
+// this template. A template without rules doesn't match anything.
+func (t *Template) Matches(image string, lbls map[string]string) bool {
+	if !t.HasRules() {
+		return false
+	}
+	if len(t.images) > 0 {
+		match := false
+		for _, re := range t.images {
+			if re.MatchString(image) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if t.selector != nil && !t.selector.Matches(labels.Set(lbls)) {
+		return false
+	}
+	return true
+}
+
+// Select will return the first template that matches given image and
+// labels. If no template matches, it will return nil.
+func Select(tmpls []*Template, image string, lbls map[string]string) *Template {
+	for _, t := range tmpls {
+		if t.Matches(image, lbls) {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package podtemplate
+
+import (
+	"testing"
+)
+
+func TestTemplatesFromPath(t *testing.T) {
+	tmpls, err := TemplatesFromPath("test/templates")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tmpls) != 3 {
+		t.Fatalf("expected 3 templates, but got %d", len(tmpls))
+	}
+	if tmpls[0].Name != "00-default.yaml" || tmpls[0].HasRules() {
+		t.Errorf("expected 00-default.yaml without rules as first template")
+	}
+	if _, ok := tmpls[1].Pod.Annotations[AnnotationMatchImage]; ok {
+		t.Errorf("expected match annotations to be removed from template")
+	}
+	if tmpls[1].Container.Resources.Requests.Memory().String() != "2Gi" {
+		t.Errorf("expected container template with 2Gi memory request")
+	}
+
+	tmpls, err = TemplatesFromPath("test/test_pod.yaml, test/templates/20-kafka.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tmpls) != 2 {
+		t.Errorf("expected 2 templates, but got %d", len(tmpls))
+	}
+
+	for _, p := range []string{"test/notfound", "test/test_invalid.yaml", "test"} {
+		if _, err := TemplatesFromPath(p); err == nil {
+			t.Errorf("expected an error reading %s", p)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tmpls, err := TemplatesFromPath("test/templates")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		image  string
+		labels map[string]string
+		name   string
+	}{
+		{image: "docker.elastic.co/elasticsearch/elasticsearch:8.12.0", name: "10-elastic.yaml"},
+		{image: "opensearchproject/opensearch:2", name: "10-elastic.yaml"},
+		{image: "confluentinc/cp-kafka:7.6.0", labels: map[string]string{"app": "kafka"}, name: "20-kafka.yaml"},
+		{image: "confluentinc/cp-kafka:7.6.0", labels: map[string]string{"app": "redis"}, name: ""},
+		{image: "busybox", name: ""},
+	}
+	for i, tst := range tests {
+		name := ""
+		if tmpl := Select(tmpls, tst.image, tst.labels); tmpl != nil {
+			name = tmpl.Name
+		}
+		if name != tst.name {
+			t.Errorf("failed test %d - expected template '%s', but got '%s'", i, tst.name, name)
+		}
+	}
+}
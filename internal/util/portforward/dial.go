@@ -0,0 +1,133 @@
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/klog"
+)
+
+// Dial will open a connection to the pod port of given request via the
+// port-forward api, without listening on a local port. The local port and
+// channels of the request are ignored.
+func Dial(req Request) (net.Conn, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(req.RestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := getURLScheme(req)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	sc, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	headers.Set(v1.StreamType, v1.StreamTypeError)
+	headers.Set(v1.PortHeader, fmt.Sprintf("%d", req.PodPort))
+	headers.Set(v1.PortForwardRequestIDHeader, "0")
+	errs, err := sc.CreateStream(headers)
+	if err != nil {
+		sc.Close()
+		return nil, err
+	}
+	// the error stream is only read from
+	errs.Close()
+
+	headers.Set(v1.StreamType, v1.StreamTypeData)
+	data, err := sc.CreateStream(headers)
+	if err != nil {
+		sc.Close()
+		return nil, err
+	}
+
+	conn := &streamConn{conn: sc, data: data, pod: fmt.Sprintf("%s/%s:%d", req.Pod.Namespace, req.Pod.Name, req.PodPort)}
+	go func() {
+		msg, err := io.ReadAll(errs)
+		if err == nil && len(msg) > 0 {
+			klog.Warningf("error forwarding to %s: %s", conn.pod, msg)
+			conn.Close()
+		}
+	}()
+	return conn, nil
+}
+
+// streamConn is a net.Conn that reads and writes the data stream of a
+// port-forward connection.
+type streamConn struct {
+	conn  httpstream.Connection
+	data  httpstream.Stream
+	pod   string
+	close sync.Once
+}
+
+// Read will read from the data stream.
+func (c *streamConn) Read(b []byte) (int, error) {
+	return c.data.Read(b)
+}
+
+// Write will write to the data stream.
+func (c *streamConn) Write(b []byte) (int, error) {
+	return c.data.Write(b)
+}
+
+// Close will close the data stream and the port-forward connection.
+func (c *streamConn) Close() error {
+	var err error
+	c.close.Do(func() {
+		c.data.Close()
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// LocalAddr is not applicable for port-forward connections.
+func (c *streamConn) LocalAddr() net.Addr {
+	return streamAddr("kubedock")
+}
+
+// RemoteAddr will return the pod and port that is connected to.
+func (c *streamConn) RemoteAddr() net.Addr {
+	return streamAddr(c.pod)
+}
+
+// SetDeadline is not supported on port-forward connections.
+func (c *streamConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is not supported on port-forward connections.
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is not supported on port-forward connections.
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// streamAddr is the net.Addr of a port-forward connection.
+type streamAddr string
+
+// Network will return the network of the address.
+func (a streamAddr) Network() string {
+	return "portforward"
+}
+
+// String will return the address.
+func (a streamAddr) String() string {
+	return string(a)
+}
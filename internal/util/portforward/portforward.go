@@ -21,6 +21,8 @@ type Request struct {
 	RestConfig *rest.Config
 	// Pod is the selected pod for this port forwarding
 	Pod v1.Pod
+	// LocalIP is the local ip the port-forward listens on (default localhost)
+	LocalIP string
 	// LocalPort is the local port that will be selected to expose the PodPort
 	LocalPort int
 	// PodPort is the target port for the pod
@@ -47,7 +49,11 @@ func ToPod(req Request) error {
 	}
 
 	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
-	fw, err := portforward.New(dialer, []string{fmt.Sprintf("%d:%d", req.LocalPort, req.PodPort)}, req.StopCh, req.ReadyCh, logr, logr)
+	addrs := []string{"localhost"}
+	if req.LocalIP != "" {
+		addrs = []string{req.LocalIP}
+	}
+	fw, err := portforward.NewOnAddresses(dialer, addrs, []string{fmt.Sprintf("%d:%d", req.LocalPort, req.PodPort)}, req.StopCh, req.ReadyCh, logr, logr)
 	if err != nil {
 		return err
 	}
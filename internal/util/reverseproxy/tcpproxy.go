@@ -14,6 +14,8 @@ const initialConnectTimeOut = 5 // number of seconds to try to wait before actua
 
 // Request is the structure used as argument for Proxy
 type Request struct {
+	// LocalIP is the local ip the reverse proxy listens on (default 0.0.0.0)
+	LocalIP string
 	// LocalPort is the local port that will be selected for the reverse proxy
 	LocalPort int
 	// PodPort is the target port for the reverse proxy
@@ -31,7 +33,7 @@ type Request struct {
 // local port and proxies this to the given remote ip and destination port.
 // based on: https://gist.github.com/vmihailenco/1380352
 func Proxy(req Request) error {
-	local := fmt.Sprintf("0.0.0.0:%d", req.LocalPort)
+	local := getLocalAddr(req)
 	remote := net.JoinHostPort(req.RemoteIP, fmt.Sprintf("%d", req.RemotePort))
 
 	klog.Infof("start reverse-proxy %s->%s", local, remote)
@@ -125,3 +127,13 @@ func remoteAcceptsConnection(remote string) bool {
 	conn.Close()
 	return true
 }
+
+// getLocalAddr will return the local address the reverse proxy of given
+// request should listen on.
+func getLocalAddr(req Request) string {
+	ip := req.LocalIP
+	if ip == "" {
+		ip = "0.0.0.0"
+	}
+	return net.JoinHostPort(ip, fmt.Sprintf("%d", req.LocalPort))
+}
@@ -189,3 +189,19 @@ func TestProxyIPv6Normal(t *testing.T) {
 	stopP <- struct{}{}
 	stopS <- struct{}{}
 }
+
+func TestGetLocalAddr(t *testing.T) {
+	tests := []struct {
+		in  Request
+		out string
+	}{
+		{in: Request{LocalPort: 303}, out: "0.0.0.0:303"},                         // 0
+		{in: Request{LocalIP: "127.0.0.1", LocalPort: 303}, out: "127.0.0.1:303"}, // 1
+		{in: Request{LocalIP: "::1", LocalPort: 303}, out: "[::1]:303"},           // 2
+	}
+	for i, tst := range tests {
+		if res := getLocalAddr(tst.in); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package reverseproxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const udpIdleTimeOut = 60 // number of seconds after which an idle udp session is closed
+
+// ProxyUDP will open a udp relay, listening to the provided local port
+// and relays the datagrams to the given remote ip and destination port.
+// Every client gets its own session towards the remote, so replies are
+// sent back to the client that sent the original datagram.
+func ProxyUDP(req Request) error {
+	local := getLocalAddr(req)
+	remote, err := net.ResolveUDPAddr("udp", net.JoinHostPort(req.RemoteIP, fmt.Sprintf("%d", req.RemotePort)))
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("start udp relay %s->%s", local, remote)
+
+	pc, err := net.ListenPacket("udp", local)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	sessions := map[string]*net.UDPConn{}
+	done := false
+	go func() {
+		<-req.StopCh
+		klog.Infof("stopped udp relay %s->%s", local, remote)
+		mu.Lock()
+		done = true
+		for _, conn := range sessions {
+			conn.Close()
+		}
+		mu.Unlock()
+		pc.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, client, err := pc.ReadFrom(buf)
+			if err != nil {
+				mu.Lock()
+				stopped := done
+				mu.Unlock()
+				if stopped {
+					return
+				}
+				// back off on timeouts, and stop the relay on other errors,
+				// as these will keep failing
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					time.Sleep(time.Second / retryRate)
+					continue
+				}
+				klog.Errorf("error reading datagram, stopped udp relay %s->%s: %s", local, remote, err)
+				return
+			}
+			mu.Lock()
+			conn, ok := sessions[client.String()]
+			if !ok {
+				conn, err = net.DialUDP("udp", nil, remote)
+				if err != nil {
+					mu.Unlock()
+					klog.Errorf("error dialing %s: %s", remote, err)
+					continue
+				}
+				sessions[client.String()] = conn
+				go handleSession(pc, conn, client, func() {
+					mu.Lock()
+					delete(sessions, client.String())
+					mu.Unlock()
+				})
+			}
+			mu.Unlock()
+			conn.SetDeadline(time.Now().Add(udpIdleTimeOut * time.Second))
+			if _, err := conn.Write(buf[:n]); err != nil {
+				klog.V(3).Infof("error relaying datagram to %s: %s", remote, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// handleSession will relay the replies of the remote on given connection
+// back to given client, until the session is idle for too long. It will
+// close the given connection when returned.
+func handleSession(pc net.PacketConn, conn *net.UDPConn, client net.Addr, cleanup func()) {
+	defer cleanup()
+	defer conn.Close()
+	buf := make([]byte, 65535)
+	for {
+		conn.SetReadDeadline(time.Now().Add(udpIdleTimeOut * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			klog.V(3).Infof("closing udp session for %s: %s", client, err)
+			return
+		}
+		if _, err := pc.WriteTo(buf[:n], client); err != nil {
+			klog.V(3).Infof("error relaying datagram to %s: %s", client, err)
+		}
+	}
+}
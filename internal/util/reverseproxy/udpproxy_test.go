@@ -0,0 +1,63 @@
+package reverseproxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProxyUDP(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(append([]byte("echo "), buf[:n]...), addr)
+		}
+	}()
+
+	// reserve a free local port for the relay
+	free, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	local := free.LocalAddr().(*net.UDPAddr)
+	free.Close()
+
+	stop := make(chan struct{}, 1)
+	defer close(stop)
+	err = ProxyUDP(Request{
+		LocalPort:  local.Port,
+		RemoteIP:   "127.0.0.1",
+		RemotePort: echo.LocalAddr().(*net.UDPAddr).Port,
+		StopCh:     stop,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	conn, err := net.Dial("udp", local.String())
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("tb303")); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if string(buf[:n]) != "echo tb303" {
+		t.Errorf("expected 'echo tb303', but got '%s'", buf[:n])
+	}
+}